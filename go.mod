@@ -1,3 +1,10 @@
 module github.com/NouemanKHAL/go-shell
 
 go 1.22.2
+
+require (
+	golang.org/x/crypto v0.27.0
+	golang.org/x/net v0.29.0
+	golang.org/x/sys v0.25.0
+	golang.org/x/term v0.24.0
+)
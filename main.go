@@ -2,18 +2,107 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
+	"runtime/debug"
+	"strings"
 
-	"github.com/NouemanKHAL/go-shell/internal/shell"
+	"github.com/NouemanKHAL/go-shell/pkg/shell"
+	"golang.org/x/term"
 )
 
+// version is set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3"
+var version string
+
+// buildVersion returns the version set at build time, or the module version
+// when installed with go install.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
 func main() {
-	sh, err := shell.NewShell()
+	if shell.IsExecHelper() {
+		shell.RunExecHelper()
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := shell.Serve(os.Args[2:]); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		return
+	}
+
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	command := flag.String("c", "", "run this command line and exit")
+	var cfg shell.Config
+	flag.BoolVar(&cfg.Login, "login", false, "run as a login shell, reading ~/.gosh_profile")
+	flag.BoolVar(&cfg.Login, "l", false, "same as --login")
+	flag.BoolVar(&cfg.Interactive, "i", false, "run interactively")
+	flag.BoolVar(&cfg.NoRC, "norc", false, "don't read ~/.goshrc")
+	flag.StringVar(&cfg.RCFile, "rcfile", "", "read this file instead of ~/.goshrc")
+	flag.StringVar(&cfg.ProfileDir, "profile", "", "write CPU and heap profiles of the session to this directory")
+	logSession := flag.Bool("log", false, "log the session output to a file in ~/.gosh_logs")
+	logDir := flag.String("log-dir", "", "directory of the session logs")
+	logInput := flag.Bool("log-input", false, "with --log, also log the input")
+	logStripANSI := flag.Bool("log-strip-ansi", false, "with --log, log plain text without terminal escape sequences")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("gosh version", buildVersion())
+		return
+	}
+	// login(1) and sshd mark login shells with a leading dash in argv[0]
+	if strings.HasPrefix(os.Args[0], "-") {
+		cfg.Login = true
+	}
+
+	if *logSession {
+		status, err := shell.RunLogged(shell.SessionLog{Dir: *logDir, Input: *logInput, StripANSI: *logStripANSI, Shell: cfg})
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}
+		os.Exit(status)
+	}
+
+	sh, err := shell.NewShell(shell.WithConfig(cfg))
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 		os.Exit(1)
 	}
 
+	// gosh -c 'command' [arg0 args...]
+	if isFlagSet("c") {
+		os.Exit(sh.RunString(*command, flag.Args()))
+	}
+	// gosh script.sh [args...]
+	if flag.NArg() > 0 {
+		os.Exit(sh.RunScript(flag.Arg(0), flag.Args()[1:]))
+	}
+	// echo ls | gosh
+	if !cfg.Interactive && !term.IsTerminal(int(os.Stdin.Fd())) {
+		os.Exit(sh.RunStdin())
+	}
+
 	ctx := context.TODO()
-	sh.Start(ctx)
+	status, _ := sh.Run(ctx)
+	os.Exit(status)
+}
+
+// isFlagSet reports whether the flag called name is on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
 }
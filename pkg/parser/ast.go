@@ -0,0 +1,460 @@
+// Package parser parses gosh command lines into a syntax tree, which the
+// shell then expands and runs.
+//
+// The grammar is a subset of the POSIX shell one: statements, separated by
+// newlines, semicolons or &, made of pipelines chained with && and ||. The
+// pipelines are made of simple commands, each with its variable assignments,
+// arguments and redirections, of if, case and { ...; } compound commands,
+// and of function definitions. Words may be quoted with '...' and "...",
+// hold backslash escapes, refer to variables with $NAME and ${NAME}, have
+// $(...) command substitutions, and ~ and {a,b} expansions.
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Positions are byte offsets in the parsed input.
+
+// A List is a sequence of statements, run one after the other.
+type List struct {
+	Stmts []*Stmt
+}
+
+// A Stmt is a statement of a list: a pipeline, followed by the ones chained
+// to it with && and ||. A statement ended by & runs in the background.
+type Stmt struct {
+	Pos        int
+	Line       int // the line Pos is on, counted from 1
+	Pipeline   *Pipeline
+	AndOr      []*AndOr
+	Background bool
+}
+
+// An AndOr is a pipeline chained to the ones before it in a statement. With
+// &&, it runs only if the last one that ran succeeded; with ||, only if it
+// failed.
+type AndOr struct {
+	Pos      int
+	Op       string
+	Pipeline *Pipeline
+}
+
+// A Pipeline is a sequence of commands connected by pipes, each one reading
+// the output of the one before it. A single command is a pipeline too.
+type Pipeline struct {
+	Pos  int
+	Cmds []Command
+	// PipeStderr tells, for each command but the last, whether the pipe that
+	// follows it is |&, which sends its stderr down the pipe as well.
+	PipeStderr []bool
+}
+
+// A Command is a stage of a pipeline: a SimpleCommand, a compound command,
+// IfClause, CaseClause or BraceGroup, or a FuncDecl.
+type Command interface {
+	String() string
+	command()
+}
+
+// A SimpleCommand is a command name and its arguments, run with the
+// assignments ahead of it applied and its redirections. Any of them may be
+// missing, as in a line of assignments.
+type SimpleCommand struct {
+	Pos     int
+	Assigns []*Assign
+	Args    []*Word
+	Redirs  []*Redirect
+}
+
+// An IfClause is if COND; then THEN; fi, with elif and else clauses maybe.
+// The Then list of the first condition whose status is 0 runs, or else the
+// Else one.
+type IfClause struct {
+	Pos   int
+	Cond  *List
+	Then  *List
+	Elifs []*Elif
+	Else  *List
+}
+
+// An Elif is an elif COND; then THEN clause of an IfClause.
+type Elif struct {
+	Pos  int
+	Cond *List
+	Then *List
+}
+
+// A CaseClause is case WORD in PATTERN) LIST;; ... esac. The list of the
+// first item with a pattern matching the word runs.
+type CaseClause struct {
+	Pos   int
+	Word  *Word
+	Items []*CaseItem
+}
+
+// A CaseItem is an item of a CaseClause, PATTERN | PATTERN ...) LIST;;.
+type CaseItem struct {
+	Pos      int
+	Patterns []*Word
+	List     *List
+}
+
+// A BraceGroup is { LIST; }, which runs the list as one command.
+type BraceGroup struct {
+	Pos  int
+	List *List
+}
+
+// A FuncDecl is NAME() BODY, which defines the function NAME: a command
+// that runs BODY, a compound command, with its arguments as the positional
+// parameters.
+type FuncDecl struct {
+	Pos  int
+	Name string
+	Body Command
+}
+
+// An Assign is a NAME=value word ahead of the command name.
+type Assign struct {
+	Pos   int
+	Name  string
+	Value *Word
+}
+
+// A Redirect is an I/O redirection of file descriptor N: < file, > file, >>
+// file, >| file, which overwrites the file even with noclobber, <&FD and >&FD,
+// which make N a copy of FD, or &> file and &>> file, which redirect both
+// stdout and stderr. N is written before the operator, as in 2>&1, and
+// defaults to 0 for < and <&, and to 1 for the others.
+type Redirect struct {
+	Pos    int
+	N      int
+	Op     string
+	Target *Word
+}
+
+// A Word is a shell word, the concatenation of its parts.
+type Word struct {
+	Pos   int
+	Parts []WordPart
+}
+
+// A WordPart is one of Lit, Escaped, SglQuoted, DblQuoted, ParamExp,
+// CmdSubst, TildeExp and BraceExp.
+type WordPart interface {
+	wordPart()
+}
+
+// Lit is unquoted text.
+type Lit struct {
+	Value string
+}
+
+// Escaped is unquoted text escaped with backslashes, as in \*, without them.
+// Like quoted text, it is taken literally.
+type Escaped struct {
+	Value string
+}
+
+// SglQuoted is a '...' string, taken literally.
+type SglQuoted struct {
+	Value string
+}
+
+// DblQuoted is a "..." string, in which parameters are expanded. Its parts
+// are Lit and ParamExp.
+type DblQuoted struct {
+	Parts []WordPart
+}
+
+// ParamExp is a reference to a variable, $NAME or ${NAME}, or to a special
+// or positional parameter such as $? or $1. In ${NAME:-word} and the like, Op is the operator
+// and Word the word after it.
+type ParamExp struct {
+	Name   string
+	Braces bool
+	Op     string
+	Word   *Word
+}
+
+// CmdSubst is a command substitution, $(list) or `list`, which expands to
+// the output of the commands.
+type CmdSubst struct {
+	List       *List
+	Backquoted bool
+}
+
+// TildeExp is a ~ at the start of a word, or after the = or a colon of an
+// assignment, that stands for the home directory of User, or of the current
+// user when User is "".
+type TildeExp struct {
+	User string
+}
+
+// BraceExp is a brace expansion, which makes a word of each of its Elems,
+// as in {a,b,c}, with the rest of the word around them. A sequence, as in
+// {1..10} or {a..e}, has no Elems but the ends From and To, and the Step
+// when it is given, as in {0..100..10}.
+type BraceExp struct {
+	Elems    []*Word
+	From, To string
+	Step     int
+}
+
+func (*SimpleCommand) command() {}
+func (*IfClause) command()      {}
+func (*CaseClause) command()    {}
+func (*BraceGroup) command()    {}
+func (*FuncDecl) command()      {}
+
+func (*Lit) wordPart()       {}
+func (*Escaped) wordPart()   {}
+func (*SglQuoted) wordPart() {}
+func (*DblQuoted) wordPart() {}
+func (*ParamExp) wordPart()  {}
+func (*CmdSubst) wordPart()  {}
+func (*TildeExp) wordPart()  {}
+func (*BraceExp) wordPart()  {}
+
+// String returns the list in a form that parses back to it.
+func (l *List) String() string {
+	var b strings.Builder
+	for i, stmt := range l.Stmts {
+		if i > 0 {
+			if l.Stmts[i-1].Background {
+				b.WriteString(" ")
+			} else {
+				b.WriteString("; ")
+			}
+		}
+		b.WriteString(stmt.String())
+	}
+	return b.String()
+}
+
+// String returns the statement in a form that parses back to it.
+func (s *Stmt) String() string {
+	var b strings.Builder
+	b.WriteString(s.Pipeline.String())
+	for _, next := range s.AndOr {
+		b.WriteString(" " + next.Op + " " + next.Pipeline.String())
+	}
+	if s.Background {
+		b.WriteString(" &")
+	}
+	return b.String()
+}
+
+// String returns the pipeline in a form that parses back to it.
+func (p *Pipeline) String() string {
+	var b strings.Builder
+	for i, cmd := range p.Cmds {
+		switch {
+		case i == 0:
+		case p.PipeStderr[i-1]:
+			b.WriteString(" |& ")
+		default:
+			b.WriteString(" | ")
+		}
+		b.WriteString(cmd.String())
+	}
+	return b.String()
+}
+
+// String returns the command in a form that parses back to it.
+func (c *SimpleCommand) String() string {
+	var words []string
+	for _, assign := range c.Assigns {
+		words = append(words, assign.Name+"="+assign.Value.String())
+	}
+	for _, arg := range c.Args {
+		words = append(words, arg.String())
+	}
+	for _, redir := range c.Redirs {
+		words = append(words, redir.String())
+	}
+	return strings.Join(words, " ")
+}
+
+// String returns the if clause in a form that parses back to it.
+func (c *IfClause) String() string {
+	var b strings.Builder
+	b.WriteString("if " + c.Cond.clause() + " then " + c.Then.clause())
+	for _, elif := range c.Elifs {
+		b.WriteString(" elif " + elif.Cond.clause() + " then " + elif.Then.clause())
+	}
+	if c.Else != nil {
+		b.WriteString(" else " + c.Else.clause())
+	}
+	b.WriteString(" fi")
+	return b.String()
+}
+
+// String returns the case clause in a form that parses back to it.
+func (c *CaseClause) String() string {
+	var b strings.Builder
+	b.WriteString("case " + c.Word.String() + " in")
+	for _, item := range c.Items {
+		patterns := make([]string, len(item.Patterns))
+		for i, pattern := range item.Patterns {
+			patterns[i] = pattern.String()
+		}
+		b.WriteString(" " + strings.Join(patterns, " | ") + ")")
+		if len(item.List.Stmts) > 0 {
+			b.WriteString(" " + item.List.String())
+		}
+		b.WriteString(" ;;")
+	}
+	b.WriteString(" esac")
+	return b.String()
+}
+
+// String returns the group in a form that parses back to it.
+func (g *BraceGroup) String() string {
+	return "{ " + g.List.clause() + " }"
+}
+
+// String returns the definition in a form that parses back to it.
+func (d *FuncDecl) String() string {
+	return d.Name + "() " + d.Body.String()
+}
+
+// clause returns the list as the body of a compound command, ended by a ;
+// unless its last statement ends with &.
+func (l *List) clause() string {
+	if n := len(l.Stmts); n > 0 && l.Stmts[n-1].Background {
+		return l.String()
+	}
+	return l.String() + ";"
+}
+
+// String returns the redirection in a form that parses back to it, with its
+// file descriptor only when it isn't the default one.
+func (r *Redirect) String() string {
+	fd := ""
+	if r.N != 0 && r.Op[0] == '<' || r.N != 1 && r.Op[0] != '<' {
+		fd = strconv.Itoa(r.N)
+	}
+	if strings.HasSuffix(r.Op, "&") {
+		return fd + r.Op + r.Target.String()
+	}
+	return fd + r.Op + " " + r.Target.String()
+}
+
+// Lit returns the text of the word if it is made of unquoted text only.
+func (w *Word) Lit() (string, bool) {
+	var b strings.Builder
+	for _, part := range w.Parts {
+		lit, ok := part.(*Lit)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(lit.Value)
+	}
+	return b.String(), true
+}
+
+// String returns the word in a form that parses back to it.
+func (w *Word) String() string {
+	var b strings.Builder
+	writeParts(&b, w.Parts, litSpecial)
+	return b.String()
+}
+
+// The characters escaped with a backslash in unquoted text, and in text
+// between double quotes.
+const (
+	litSpecial       = " \t\n\\'\"$`;&|<>()#~"
+	dblQuotedSpecial = "\\\"$`"
+)
+
+// writeParts writes parts, escaping the characters of special in their
+// text.
+func writeParts(b *strings.Builder, parts []WordPart, special string) {
+	for i, part := range parts {
+		switch part := part.(type) {
+		case *Lit:
+			for _, r := range part.Value {
+				if strings.ContainsRune(special, r) {
+					b.WriteByte('\\')
+				}
+				b.WriteRune(r)
+			}
+		case *Escaped:
+			for _, r := range part.Value {
+				b.WriteByte('\\')
+				b.WriteRune(r)
+			}
+		case *SglQuoted:
+			b.WriteString("'" + part.Value + "'")
+		case *CmdSubst:
+			// `list` too, which needs no escaping that way
+			b.WriteString("$(" + part.List.String() + ")")
+		case *TildeExp:
+			b.WriteString("~" + part.User)
+		case *BraceExp:
+			b.WriteString(part.String())
+		case *DblQuoted:
+			b.WriteByte('"')
+			writeParts(b, part.Parts, dblQuotedSpecial)
+			b.WriteByte('"')
+		case *ParamExp:
+			// $a followed by b would read as $ab
+			next, _ := partAt(parts, i+1).(*Lit)
+			switch {
+			case part.Op != "":
+				b.WriteString("${" + part.Name + part.Op)
+				// the word ends at the first } that isn't escaped
+				writeParts(b, part.Word.Parts, special+"}")
+				b.WriteByte('}')
+			case part.Braces || len(part.Name) > 1 && isDigit(part.Name[0]) || next != nil && next.Value != "" && isNameChar(next.Value[0]):
+				b.WriteString("${" + part.Name + "}")
+			default:
+				b.WriteString("$" + part.Name)
+			}
+		}
+	}
+}
+
+// String returns the brace expansion in a form that parses back to it.
+func (e *BraceExp) String() string {
+	if e.Elems == nil {
+		if e.Step != 0 {
+			return fmt.Sprintf("{%s..%s..%d}", e.From, e.To, e.Step)
+		}
+		return "{" + e.From + ".." + e.To + "}"
+	}
+	var b strings.Builder
+	for i, elem := range e.Elems {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		writeParts(&b, elem.Parts, litSpecial+",}")
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Quoted reports whether the word has quoted parts, which make it a word
+// even when it expands to nothing.
+func (w *Word) Quoted() bool {
+	for _, part := range w.Parts {
+		switch part.(type) {
+		case *Escaped, *SglQuoted, *DblQuoted:
+			return true
+		}
+	}
+	return false
+}
+
+func partAt(parts []WordPart, i int) WordPart {
+	if i >= 0 && i < len(parts) {
+		return parts[i]
+	}
+	return nil
+}
@@ -0,0 +1,1117 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Error is a syntax error, at byte offset Pos of the input.
+type Error struct {
+	Msg string
+	Pos int
+	// Incomplete is set when the input ends in the middle of a command, as
+	// in an unterminated quote or after a pipe: more lines can complete it.
+	Incomplete bool
+}
+
+func (e *Error) Error() string {
+	return "syntax error: " + e.Msg
+}
+
+// redirectOps are the redirection operators, longest first.
+var redirectOps = []string{"&>>", "&>", ">|", ">>", ">&", ">", "<&", "<"}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokWord
+	tokSeparator
+	tokAndOr
+	tokPipe
+	tokRedirect
+	tokParen
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	op   string // the text of operators
+	n    int    // the file descriptor a redirection is for
+	word *Word
+}
+
+// text describes the token in error messages.
+func (t token) text() string {
+	switch t.kind {
+	case tokEOF, tokNewline:
+		return "newline"
+	case tokWord:
+		return t.word.String()
+	}
+	return t.op
+}
+
+type parser struct {
+	src      string
+	pos      int
+	tok      token
+	aliases  map[string]string
+	aliasing []aliasExpansion
+	// the offsets of the { found not to start a brace expansion, which
+	// aren't scanned again when the { of a brace around them isn't either
+	notBraces map[int]bool
+	// the line byte offset lineOffset of the source is on
+	line       int
+	lineOffset int
+}
+
+// aliasExpansion is the text an alias was replaced with, which ends at byte
+// offset end of the source.
+type aliasExpansion struct {
+	name string
+	end  int
+}
+
+// Parse parses input, a command line or a whole script.
+func Parse(input string) (*List, error) {
+	return ParseAliases(input, nil)
+}
+
+// ParseAliases parses input like Parse, replacing the first word of the
+// simple commands with the text of the alias it is in aliases, when it is
+// unquoted and has no expansions. The text can be several commands, as in
+// `cd /tmp && ls`, and its own first word is replaced too, unless it is an
+// alias that is already being expanded, as in `alias ls='ls -F'`. The
+// positions of syntax errors are in the text with the aliases replaced.
+func ParseAliases(input string, aliases map[string]string) (*List, error) {
+	return ParseAliasesAt(input, aliases, 1)
+}
+
+// ParseAliasesAt parses input like ParseAliases, input starting on line
+// line of a script: the lines of the statements are counted from it.
+func ParseAliasesAt(input string, aliases map[string]string, line int) (*List, error) {
+	p := &parser{src: input, aliases: aliases, line: line}
+	return p.parse()
+}
+
+// lineAt returns the line byte offset pos of the source is on. The lines are
+// counted from the offset asked for last, since the parser mostly moves
+// forward.
+func (p *parser) lineAt(pos int) int {
+	if pos < p.lineOffset {
+		p.line -= strings.Count(p.src[pos:p.lineOffset], "\n")
+	} else {
+		p.line += strings.Count(p.src[p.lineOffset:pos], "\n")
+	}
+	p.lineOffset = pos
+	return p.line
+}
+
+func (p *parser) parse() (*List, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	list, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s'", p.tok.text()), Pos: p.tok.pos}
+	}
+	return list, nil
+}
+
+// list parses statements up to the end of the input, the ) ending a command
+// substitution, the ;; ending a case item, or one of the reserved words
+// stops, as the then that ends the condition of an if.
+func (p *parser) list(stops ...string) (*List, error) {
+	list := &List{}
+	for {
+		for p.tok.kind == tokNewline {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok.kind == tokEOF || p.tok.kind == tokParen && p.tok.op == ")" || p.tok.op == ";;" || p.isReserved(stops...) {
+			return list, nil
+		}
+		stmt, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		list.Stmts = append(list.Stmts, stmt)
+		if p.tok.kind == tokSeparator && p.tok.op != ";;" {
+			stmt.Background = p.tok.op == "&"
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// stmt parses pipelines chained with && and ||.
+func (p *parser) stmt() (*Stmt, error) {
+	// before an alias replaces the first word
+	line := p.lineAt(p.tok.pos)
+	pipeline, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &Stmt{Pos: pipeline.Pos, Line: line, Pipeline: pipeline}
+	for p.tok.kind == tokAndOr {
+		op := p.tok
+		if err := p.afterOperator(op); err != nil {
+			return nil, err
+		}
+		pipeline, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		stmt.AndOr = append(stmt.AndOr, &AndOr{Pos: op.pos, Op: op.op, Pipeline: pipeline})
+	}
+	return stmt, nil
+}
+
+func (p *parser) pipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{Pos: p.tok.pos}
+	for {
+		cmd, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		if cmd == nil {
+			return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s'", p.tok.text()), Pos: p.tok.pos}
+		}
+		pipeline.Cmds = append(pipeline.Cmds, cmd)
+		if p.tok.kind != tokPipe {
+			return pipeline, nil
+		}
+
+		pipeline.PipeStderr = append(pipeline.PipeStderr, p.tok.op == "|&")
+		if err := p.afterOperator(p.tok); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// afterOperator scans the token after op, a pipe, && or ||. The command that
+// follows them may be on the next line, but there must be one.
+func (p *parser) afterOperator(op token) error {
+	for {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.tok.kind != tokNewline {
+			break
+		}
+	}
+	if p.tok.kind == tokEOF {
+		return &Error{Msg: fmt.Sprintf("missing command after `%s'", op.op), Pos: op.pos, Incomplete: true}
+	}
+	return nil
+}
+
+// reservedWords start and end compound commands, when they are the first
+// word of a command.
+var reservedWords = []string{"if", "then", "elif", "else", "fi", "case", "esac", "{", "}"}
+
+// isReserved reports whether p.tok is one of the reserved words, unquoted.
+func (p *parser) isReserved(words ...string) bool {
+	if p.tok.kind != tokWord {
+		return false
+	}
+	lit, ok := p.tok.word.Lit()
+	return ok && slices.Contains(words, lit)
+}
+
+// command parses a pipeline stage: a compound command, or a simple command.
+// It returns nil when there is nothing before the operator or newline where
+// one should start.
+func (p *parser) command() (Command, error) {
+	var cmd Command
+	var err error
+	switch {
+	case p.isReserved("if"):
+		cmd, err = p.ifClause()
+	case p.isReserved("case"):
+		cmd, err = p.caseClause()
+	case p.isReserved("{"):
+		cmd, err = p.braceGroup()
+	case p.isReserved(reservedWords...):
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s'", p.tok.text()), Pos: p.tok.pos}
+	default:
+		simple, err := p.simpleCommand()
+		if simple == nil {
+			return nil, err
+		}
+		if p.tok.kind == tokParen && p.tok.op == "(" && len(simple.Args) == 1 && len(simple.Assigns) == 0 && len(simple.Redirs) == 0 {
+			return p.funcDecl(simple.Args[0])
+		}
+		return simple, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a compound command ends at an operator or a newline
+	if p.tok.kind == tokWord || p.tok.kind == tokRedirect {
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s'", p.tok.text()), Pos: p.tok.pos}
+	}
+	return cmd, nil
+}
+
+// ifClause parses if LIST; then LIST; [elif LIST; then LIST;]... [else
+// LIST;] fi.
+func (p *parser) ifClause() (*IfClause, error) {
+	clause := &IfClause{Pos: p.tok.pos}
+	var err error
+	if clause.Cond, err = p.compoundList("then"); err != nil {
+		return nil, err
+	}
+	if clause.Then, err = p.compoundList("elif", "else", "fi"); err != nil {
+		return nil, err
+	}
+	for p.isReserved("elif") {
+		elif := &Elif{Pos: p.tok.pos}
+		if elif.Cond, err = p.compoundList("then"); err != nil {
+			return nil, err
+		}
+		if elif.Then, err = p.compoundList("elif", "else", "fi"); err != nil {
+			return nil, err
+		}
+		clause.Elifs = append(clause.Elifs, elif)
+	}
+	if p.isReserved("else") {
+		if clause.Else, err = p.compoundList("fi"); err != nil {
+			return nil, err
+		}
+	}
+	return clause, p.next()
+}
+
+// braceGroup parses { LIST; }.
+func (p *parser) braceGroup() (*BraceGroup, error) {
+	group := &BraceGroup{Pos: p.tok.pos}
+	var err error
+	if group.List, err = p.compoundList("}"); err != nil {
+		return nil, err
+	}
+	return group, p.next()
+}
+
+// funcDecl parses the definition of the function called name, from the ( in
+// p.tok: NAME() BODY, where BODY is a compound command, usually a { LIST; }
+// group, that can start on the next lines.
+func (p *parser) funcDecl(name *Word) (*FuncDecl, error) {
+	lit, ok := name.Lit()
+	if !ok {
+		return nil, &Error{Msg: fmt.Sprintf("invalid function name `%s'", name.String()), Pos: name.Pos}
+	}
+	decl := &FuncDecl{Pos: name.Pos, Name: lit}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokParen || p.tok.op != ")" {
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s', expected `)' after `%s('", p.tok.text(), lit), Pos: p.tok.pos}
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.tok.kind == tokEOF:
+		return nil, &Error{Msg: fmt.Sprintf("missing the body of `%s()'", lit), Pos: decl.Pos, Incomplete: true}
+	case !p.isReserved("{", "if", "case"):
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s', expected the body of `%s()'", p.tok.text(), lit), Pos: p.tok.pos}
+	}
+	var err error
+	if decl.Body, err = p.command(); err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+// caseClause parses case WORD in [(]PATTERN [| PATTERN]...) LIST;; ...
+// esac, where the ;; of the last item can be left out.
+func (p *parser) caseClause() (*CaseClause, error) {
+	clause := &CaseClause{Pos: p.tok.pos}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokWord {
+		return nil, p.caseError(clause.Pos, "a word after `case'")
+	}
+	clause.Word = p.tok.word
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	if !p.isReserved("in") {
+		return nil, p.caseError(clause.Pos, "`in'")
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	for !p.isReserved("esac") {
+		item, err := p.caseItem(clause.Pos)
+		if err != nil {
+			return nil, err
+		}
+		clause.Items = append(clause.Items, item)
+	}
+	return clause, p.next()
+}
+
+// caseItem parses an item of the case clause at pos, up to the token after
+// its ;; and the newlines that follow, or the esac ending the clause.
+func (p *parser) caseItem(pos int) (*CaseItem, error) {
+	item := &CaseItem{Pos: p.tok.pos}
+	if p.tok.kind == tokParen && p.tok.op == "(" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if p.tok.kind != tokWord {
+			return nil, p.caseError(pos, "a pattern")
+		}
+		item.Patterns = append(item.Patterns, p.tok.word)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokPipe || p.tok.op != "|" {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tok.kind != tokParen || p.tok.op != ")" {
+		return nil, p.caseError(pos, "`)' after the patterns")
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var err error
+	if item.List, err = p.list("esac"); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.tok.op == ";;":
+		return item, p.skipNewlines()
+	case p.isReserved("esac"):
+		return item, nil
+	}
+	return nil, p.caseError(pos, "`;;' or `esac'")
+}
+
+// skipNewlines scans the token after p.tok that isn't a newline.
+func (p *parser) skipNewlines() error {
+	for {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.tok.kind != tokNewline {
+			return nil
+		}
+	}
+}
+
+// caseError returns the error for p.tok when expected should be there, in
+// the compound command at pos, which is incomplete at the end of the input.
+func (p *parser) caseError(pos int, expected string) error {
+	if p.tok.kind == tokEOF {
+		return &Error{Msg: "missing `esac'", Pos: pos, Incomplete: true}
+	}
+	return &Error{Msg: fmt.Sprintf("unexpected token `%s', expected %s", p.tok.text(), expected), Pos: p.tok.pos}
+}
+
+// compoundList parses the list after the reserved word in p.tok, which one
+// of the reserved words ends must end, as then ends the condition of an if.
+// The list can't be empty.
+func (p *parser) compoundList(ends ...string) (*List, error) {
+	word := p.tok
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	list, err := p.list(ends...)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.tok.kind == tokEOF:
+		return nil, &Error{Msg: fmt.Sprintf("missing `%s' after `%s'", ends[len(ends)-1], word.text()), Pos: word.pos, Incomplete: true}
+	case len(list.Stmts) == 0 || !p.isReserved(ends...):
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s'", p.tok.text()), Pos: p.tok.pos}
+	}
+	return list, nil
+}
+
+// simpleCommand parses a command up to the operator or the newline ending it.
+// It returns nil when there is nothing before them.
+func (p *parser) simpleCommand() (*SimpleCommand, error) {
+	cmd := &SimpleCommand{Pos: p.tok.pos}
+	for {
+		switch p.tok.kind {
+		case tokWord:
+			if assign := assignment(p.tok.word); assign != nil && len(cmd.Args) == 0 {
+				cmd.Assigns = append(cmd.Assigns, assign)
+				break
+			}
+			if len(cmd.Args) == 0 {
+				expanded, err := p.expandAlias()
+				if err != nil {
+					return nil, err
+				}
+				if expanded {
+					// scan the text of the alias instead
+					continue
+				}
+			}
+			cmd.Args = append(cmd.Args, p.tok.word)
+		case tokRedirect:
+			op := p.tok
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			switch p.tok.kind {
+			case tokWord:
+			case tokEOF, tokNewline:
+				return nil, &Error{Msg: fmt.Sprintf("missing file after `%s'", op.op), Pos: op.pos}
+			default:
+				return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s', expected a file after `%s'", p.tok.text(), op.op), Pos: p.tok.pos}
+			}
+			cmd.Redirs = append(cmd.Redirs, &Redirect{Pos: op.pos, N: op.n, Op: op.op, Target: p.tok.word})
+		default:
+			if len(cmd.Assigns) == 0 && len(cmd.Args) == 0 && len(cmd.Redirs) == 0 {
+				return nil, nil
+			}
+			return cmd, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// expandAlias replaces the word in p.tok with the text of the alias it is,
+// if any, and scans the token the text starts with.
+func (p *parser) expandAlias() (bool, error) {
+	w := p.tok.word
+	lit, ok := w.Parts[0].(*Lit)
+	if !ok || len(w.Parts) > 1 {
+		return false, nil
+	}
+	text, ok := p.aliases[lit.Value]
+	if !ok {
+		return false, nil
+	}
+	// forget the expansions the word is after
+	active := p.aliasing[:0]
+	for _, a := range p.aliasing {
+		if a.end > p.tok.pos {
+			active = append(active, a)
+		}
+	}
+	p.aliasing = active
+	for _, a := range p.aliasing {
+		if a.name == lit.Value {
+			return false, nil
+		}
+	}
+
+	for i := range p.aliasing {
+		p.aliasing[i].end += len(text) - (p.pos - p.tok.pos)
+	}
+	p.src = p.src[:p.tok.pos] + text + p.src[p.pos:]
+	p.notBraces = nil
+	// the commands of the text are on the line of the alias
+	p.line -= strings.Count(text, "\n")
+	p.aliasing = append(p.aliasing, aliasExpansion{lit.Value, p.tok.pos + len(text)})
+	p.pos = p.tok.pos
+	return true, p.next()
+}
+
+// assignment returns the assignment w is, when it starts with an unquoted
+// NAME=.
+func assignment(w *Word) *Assign {
+	lit, ok := w.Parts[0].(*Lit)
+	if !ok {
+		return nil
+	}
+	name, value, ok := strings.Cut(lit.Value, "=")
+	if !ok || !isName(name) {
+		return nil
+	}
+	assign := &Assign{Pos: w.Pos, Name: name, Value: &Word{Pos: w.Pos + len(name) + 1}}
+	if value != "" {
+		assign.Value.Parts = append(assign.Value.Parts, &Lit{Value: value})
+	}
+	assign.Value.Parts = append(assign.Value.Parts, w.Parts[1:]...)
+	return assign
+}
+
+// next scans the token at p.pos into p.tok.
+func (p *parser) next() error {
+	p.skipBlanks()
+	p.tok = token{pos: p.pos}
+	if p.pos == len(p.src) {
+		p.tok.kind = tokEOF
+		return nil
+	}
+	switch c := p.src[p.pos]; c {
+	case '\n':
+		p.tok.kind = tokNewline
+		p.pos++
+	case ';':
+		p.tok.kind, p.tok.op = tokSeparator, ";"
+		if strings.HasPrefix(p.src[p.pos:], ";;") {
+			p.tok.op = ";;"
+		}
+		p.pos += len(p.tok.op)
+	case '|':
+		p.tok.kind, p.tok.op = tokPipe, "|"
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "||"):
+			p.tok.kind, p.tok.op = tokAndOr, "||"
+		case strings.HasPrefix(p.src[p.pos:], "|&"):
+			p.tok.op = "|&"
+		}
+		p.pos += len(p.tok.op)
+	case '<', '>':
+		p.redirect(-1)
+	case '(', ')':
+		p.tok.kind, p.tok.op = tokParen, string(c)
+		p.pos++
+	case '&':
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "&&"):
+			p.tok.kind, p.tok.op = tokAndOr, "&&"
+			p.pos += 2
+		case strings.HasPrefix(p.src[p.pos:], "&>"):
+			p.redirect(-1)
+		default:
+			p.tok.kind, p.tok.op = tokSeparator, "&"
+			p.pos++
+		}
+	default:
+		// a number right before < or > is the file descriptor redirected
+		n := 0
+		for p.pos+n < len(p.src) && p.src[p.pos+n] >= '0' && p.src[p.pos+n] <= '9' {
+			n++
+		}
+		if n > 0 && p.pos+n < len(p.src) && (p.src[p.pos+n] == '<' || p.src[p.pos+n] == '>') {
+			if fd, err := strconv.Atoi(p.src[p.pos : p.pos+n]); err == nil {
+				p.pos += n
+				p.redirect(fd)
+				return nil
+			}
+		}
+		// command substitutions in the word scan tokens of their own
+		pos := p.tok.pos
+		word, err := p.word()
+		if err != nil {
+			return err
+		}
+		p.tok = token{kind: tokWord, pos: pos, word: word}
+	}
+	return nil
+}
+
+// redirect scans the redirection operator at p.pos into p.tok. fd is the
+// file descriptor written before it, or -1 for the default one: 0 for <, and
+// 1 for the others.
+func (p *parser) redirect(fd int) {
+	p.tok.kind = tokRedirect
+	for _, op := range redirectOps {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			p.tok.op = op
+			break
+		}
+	}
+	p.pos += len(p.tok.op)
+	switch {
+	case fd >= 0:
+		p.tok.n = fd
+	case p.tok.op[0] == '<':
+		p.tok.n = 0
+	default:
+		p.tok.n = 1
+	}
+}
+
+// skipBlanks skips spaces, tabs, escaped newlines and comments.
+func (p *parser) skipBlanks() {
+	for p.pos < len(p.src) {
+		switch {
+		case p.src[p.pos] == ' ' || p.src[p.pos] == '\t':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "\\\n"):
+			p.pos += 2
+		case p.src[p.pos] == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// isWordEnd reports whether c ends an unquoted word.
+func isWordEnd(c byte) bool {
+	return strings.IndexByte(" \t\n;&|<>()", c) >= 0
+}
+
+// word scans a word, which has at least one character.
+func (p *parser) word() (*Word, error) {
+	w := &Word{Pos: p.pos}
+	parts, err := p.wordParts(isWordEnd)
+	if err != nil {
+		return nil, err
+	}
+	w.Parts = parts
+	return w, nil
+}
+
+// wordParts scans unquoted text, up to a byte that end accepts.
+func (p *parser) wordParts(end func(c byte) bool) ([]WordPart, error) {
+	var parts []WordPart
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, &Lit{Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	// a ~ is expanded at the start, and after the = and the colons of
+	// what looks like an assignment
+	tilde, assignLike := true, false
+	for p.pos < len(p.src) && !end(p.src[p.pos]) {
+		c := p.src[p.pos]
+		if c == '~' && tilde {
+			if exp := p.tilde(end, assignLike); exp != nil {
+				flush()
+				parts = append(parts, exp)
+				tilde = false
+				continue
+			}
+		}
+		if c == '=' && !assignLike && len(parts) == 0 && isName(lit.String()) {
+			assignLike = true
+		}
+		tilde = assignLike && (c == '=' || c == ':')
+		switch c {
+		case '\\':
+			p.pos++
+			switch {
+			case p.pos == len(p.src):
+				lit.WriteByte('\\')
+			case p.src[p.pos] == '\n':
+				// a line continuation
+				p.pos++
+			default:
+				_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+				flush()
+				if last, ok := partAt(parts, len(parts)-1).(*Escaped); ok {
+					last.Value += p.src[p.pos : p.pos+size]
+				} else {
+					parts = append(parts, &Escaped{Value: p.src[p.pos : p.pos+size]})
+				}
+				p.pos += size
+			}
+		case '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return nil, &Error{Msg: "unterminated ' quote", Pos: p.pos, Incomplete: true}
+			}
+			flush()
+			parts = append(parts, &SglQuoted{Value: p.src[p.pos+1 : p.pos+1+end]})
+			p.pos += end + 2
+		case '"':
+			quoted, err := p.dblQuoted()
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			parts = append(parts, quoted)
+		case '$':
+			exp, err := p.dollar(false)
+			if err != nil {
+				return nil, err
+			}
+			if exp != nil {
+				flush()
+				parts = append(parts, exp)
+				break
+			}
+			lit.WriteByte('$')
+			p.pos++
+		case '`':
+			subst, err := p.backquoted()
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			parts = append(parts, subst)
+		case '{':
+			brace, err := p.brace(end)
+			if err != nil {
+				return nil, err
+			}
+			if brace != nil {
+				flush()
+				parts = append(parts, brace)
+				break
+			}
+			lit.WriteByte('{')
+			p.pos++
+		default:
+			lit.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+	}
+	flush()
+	return parts, nil
+}
+
+// brace scans the brace expansion at p.pos, a {, in a word that end ends.
+// It returns nil when the { doesn't start one, without a , or a .. sequence
+// up to its }, and is just a {. Such a { is remembered, so that the text
+// after it is scanned once for the braces it has, not once more for each
+// unclosed { before it.
+func (p *parser) brace(end func(c byte) bool) (*BraceExp, error) {
+	if seq := braceSeq(p.src[p.pos:]); seq != nil {
+		p.pos += strings.IndexByte(p.src[p.pos:], '}') + 1
+		return seq, nil
+	}
+	if p.notBraces[p.pos] {
+		return nil, nil
+	}
+
+	start := p.pos
+	notBrace := func() (*BraceExp, error) {
+		if p.notBraces == nil {
+			p.notBraces = make(map[int]bool)
+		}
+		p.notBraces[start] = true
+		p.pos = start
+		return nil, nil
+	}
+	brace := &BraceExp{}
+	p.pos++
+	for {
+		elem := &Word{Pos: p.pos}
+		var err error
+		elem.Parts, err = p.wordParts(func(c byte) bool { return c == ',' || c == '}' || end(c) })
+		if err != nil {
+			return nil, err
+		}
+		brace.Elems = append(brace.Elems, elem)
+		if p.pos == len(p.src) || p.src[p.pos] != ',' && p.src[p.pos] != '}' {
+			return notBrace()
+		}
+		p.pos++
+		if p.src[p.pos-1] == '}' {
+			break
+		}
+	}
+	if len(brace.Elems) < 2 {
+		return notBrace()
+	}
+	return brace, nil
+}
+
+// braceSeq returns the {FROM..TO} or {FROM..TO..STEP} sequence src starts
+// with, of integers or of letters, or nil.
+func braceSeq(src string) *BraceExp {
+	end := strings.IndexByte(src, '}')
+	if end < 0 {
+		return nil
+	}
+	fields := strings.Split(src[1:end], "..")
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil
+	}
+	seq := &BraceExp{From: fields[0], To: fields[1]}
+	if len(fields) == 3 {
+		step, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil
+		}
+		seq.Step = step
+	}
+	_, fromErr := strconv.Atoi(seq.From)
+	_, toErr := strconv.Atoi(seq.To)
+	if fromErr == nil && toErr == nil || isSeqLetter(seq.From) && isSeqLetter(seq.To) {
+		return seq
+	}
+	return nil
+}
+
+func isSeqLetter(s string) bool {
+	return len(s) == 1 && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+// tilde scans the tilde prefix at p.pos, a ~ followed by a user name up to a
+// slash or the end of the word, or a colon in an assignment. It returns nil
+// when the name has other characters, quoted ones among them, and the ~ is
+// taken literally.
+func (p *parser) tilde(end func(c byte) bool, assignLike bool) *TildeExp {
+	n := 1
+	for ; p.pos+n < len(p.src); n++ {
+		c := p.src[p.pos+n]
+		if c == '/' || end(c) || assignLike && c == ':' {
+			break
+		}
+		if !isNameChar(c) && c != '.' && c != '-' {
+			return nil
+		}
+	}
+	exp := &TildeExp{User: p.src[p.pos+1 : p.pos+n]}
+	p.pos += n
+	return exp
+}
+
+// dblQuoted scans a "..." string.
+func (p *parser) dblQuoted() (*DblQuoted, error) {
+	start := p.pos
+	p.pos++
+	parts, err := p.dblQuotedParts('"')
+	if err != nil {
+		return nil, err
+	}
+	if p.pos == len(p.src) {
+		return nil, &Error{Msg: "unterminated \" quote", Pos: start, Incomplete: true}
+	}
+	p.pos++
+	return &DblQuoted{Parts: parts}, nil
+}
+
+// dblQuotedParts scans text quoted with "...", up to the byte end. In it, a
+// backslash only escapes $, `, ", \, newline and end.
+func (p *parser) dblQuotedParts(end byte) ([]WordPart, error) {
+	var parts []WordPart
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, &Lit{Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for p.pos < len(p.src) && p.src[p.pos] != end {
+		switch c := p.src[p.pos]; {
+		case c == '\\' && p.pos+1 < len(p.src) && (strings.IndexByte("$`\"\\\n", p.src[p.pos+1]) >= 0 || p.src[p.pos+1] == end):
+			if p.src[p.pos+1] != '\n' {
+				lit.WriteByte(p.src[p.pos+1])
+			}
+			p.pos += 2
+		case c == '"':
+			// in the word of a ${NAME:-word} that is itself quoted
+			quoted, err := p.dblQuoted()
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			parts = append(parts, quoted)
+		case c == '$':
+			exp, err := p.dollar(true)
+			if err != nil {
+				return nil, err
+			}
+			if exp != nil {
+				flush()
+				parts = append(parts, exp)
+				continue
+			}
+			lit.WriteByte('$')
+			p.pos++
+		case c == '`':
+			subst, err := p.backquoted()
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			parts = append(parts, subst)
+		default:
+			lit.WriteByte(c)
+			p.pos++
+		}
+	}
+	flush()
+	return parts, nil
+}
+
+// dollar scans the expansion at p.pos, a $: a parameter expansion or a
+// command substitution. It returns nil when the $ doesn't start one.
+func (p *parser) dollar(quoted bool) (WordPart, error) {
+	if strings.HasPrefix(p.src[p.pos:], "$(") {
+		return p.cmdSubst()
+	}
+	param, err := p.param(quoted)
+	if param == nil || err != nil {
+		return nil, err
+	}
+	return param, nil
+}
+
+// cmdSubst scans the $(...) command substitution at p.pos.
+func (p *parser) cmdSubst() (*CmdSubst, error) {
+	start := p.pos
+	p.pos += 2
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	list, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.tok.kind == tokEOF:
+		return nil, &Error{Msg: "unterminated $(", Pos: start, Incomplete: true}
+	case p.tok.kind != tokParen || p.tok.op != ")":
+		return nil, &Error{Msg: fmt.Sprintf("unexpected token `%s'", p.tok.text()), Pos: p.tok.pos}
+	}
+	return &CmdSubst{List: list}, nil
+}
+
+// backquoted scans the `...` command substitution at p.pos. In it, a
+// backslash only escapes $, ` and \.
+func (p *parser) backquoted() (*CmdSubst, error) {
+	start := p.pos
+	var src strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch c := p.src[i]; {
+		case c == '\\' && i+1 < len(p.src) && strings.IndexByte("$`\\", p.src[i+1]) >= 0:
+			i++
+			src.WriteByte(p.src[i])
+		case c == '`':
+			list, err := (&parser{src: src.String(), aliases: p.aliases, line: p.lineAt(start)}).parse()
+			if err, ok := err.(*Error); ok {
+				err.Pos += start + 1
+				err.Incomplete = false
+			}
+			if err != nil {
+				return nil, err
+			}
+			p.pos = i + 1
+			return &CmdSubst{List: list, Backquoted: true}, nil
+		default:
+			src.WriteByte(c)
+		}
+	}
+	return nil, &Error{Msg: "unterminated ` quote", Pos: start, Incomplete: true}
+}
+
+// specialParams are the parameters named by a character that can't be in a
+// variable name: $?, the exit status of the last pipeline, $!, the process
+// ID of the last background job, $$, the one of the shell, and $#, $@ and
+// $*, the number of positional parameters and all of them. The positional
+// parameters themselves are named by numbers: $1 to $9, and ${10} and up
+// in braces.
+const specialParams = "?!$#@*"
+
+// paramOps are the operators of the ${NAME<op>word} expansions, which
+// expand to word instead of the value of NAME, or assign it, depending on
+// whether NAME is set. With the colon, NAME set to "" counts as unset.
+var paramOps = []string{":-", ":=", ":+", "-", "=", "+"}
+
+// param scans the parameter expansion at p.pos, a $. It returns nil when
+// the $ doesn't start one, and is just a $. quoted tells that it is between
+// double quotes, which the word of ${NAME:-word} is in as well.
+func (p *parser) param(quoted bool) (*ParamExp, error) {
+	start := p.pos
+	rest := p.src[p.pos+1:]
+	if !strings.HasPrefix(rest, "{") {
+		name := paramName(rest, false)
+		if name == "" {
+			return nil, nil
+		}
+		p.pos += 1 + len(name)
+		return &ParamExp{Name: name}, nil
+	}
+
+	name := paramName(rest[1:], true)
+	if name == "" {
+		return nil, nil
+	}
+	after := rest[1+len(name):]
+	if strings.HasPrefix(after, "}") {
+		p.pos += 3 + len(name)
+		return &ParamExp{Name: name, Braces: true}, nil
+	}
+	param := &ParamExp{Name: name, Braces: true}
+	for _, op := range paramOps {
+		if strings.HasPrefix(after, op) {
+			param.Op = op
+			break
+		}
+	}
+	if param.Op == "" {
+		return nil, nil
+	}
+
+	p.pos += 2 + len(name) + len(param.Op)
+	param.Word = &Word{Pos: p.pos}
+	var err error
+	if quoted {
+		param.Word.Parts, err = p.dblQuotedParts('}')
+	} else {
+		param.Word.Parts, err = p.wordParts(func(c byte) bool { return c == '}' })
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.pos == len(p.src) {
+		return nil, &Error{Msg: "unterminated ${", Pos: start, Incomplete: true}
+	}
+	p.pos++
+	return param, nil
+}
+
+// paramName returns the name of the parameter at the start of s: a special
+// parameter, a digit, or all the digits in braces, or the longest variable
+// name, or "" for none of them.
+func paramName(s string, braced bool) string {
+	if s != "" && isSpecialParam(s[:1]) {
+		return s[:1]
+	}
+	if s != "" && isDigit(s[0]) {
+		n := 1
+		for braced && n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		return s[:n]
+	}
+	n := 0
+	for n < len(s) && isNameChar(s[n]) && !(n == 0 && s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	return s[:n]
+}
+
+func isSpecialParam(name string) bool {
+	return len(name) == 1 && strings.Contains(specialParams, name)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isName reports whether name is a valid variable name.
+func isName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) || i == 0 && name[i] >= '0' && name[i] <= '9' {
+			return false
+		}
+	}
+	return name != ""
+}
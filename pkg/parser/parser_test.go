@@ -0,0 +1,312 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"echo hello", "echo hello"},
+		{"  echo   a\tb  ", "echo a b"},
+		{"echo 'a b' \"c $x\" d\\ e", "echo 'a b' \"c $x\" d\\ e"},
+		{`echo "${x}y" $1 ${#}`, `echo "${x}y" $1 ${#}`},
+		{"echo a\\#b #comment", "echo a\\#b"},
+		{"x=1 y=\"a b\" cmd", "x=1 y=\"a b\" cmd"},
+		{"echo $(ls | wc -l) `pwd` ~user {a,b}", "echo $(ls | wc -l) $(pwd) ~user {a,b}"},
+		{"a|b |& c", "a | b |& c"},
+		{"a && b || c; d &", "a && b || c; d &"},
+		{"a\nb", "a; b"},
+		{"cat <in >out 2>>err 2>&1 &>all >|f", "cat < in > out 2>> err 2>&1 &> all >| f"},
+		{"2>&1 ls", "ls 2>&1"},
+		{"{ a; b; }", "{ a; b; }"},
+		{"if a; then b; elif c; then d; else e; fi", "if a; then b; elif c; then d; else e; fi"},
+		{"case $x in a|b) echo 1;; *) echo 2;; esac", "case $x in a | b) echo 1 ;; *) echo 2 ;; esac"},
+		{"f() { echo hi; }", "f() { echo hi; }"},
+		{"echo {x{a,b} {a,{b,c}}d {a,b", "echo {x{a,b} {a,{b,c}}d {a,b"},
+		{"ls **/ **/*.go b/**/", "ls **/ **/*.go b/**/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := list.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// the string parses back to the same list
+			again, err := Parse(tt.want)
+			if err != nil {
+				t.Fatalf("%q: %v", tt.want, err)
+			}
+			if got := again.String(); got != tt.want {
+				t.Errorf("parsed back: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuoting(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []WordPart
+	}{
+		{"abc", []WordPart{&Lit{"abc"}}},
+		{"'a $b'", []WordPart{&SglQuoted{"a $b"}}},
+		{`"a $b"`, []WordPart{&DblQuoted{[]WordPart{&Lit{"a "}, &ParamExp{Name: "b"}}}}},
+		{`"a \" b"`, []WordPart{&DblQuoted{[]WordPart{&Lit{`a " b`}}}}},
+		{`"it's"`, []WordPart{&DblQuoted{[]WordPart{&Lit{"it's"}}}}},
+		{`a\ b`, []WordPart{&Lit{"a"}, &Escaped{" "}, &Lit{"b"}}},
+		{`a'b'"c"`, []WordPart{&Lit{"a"}, &SglQuoted{"b"}, &DblQuoted{[]WordPart{&Lit{"c"}}}}},
+		{"${x}y", []WordPart{&ParamExp{Name: "x", Braces: true}, &Lit{"y"}}},
+		{"$1$?", []WordPart{&ParamExp{Name: "1"}, &ParamExp{Name: "?"}}},
+		{"''", []WordPart{&SglQuoted{""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			list, err := Parse("echo " + tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := list.Stmts[0].Pipeline.Cmds[0].(*SimpleCommand).Args
+			if len(args) != 2 {
+				t.Fatalf("got %d words, want 2", len(args))
+			}
+			if got := args[1].Parts; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", dump(got), dump(tt.want))
+			}
+		})
+	}
+}
+
+func TestParsePipelines(t *testing.T) {
+	tests := []struct {
+		input      string
+		commands   []string
+		pipeStderr []bool
+	}{
+		{"ls", []string{"ls"}, []bool{}},
+		{"ls -l | wc -l", []string{"ls -l", "wc -l"}, []bool{false}},
+		{"make |& tee log | grep error", []string{"make", "tee log", "grep error"}, []bool{true, false}},
+		{"a|\nb", []string{"a", "b"}, []bool{false}},
+		{"{ a; b; } | c", []string{"{ a; b; }", "c"}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list.Stmts) != 1 {
+				t.Fatalf("got %d statements, want 1", len(list.Stmts))
+			}
+			p := list.Stmts[0].Pipeline
+			var commands []string
+			for _, cmd := range p.Cmds {
+				commands = append(commands, cmd.String())
+			}
+			if !reflect.DeepEqual(commands, tt.commands) {
+				t.Errorf("got commands %q, want %q", commands, tt.commands)
+			}
+			if pipeStderr := append([]bool{}, p.PipeStderr...); !reflect.DeepEqual(pipeStderr, tt.pipeStderr) {
+				t.Errorf("got |& %v, want %v", pipeStderr, tt.pipeStderr)
+			}
+		})
+	}
+}
+
+func TestParseRedirects(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // N, Op and target of each
+	}{
+		{"cat < in", []string{"0 < in"}},
+		{"ls > out", []string{"1 > out"}},
+		{"ls >> out", []string{"1 >> out"}},
+		{"ls >| out", []string{"1 >| out"}},
+		{"ls 2> err", []string{"2 > err"}},
+		{"ls 2>>err 2>&1", []string{"2 >> err", "2 >& 1"}},
+		{"ls &> all", []string{"1 &> all"}},
+		{"ls &>> all", []string{"1 &>> all"}},
+		{"read <&3", []string{"0 <& 3"}},
+		{"ls >'my file'", []string{"1 > 'my file'"}},
+		{"> out ls", []string{"1 > out"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range list.Stmts[0].Pipeline.Cmds[0].(*SimpleCommand).Redirs {
+				got = append(got, fmt.Sprintf("%d %s %s", r.N, r.Op, r.Target))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAndOr(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // the first pipeline, then the op and pipeline of each
+	}{
+		{"a && b", []string{"a", "&& b"}},
+		{"a || b", []string{"a", "|| b"}},
+		{"a && b | c || d", []string{"a", "&& b | c", "|| d"}},
+		{"a &&\nb", []string{"a", "&& b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmt := list.Stmts[0]
+			got := []string{stmt.Pipeline.String()}
+			for _, next := range stmt.AndOr {
+				got = append(got, next.Op+" "+next.Pipeline.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		msg        string
+		pos        string // line:col, counted in bytes from 1
+		incomplete bool
+	}{
+		{"echo 'abc", "unterminated ' quote", "1:6", true},
+		{`echo "abc`, `unterminated " quote`, "1:6", true},
+		{"a |", "missing command after `|'", "1:3", true},
+		{"a &&", "missing command after `&&'", "1:3", true},
+		{"| a", "unexpected token `|'", "1:1", false},
+		{"a && && b", "unexpected token `&&'", "1:6", false},
+		{"a ;; b", "unexpected token `;;'", "1:3", false},
+		{"ls >", "missing file after `>'", "1:4", false},
+		{"echo (", "unexpected token `newline', expected `)' after `echo('", "1:7", false},
+		{"echo ok\nfi", "unexpected token `fi'", "2:1", false},
+		{"if true; then\n  echo )\nfi", "unexpected token `)'", "2:8", false},
+		// here-documents and here-strings aren't supported
+		{"cat <<EOF\nhi\nEOF", "unexpected token `<', expected a file after `<'", "1:6", false},
+		{"cat <<<hi", "unexpected token `<', expected a file after `<'", "1:6", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var syntaxErr *Error
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got %v, want a syntax error", err)
+			}
+			if syntaxErr.Msg != tt.msg {
+				t.Errorf("got message %q, want %q", syntaxErr.Msg, tt.msg)
+			}
+			if got := lineCol(tt.input, syntaxErr.Pos); got != tt.pos {
+				t.Errorf("got position %s, want %s", got, tt.pos)
+			}
+			if syntaxErr.Incomplete != tt.incomplete {
+				t.Errorf("got incomplete %v, want %v", syntaxErr.Incomplete, tt.incomplete)
+			}
+		})
+	}
+}
+
+// lineCol returns byte offset pos of input as line:col.
+func lineCol(input string, pos int) string {
+	line := strings.Count(input[:pos], "\n") + 1
+	col := pos - strings.LastIndexByte(input[:pos], '\n')
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+// dump returns the parts of a word in a readable form.
+func dump(parts []WordPart) string {
+	s := make([]string, len(parts))
+	for i, part := range parts {
+		s[i] = fmt.Sprintf("%T%+v", part, part)
+	}
+	return strings.Join(s, " ")
+}
+
+// Unclosed braces used to be scanned again for each { before them, which
+// took twice as long for each one more.
+func TestParseUnclosedBraces(t *testing.T) {
+	input := "echo " + strings.Repeat("{", 64) + "a,b"
+	list, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := list.Stmts[0].Pipeline.Cmds[0].(*SimpleCommand).Args
+	if got, want := args[1].String(), strings.Repeat(`{`, 64)+"a,b"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	input := "a\n\nb; c\nif d\nthen\n  e\nfi\nf \\\ng"
+	list, err := ParseAliasesAt(input, map[string]string{"b": "x\ny"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, stmt := range list.Stmts {
+		got = append(got, stmt.Line)
+	}
+	inner := list.Stmts[len(list.Stmts)-2].Pipeline.Cmds[0].(*IfClause).Then.Stmts[0]
+	got = append(got, inner.Line)
+	// an alias counts as the line it is on
+	if want := []int{10, 12, 12, 12, 13, 17, 15}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got lines %v, want %v", got, want)
+	}
+}
+
+func TestParseBraces(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // the type and text of each part
+	}{
+		{"{a,b}", []string{"BraceExp {a,b}"}},
+		{"{1..3}", []string{"BraceExp {1..3}"}},
+		{"{a,{b,c}}d", []string{"BraceExp {a,{b,c}}", "Lit d"}},
+		// a { that doesn't start one is kept, the braces after it expand
+		{"{x{a,b}", []string{"Lit {x", "BraceExp {a,b}"}},
+		{"{{a,b}}", []string{"Lit {", "BraceExp {a,b}", "Lit }"}},
+		{"{a,b", []string{"Lit {a,b"}},
+		{"{a}", []string{"Lit {a}"}},
+		{"'{a,b}'", []string{"SglQuoted '{a,b}'"}},
+		// ** is left to the glob expansion
+		{"**/", []string{"Lit **/"}},
+		{"**/*.go", []string{"Lit **/*.go"}},
+		{"b/**/", []string{"Lit b/**/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			list, err := Parse("echo " + tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, part := range list.Stmts[0].Pipeline.Cmds[0].(*SimpleCommand).Args[1].Parts {
+				kind := strings.TrimPrefix(fmt.Sprintf("%T", part), "*parser.")
+				got = append(got, kind+" "+(&Word{Parts: []WordPart{part}}).String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
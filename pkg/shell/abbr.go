@@ -0,0 +1,79 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addBuiltin("abbr", "abbr [NAME EXPANSION] [-e NAME]", "define, remove or list abbreviations", (*Shell).builtinAbbr)
+}
+
+// builtinAbbr implements fish-style abbreviations, which expand in place when
+// typed as a command and followed by Space or Enter, so the history keeps
+// the full command:
+//
+//	abbr                      list the abbreviations
+//	abbr NAME EXPANSION...    add an abbreviation
+//	abbr -e NAME...           erase abbreviations
+func (s *Shell) builtinAbbr(args []string, std *stdio) error {
+	if len(args) == 0 || args[0] == "-l" || args[0] == "--list" {
+		names := make([]string, 0, len(s.abbrs))
+		for name := range s.abbrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(std.out, "abbr %s %s\n", name, s.abbrs[name])
+		}
+		return nil
+	}
+
+	if args[0] == "-e" || args[0] == "--erase" {
+		var failed error
+		for _, name := range args[1:] {
+			if _, ok := s.abbrs[name]; !ok {
+				fmt.Fprintf(std.err, "abbr: %s: no such abbreviation\n", name)
+				failed = exitStatus(1)
+			}
+			delete(s.abbrs, name)
+		}
+		return failed
+	}
+
+	if len(args) < 2 {
+		return errors.New("usage: abbr NAME EXPANSION")
+	}
+	name := args[0]
+	if strings.ContainsAny(name, " \t|;&") {
+		return fmt.Errorf("%s: invalid abbreviation name", name)
+	}
+	expansion := strings.Join(args[1:], " ")
+	// `abbr gco 'git checkout'`
+	if n := len(expansion); n >= 2 && (expansion[0] == '\'' || expansion[0] == '"') && expansion[n-1] == expansion[0] {
+		expansion = expansion[1 : n-1]
+	}
+	if s.abbrs == nil {
+		s.abbrs = make(map[string]string)
+	}
+	s.abbrs[name] = expansion
+	return nil
+}
+
+// expandAbbr expands the last word of the input line if it is an
+// abbreviation in command position, at the start of the line or after a
+// pipe.
+func (s *Shell) expandAbbr() {
+	start := strings.LastIndexAny(s.input, " \t|;&") + 1
+	expansion, ok := s.abbrs[s.input[start:]]
+	if !ok {
+		return
+	}
+	before := strings.TrimRight(s.input[:start], " \t")
+	if before != "" && !strings.ContainsAny(before[len(before)-1:], "|;&") {
+		return
+	}
+	s.setInput(s.input[:start] + expansion)
+}
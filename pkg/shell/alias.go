@@ -0,0 +1,98 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addBuiltin("alias", "alias [--json] [NAME[=TEXT] ...]", "define or list aliases", (*Shell).builtinAlias)
+	addBuiltin("unalias", "unalias [-a] NAME ...", "remove aliases", (*Shell).builtinUnalias)
+}
+
+// builtinAlias implements aliases, which replace the first word of a
+// command with their text when the line is parsed:
+//
+//	alias                  list the aliases
+//	alias NAME=TEXT ...    define aliases, e.g. alias ll='ls -la'
+//	alias NAME ...         print the definition of aliases
+//
+// Aliases defined in the rc file last for the whole session.
+func (s *Shell) builtinAlias(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("alias", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	fs.Bool("p", false, "list the aliases")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		if *asJSON {
+			aliases := s.aliases
+			if aliases == nil {
+				aliases = map[string]string{}
+			}
+			return writeJSON(std, aliases)
+		}
+		names := make([]string, 0, len(s.aliases))
+		for name := range s.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(std.out, "alias %s=%s\n", name, shellQuote(s.aliases[name]))
+		}
+		return nil
+	}
+
+	var failed error
+	for _, arg := range fs.Args() {
+		name, text, define := strings.Cut(arg, "=")
+		if !define {
+			text, ok := s.aliases[name]
+			if !ok {
+				fmt.Fprintf(std.err, "alias: %s: not found\n", name)
+				failed = exitStatus(1)
+				continue
+			}
+			fmt.Fprintf(std.out, "alias %s=%s\n", name, shellQuote(text))
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, " \t\n\\'\"$`;&|<>()=/") {
+			fmt.Fprintf(std.err, "alias: %s: invalid alias name\n", name)
+			failed = exitStatus(1)
+			continue
+		}
+		if s.aliases == nil {
+			s.aliases = make(map[string]string)
+		}
+		s.aliases[name] = text
+	}
+	return failed
+}
+
+// builtinUnalias implements `unalias [-a] NAME ...`, which removes aliases,
+// or all of them with -a.
+func (s *Shell) builtinUnalias(args []string, std *stdio) error {
+	if len(args) > 0 && args[0] == "-a" {
+		s.aliases = nil
+		return nil
+	}
+	if len(args) == 0 {
+		return errors.New("usage: unalias [-a] NAME ...")
+	}
+	var failed error
+	for _, name := range args {
+		if _, ok := s.aliases[name]; !ok {
+			fmt.Fprintf(std.err, "unalias: %s: not found\n", name)
+			failed = exitStatus(1)
+		}
+		delete(s.aliases, name)
+	}
+	return failed
+}
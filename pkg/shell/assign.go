@@ -0,0 +1,105 @@
+package shell
+
+import (
+	"fmt"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// assignment is a NAME=value word ahead of the command word.
+type assignment struct {
+	name  string
+	value string
+}
+
+// expandAssigns expands the values of the assignments of a command.
+func (s *Shell) expandAssigns(assigns []*parser.Assign) []assignment {
+	expanded := make([]assignment, len(assigns))
+	for i, a := range assigns {
+		expanded[i] = assignment{a.Name, s.expandWord(a.Value)}
+	}
+	return expanded
+}
+
+// runAssignments runs a command that is only assignments, and maybe
+// redirections, as in `A=1 B=$A`: the variables are set in order, each
+// value expanded after the previous assignment, and the redirected files are
+// created. The status is the one of the last command substitution, as in
+// `out=$(make)`, or 0.
+func (s *Shell) runAssignments(command *parser.SimpleCommand) {
+	s.lastStatus = 0
+	for _, a := range command.Assigns {
+		s.setVar(a.Name, s.expandWord(a.Value))
+	}
+	_, files, err := s.applyRedirects(s.expandRedirects(command.Redirs), s.terminalIO())
+	if err != nil {
+		fmt.Fprintln(s.Stderr, "gosh:", err)
+		s.lastStatus = 1
+		return
+	}
+	closeFiles(files)
+}
+
+// setVar sets a shell variable. A variable that is in the environment stays
+// exported, its new value with it.
+func (s *Shell) setVar(name, value string) {
+	if _, exported := s.env[name]; exported {
+		s.env[name] = value
+		return
+	}
+	s.vars[name] = value
+}
+
+// withAssignments runs fn with the assignments exported, then puts the
+// variables back as they were. It is how assignments ahead of a builtin or a
+// function only last for it, and reach the commands it runs.
+func (s *Shell) withAssignments(assigns []assignment, fn func()) {
+	var restore []savedVar
+	for _, a := range assigns {
+		restore = append(restore, s.saveVar(a.name))
+		s.exportVar(a.name, a.value)
+	}
+	fn()
+	// in reverse, in case a name was assigned twice
+	for i := len(restore) - 1; i >= 0; i-- {
+		s.restoreVar(restore[i])
+	}
+}
+
+// savedVar is a variable as it was, in the shell variables and the
+// environment, to put it back later.
+type savedVar struct {
+	name         string
+	value, env   string
+	isVar, inEnv bool
+}
+
+func (s *Shell) saveVar(name string) savedVar {
+	old := savedVar{name: name}
+	old.value, old.isVar = s.vars[name]
+	old.env, old.inEnv = s.env[name]
+	return old
+}
+
+func (s *Shell) restoreVar(old savedVar) {
+	if old.isVar {
+		s.vars[old.name] = old.value
+	} else {
+		delete(s.vars, old.name)
+	}
+	if old.inEnv {
+		s.env[old.name] = old.env
+	} else {
+		delete(s.env, old.name)
+	}
+}
+
+// assignmentEnv returns the environment of a command run with assigns ahead
+// of it: the shell's environment plus the assignments.
+func (s *Shell) assignmentEnv(assigns []assignment) []string {
+	env := s.environ()
+	for _, a := range assigns {
+		env = append(env, a.name+"="+a.value)
+	}
+	return env
+}
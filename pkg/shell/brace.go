@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// expandBraces returns the words w stands for once its brace expansions are
+// made, in order: a{b,c}d stands for abd and acd.
+func expandBraces(w *parser.Word) []*parser.Word {
+	for i, part := range w.Parts {
+		brace, ok := part.(*parser.BraceExp)
+		if !ok {
+			continue
+		}
+		var words []*parser.Word
+		for _, elem := range braceElems(brace) {
+			parts := slices.Concat(w.Parts[:i], elem, w.Parts[i+1:])
+			words = append(words, expandBraces(&parser.Word{Pos: w.Pos, Parts: parts})...)
+		}
+		return words
+	}
+	return []*parser.Word{w}
+}
+
+// braceElems returns the parts each word made by a brace expansion has in
+// its place.
+func braceElems(brace *parser.BraceExp) [][]parser.WordPart {
+	var elems [][]parser.WordPart
+	if brace.Elems == nil {
+		for _, value := range braceSeqValues(brace) {
+			elems = append(elems, []parser.WordPart{&parser.Lit{Value: value}})
+		}
+		return elems
+	}
+	for _, elem := range brace.Elems {
+		elems = append(elems, elem.Parts)
+	}
+	return elems
+}
+
+// braceSeqValues returns the values of a {FROM..TO..STEP} sequence, counting
+// down when TO is lower than FROM. Integers written with leading zeros, as
+// in {01..10}, are padded to the same width.
+func braceSeqValues(seq *parser.BraceExp) []string {
+	step := max(seq.Step, -seq.Step, 1)
+	from, fromErr := strconv.Atoi(seq.From)
+	to, toErr := strconv.Atoi(seq.To)
+	letters := fromErr != nil || toErr != nil
+	width := 0
+	if letters {
+		from, to = int(seq.From[0]), int(seq.To[0])
+	} else if zeroPadded(seq.From) || zeroPadded(seq.To) {
+		width = max(len(seq.From), len(seq.To))
+	}
+	if to < from {
+		step = -step
+	}
+
+	var values []string
+	for n := from; step > 0 && n <= to || step < 0 && n >= to; n += step {
+		if letters {
+			values = append(values, string(rune(n)))
+		} else {
+			values = append(values, fmt.Sprintf("%0*d", width, n))
+		}
+	}
+	return values
+}
+
+func zeroPadded(n string) bool {
+	n = strings.TrimPrefix(n, "-")
+	return len(n) > 1 && n[0] == '0'
+}
@@ -0,0 +1,307 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+// stdio holds the streams a builtin reads from and writes to: the terminal
+// for a plain command line, or pipes when it is a stage of a pipeline.
+type stdio struct {
+	in  io.Reader
+	out io.Writer
+	err io.Writer
+}
+
+func (s *Shell) terminalIO() *stdio {
+	std := *s.std
+	return &std
+}
+
+// builtin is a native builtin: how it is used and what it does, for help,
+// and the method implementing it. It is a BuiltinDoc like the ones programs
+// register, run on the shell its context holds.
+type builtin struct {
+	name    string
+	usage   string
+	summary string
+	run     func(s *Shell, args []string, std *stdio) error
+}
+
+// nativeBuiltins are the builtins of gosh, which each file adds its own to
+// in an init function, with addBuiltin. Each shell starts with them
+// registered.
+var nativeBuiltins = make(map[string]*builtin)
+
+func addBuiltin(name, usage, summary string, run func(s *Shell, args []string, std *stdio) error) {
+	nativeBuiltins[name] = &builtin{name, usage, summary, run}
+}
+
+func (b *builtin) Name() string {
+	return b.name
+}
+
+func (b *builtin) Usage() string {
+	return b.usage
+}
+
+func (b *builtin) Summary() string {
+	return b.summary
+}
+
+func (b *builtin) Run(ctx context.Context, args []string, streams IO) error {
+	return b.run(ctx.Value(shellKey{}).(*Shell), args, &stdio{streams.In, streams.Out, streams.Err})
+}
+
+// shellKey is the context key of the shell running a builtin.
+type shellKey struct{}
+
+// defaultBuiltins returns the builtins a new shell has, the native ones.
+func defaultBuiltins() map[string]Builtin {
+	builtins := make(map[string]Builtin, len(nativeBuiltins))
+	for name, b := range nativeBuiltins {
+		builtins[name] = b
+	}
+	return builtins
+}
+
+// runBuiltin runs the builtin called name, reporting whether there is one,
+// and records its exit status.
+func (s *Shell) runBuiltin(name string, args []string, std *stdio) bool {
+	ok, err := s.callBuiltin(name, args, std)
+	if ok {
+		s.lastStatus = statusOf(s.builtinDone(name, err, std))
+	}
+	return ok
+}
+
+// isBuiltin reports whether name, run with args, is a builtin. The native
+// env is one only without arguments or for the env commands of .gosh.env
+// files, running the external env otherwise.
+func (s *Shell) isBuiltin(name string, args []string) bool {
+	b, ok := s.builtins[name]
+	if ok && b == Builtin(nativeBuiltins["env"]) {
+		return len(args) == 0 || isDirEnvCommand(args)
+	}
+	return ok
+}
+
+// callBuiltin runs the builtin called name, reporting whether there is one,
+// and returns its error.
+func (s *Shell) callBuiltin(name string, args []string, std *stdio) (bool, error) {
+	if !s.isBuiltin(name, args) {
+		return false, nil
+	}
+	return true, s.runRegisteredBuiltin(s.builtins[name], args, std)
+}
+
+func init() {
+	addBuiltin("cd", "cd DIR", "change the working directory", (*Shell).builtinCd)
+	addBuiltin("pwd", "pwd", "print the working directory", (*Shell).builtinPwd)
+	addBuiltin("env", "env [allow [DIR] | deny [DIR] | reload]", "print the environment, or trust the .gosh.env file of a directory", (*Shell).builtinEnvCommand)
+	addBuiltin("true", "true", "do nothing, successfully", (*Shell).builtinTrue)
+	addBuiltin(":", ": [ARG ...]", "do nothing, successfully, with the arguments expanded", (*Shell).builtinTrue)
+	addBuiltin("false", "false", "do nothing, and fail", (*Shell).builtinFalse)
+	addBuiltin("help", "help [--json] [NAME ...]", "list the builtins, or tell how to use them", (*Shell).builtinHelp)
+}
+
+func (s *Shell) builtinCd(args []string, std *stdio) error {
+	if len(args) == 0 {
+		fmt.Fprintln(std.err, "cd: requires 1 argument")
+		return exitStatus(1)
+	}
+	if err := s.changeDir(args[0]); err != nil {
+		fmt.Fprintln(std.err, "cd: error: ", err.Error())
+		return exitStatus(1)
+	}
+	return nil
+}
+
+func (s *Shell) builtinPwd(args []string, std *stdio) error {
+	fmt.Fprintln(std.out, s.workingDir)
+	return nil
+}
+
+// builtinEnvCommand implements env without arguments, which prints the
+// environment, and the env commands of .gosh.env files; any other env
+// command line runs the external env.
+func (s *Shell) builtinEnvCommand(args []string, std *stdio) error {
+	if len(args) == 0 {
+		s.builtinEnv(std)
+		return nil
+	}
+	return s.builtinDirEnv(args, std)
+}
+
+func (s *Shell) builtinTrue(args []string, std *stdio) error {
+	return nil
+}
+
+func (s *Shell) builtinFalse(args []string, std *stdio) error {
+	return exitStatus(1)
+}
+
+// builtinHelp implements `help [NAME ...]`, which lists the builtins with
+// their usage, or tells how to use the ones called NAME.
+func (s *Shell) builtinHelp(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("help", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	type help struct {
+		Name    string `json:"name"`
+		Usage   string `json:"usage"`
+		Summary string `json:"summary"`
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = s.builtinCommandNames()
+		slices.Sort(names)
+	}
+	var helps []help
+	var failed error
+	for _, name := range names {
+		usage, summary, ok := s.builtinUsage(name)
+		if !ok {
+			fmt.Fprintf(std.err, "help: %s: no such builtin\n", name)
+			failed = exitStatus(1)
+			continue
+		}
+		helps = append(helps, help{name, usage, summary})
+	}
+
+	if *asJSON {
+		if helps == nil {
+			helps = []help{}
+		}
+		if err := writeJSON(std, helps); err != nil {
+			return err
+		}
+		return failed
+	}
+	w := tabwriter.NewWriter(std.out, 0, 0, 2, ' ', 0)
+	for _, h := range helps {
+		if h.Summary == "" {
+			fmt.Fprintln(w, h.Usage)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", h.Usage, h.Summary)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return failed
+}
+
+// builtinUsage returns how the builtin called name is used and what it
+// does. A registered builtin that isn't a BuiltinDoc only has its name.
+func (s *Shell) builtinUsage(name string) (usage, summary string, ok bool) {
+	b, ok := s.builtins[name]
+	if !ok {
+		return "", "", false
+	}
+	if doc, ok := b.(BuiltinDoc); ok {
+		return doc.Usage(), doc.Summary(), true
+	}
+	return name, "", true
+}
+
+// flagError returns the error of a builtin whose flags fs.Parse failed on,
+// once the flag package printed why and the usage to the builtin's stderr:
+// none for -h, or else a quiet status 2.
+func flagError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return exitStatus(2)
+}
+
+// builtinDone reports the error of a builtin, returning the one its exit
+// status comes from.
+func (s *Shell) builtinDone(name string, err error, std *stdio) error {
+	// a builtin writing to a pipe nobody reads anymore, as in `history |
+	// head -1`, stops silently, as an external command killed by SIGPIPE
+	if errors.Is(err, syscall.EPIPE) {
+		err = exitStatus(128 + int(syscall.SIGPIPE))
+	}
+	var status exitStatus
+	if err != nil && !errors.As(err, &status) {
+		fmt.Fprintf(std.err, "%s: %v\n", name, err)
+	}
+	return err
+}
+
+// stdinLines reads the lines of std.in for builtins that take their
+// operands from stdin when none are given. It refuses to wait on a terminal.
+func stdinLines(std *stdio) ([]string, error) {
+	if f, ok := std.in.(*os.File); std.in == nil || ok && term.IsTerminal(int(f.Fd())) {
+		return nil, errors.New("no input on stdin")
+	}
+	var lines []string
+	scanner := bufio.NewScanner(std.in)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// exitStatus is returned by builtins that fail without an error message,
+// like `string match` when nothing matches.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// statusOf returns the exit status for the error of a command: its exit
+// code, 128 plus the signal number when it was killed, 127 when it wasn't
+// found, or 1 for other failures.
+func statusOf(err error) int {
+	var status exitStatus
+	if errors.As(err, &status) {
+		return int(status)
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return 127
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// commandStatus returns the error of an external command run by a builtin,
+// as in `sandbox make`, as the status of the builtin. The exit code of the
+// command tells it all, and isn't reported as an error, nor a SIGINT or a
+// SIGPIPE; the other signals are, as for the commands the shell runs itself.
+func commandStatus(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() && ws.Signal() != syscall.SIGINT && ws.Signal() != syscall.SIGPIPE {
+		return err
+	}
+	return exitStatus(statusOf(err))
+}
@@ -0,0 +1,122 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		builtin string
+		line    string
+		want    string
+	}{
+		{"cd", "cd /; pwd", "/\n"},
+		{"cd", "cd; echo $?", "cd: requires 1 argument\n1\n"},
+		{"pwd", "cd /tmp; pwd", "/tmp\n"},
+		{"true", "true; echo $?", "0\n"},
+		{":", ": a b; echo $?", "0\n"},
+		{"false", "false; echo $?", "1\n"},
+		{"echo", "echo -n a; echo b c", "ab c\n"},
+		{"echo", `echo -e 'a\tb'`, "a\tb\n"},
+		{"printf", `printf '%s-%d\n' x 3`, "x-3\n"},
+		{"printf", `printf -v v '%03d' 7; echo $v`, "007\n"},
+		{"calc", "calc 1+2*3", "7\n"},
+		{"=", "= 7/2", "3.5\n"},
+		{"string", "string upper abc", "ABC\n"},
+		{"test", "test 1 -lt 2; echo $?", "0\n"},
+		{"[", "[ a = b ]; echo $?", "1\n"},
+		{"alias", "alias ll='ls -l'; alias ll", "alias ll='ls -l'\n"},
+		{"unalias", "alias ll=ls; unalias ll; alias ll; echo $?", "alias: ll: not found\n1\n"},
+		{"abbr", "abbr gs 'git status'; abbr", "abbr gs git status\n"},
+		{"export", "export A=1; sh -c 'echo $A'", "1\n"},
+		{"export", "export A=1; export -n A; sh -c 'echo [$A]'; echo $A", "[]\n1\n"},
+		{"unset", "A=1; unset A; echo [$A]", "[]\n"},
+		{"env", "A=1 env | grep ^A=", "A=1\n"},
+		{"local", "f() { local x=2; echo $x; }; x=1; f; echo $x", "2\n1\n"},
+		{"return", "f() { return 3; echo no; }; f; echo $?", "3\n"},
+		{"read", "echo a b | { read x y; echo $y $x; }", "b a\n"},
+		{"set", "set -o pipefail; false | true; echo $?", "1\n"},
+		{"source", "source /dev/null; echo $?", "0\n"},
+		{"help", "help true", "true  do nothing, successfully\n"},
+		{"help", "help nosuch; echo $?", "help: nosuch: no such builtin\n1\n"},
+		{"jobs", "jobs; echo $?", "0\n"},
+		{"trap", "trap 'echo bye' EXIT; echo hi; exit", "hi\nbye\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.builtin+" "+tt.line, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newTestShell(t, &out)
+			if _, ok := s.builtins[tt.builtin]; !ok {
+				t.Fatalf("%s is not a builtin", tt.builtin)
+			}
+			s.Eval(tt.line)
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// upper is a registered builtin writing its arguments in upper case.
+type upper struct{}
+
+func (upper) Name() string {
+	return "upper"
+}
+
+func (upper) Run(ctx context.Context, args []string, io IO) error {
+	_, err := fmt.Fprintln(io.Out, strings.ToUpper(strings.Join(args, " ")))
+	return err
+}
+
+func TestRegister(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	s.Register(upper{})
+	s.RegisterBuiltin("pwd", func(ctx context.Context, args []string, io IO) int {
+		fmt.Fprintln(io.Out, "replaced")
+		return 2
+	})
+	s.Eval("upper a b | cat; pwd; echo $?; help upper")
+	if got, want := out.String(), "A B\nreplaced\n2\nupper\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// The native builtins of a pipeline stage run on its subshell.
+func TestBuiltinsInSubshell(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	s.Eval("cd /; cd /tmp | cat; pwd; x=1; echo | read x; echo $x")
+	if got, want := out.String(), "/\n1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// The builtins parsing flags print their usage for -h, and with the flag
+// errors.
+func TestBuiltinUsage(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // the first line of the output
+	}{
+		{"sandbox -h", "Usage of sandbox:"},
+		{"sandbox -x", "flag provided but not defined: -x"},
+		{"limit -h", "Usage of limit:"},
+		{"lowprio -h", "Usage of lowprio:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newTestShell(t, &out)
+			s.Eval(tt.line)
+			if got, _, _ := strings.Cut(out.String(), "\n"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
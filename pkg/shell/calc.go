@@ -0,0 +1,245 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addBuiltin("calc", "calc EXPR", "evaluate an arithmetic expression", (*Shell).builtinCalc)
+	addBuiltin("=", "= EXPR", "evaluate an arithmetic expression, like calc", (*Shell).builtinCalc)
+}
+
+// builtinCalc implements `calc EXPR...` and its `= EXPR...` shorthand, which
+// evaluate a floating-point expression and print the result. The arguments
+// are joined, so `calc 1 + 2` and `calc 1+2` are the same. Expressions
+// support + - * / % ^ (power), parentheses, the constants pi and e, and
+// the functions sqrt, pow, round, floor, ceil, abs, min, max, exp, ln,
+// log (base 10), log2, sin, cos, tan, asin, acos and atan.
+func (s *Shell) builtinCalc(args []string, std *stdio) error {
+	if len(args) == 0 {
+		return errors.New("missing expression")
+	}
+	value, err := evalCalc(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(std.out, strconv.FormatFloat(value, 'g', -1, 64))
+	return nil
+}
+
+var calcConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var calcFunctions = map[string]struct {
+	arity int
+	fn    func(args []float64) float64
+}{
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"ln":    {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"log2":  {1, func(a []float64) float64 { return math.Log2(a[0]) }},
+	"sin":   {1, func(a []float64) float64 { return math.Sin(a[0]) }},
+	"cos":   {1, func(a []float64) float64 { return math.Cos(a[0]) }},
+	"tan":   {1, func(a []float64) float64 { return math.Tan(a[0]) }},
+	"asin":  {1, func(a []float64) float64 { return math.Asin(a[0]) }},
+	"acos":  {1, func(a []float64) float64 { return math.Acos(a[0]) }},
+	"atan":  {1, func(a []float64) float64 { return math.Atan(a[0]) }},
+}
+
+// calcParser is a recursive descent parser evaluating as it goes:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/" | "%") unary }
+//	unary  = ("-" | "+") unary | power
+//	power  = atom [ "^" unary ]
+//	atom   = number | const | func "(" expr { "," expr } ")" | "(" expr ")"
+type calcParser struct {
+	input string
+	pos   int
+}
+
+func evalCalc(input string) (float64, error) {
+	p := &calcParser{input: input}
+	value, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+	return value, nil
+}
+
+func (p *calcParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("column %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *calcParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes c if it is the next non-space character.
+func (p *calcParser) accept(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *calcParser) expr() (float64, error) {
+	left, err := p.term()
+	for err == nil {
+		var right float64
+		switch {
+		case p.accept('+'):
+			right, err = p.term()
+			left += right
+		case p.accept('-'):
+			right, err = p.term()
+			left -= right
+		default:
+			return left, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *calcParser) term() (float64, error) {
+	left, err := p.unary()
+	for err == nil {
+		var right float64
+		switch {
+		case p.accept('*'):
+			right, err = p.unary()
+			left *= right
+		case p.accept('/'):
+			right, err = p.unary()
+			left /= right
+		case p.accept('%'):
+			right, err = p.unary()
+			left = math.Mod(left, right)
+		default:
+			return left, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *calcParser) unary() (float64, error) {
+	if p.accept('-') {
+		value, err := p.unary()
+		return -value, err
+	}
+	if p.accept('+') {
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *calcParser) power() (float64, error) {
+	base, err := p.atom()
+	if err != nil {
+		return 0, err
+	}
+	if p.accept('^') {
+		// right associative: 2^3^2 = 2^9
+		exponent, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exponent), nil
+	}
+	return base, nil
+}
+
+func (p *calcParser) atom() (float64, error) {
+	p.skipSpace()
+	if p.pos == len(p.input) {
+		return 0, p.errorf("unexpected end of expression")
+	}
+
+	if p.accept('(') {
+		value, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, p.errorf("missing ')'")
+		}
+		return value, nil
+	}
+
+	start := p.pos
+	c := p.input[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.input) && strings.IndexByte("0123456789.eE", p.input[p.pos]) >= 0 {
+			// allow a sign right after the exponent marker
+			if (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') && p.pos+1 < len(p.input) &&
+				(p.input[p.pos+1] == '-' || p.input[p.pos+1] == '+') {
+				p.pos++
+			}
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			p.pos = start
+			return 0, p.errorf("invalid number %q", p.input[start:])
+		}
+		return value, nil
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.input) && isIdentByte(p.input[p.pos]) && p.input[p.pos] != '-' {
+			p.pos++
+		}
+		name := strings.ToLower(p.input[start:p.pos])
+		if value, ok := calcConstants[name]; ok {
+			return value, nil
+		}
+		fn, ok := calcFunctions[name]
+		if !ok {
+			p.pos = start
+			return 0, p.errorf("unknown name %q", name)
+		}
+		if !p.accept('(') {
+			return 0, p.errorf("expected '(' after %s", name)
+		}
+		var args []float64
+		for {
+			value, err := p.expr()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, value)
+			if !p.accept(',') {
+				break
+			}
+		}
+		if !p.accept(')') {
+			return 0, p.errorf("missing ')'")
+		}
+		if len(args) != fn.arity {
+			return 0, fmt.Errorf("%s takes %d argument(s), got %d", name, fn.arity, len(args))
+		}
+		return fn.fn(args), nil
+	}
+	return 0, p.errorf("unexpected %q", string(c))
+}
@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+var cgroupSeq atomic.Int64
+
+// currentCgroup returns the cgroup v2 directory of the shell process.
+func currentCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("cgroup v2 is not mounted at " + cgroupRoot)
+	}
+
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rel, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroupRoot, rel), nil
+		}
+	}
+	return "", errors.New("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+// newCgroup creates a child of the shell's cgroup enforcing the memory and
+// process limits of cfg. It needs the shell's cgroup to be delegated to the
+// user, as systemd does for user sessions.
+func newCgroup(cfg *limitsConfig) (dir string, f *os.File, err error) {
+	parent, err := currentCgroup()
+	if err != nil {
+		return "", nil, err
+	}
+
+	controllers := []string{"+memory", "+pids"}
+	control := filepath.Join(parent, "cgroup.subtree_control")
+	if err := os.WriteFile(control, []byte(strings.Join(controllers, " ")), 0); err != nil {
+		return "", nil, fmt.Errorf("enabling controllers in %s: %w", parent, err)
+	}
+
+	dir = filepath.Join(parent, fmt.Sprintf("gosh-%d-%d", os.Getpid(), cgroupSeq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dir)
+		}
+	}()
+
+	if cfg.Memory > 0 {
+		value := strconv.FormatInt(cfg.Memory, 10)
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(value), 0); err != nil {
+			return "", nil, err
+		}
+		// without this the limit would just push the command into swap
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0)
+	}
+	if cfg.Procs > 0 {
+		value := strconv.FormatInt(cfg.Procs, 10)
+		if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte(value), 0); err != nil {
+			return "", nil, err
+		}
+	}
+
+	f, err = os.Open(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	return dir, f, nil
+}
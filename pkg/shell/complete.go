@@ -0,0 +1,228 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Completer completes the arguments of a command, for Tab.
+type Completer interface {
+	// Complete returns the candidates for word, the word being typed. args
+	// are the words of the command before it, starting with the command
+	// name. Candidates that don't start with word are left out.
+	Complete(args []string, word string) []string
+}
+
+// CompleterFunc lets a function be used as a Completer.
+type CompleterFunc func(args []string, word string) []string
+
+func (f CompleterFunc) Complete(args []string, word string) []string {
+	return f(args, word)
+}
+
+// RegisterCompleter sets how the arguments of the command called name are
+// completed, replacing file name completion, or what the complete builtin
+// set for it.
+func (s *Shell) RegisterCompleter(name string, c Completer) {
+	if s.completers == nil {
+		s.completers = make(map[string]Completer)
+	}
+	s.completers[name] = c
+}
+
+// completionSpec is a completer defined with the complete builtin.
+type completionSpec struct {
+	shell    *Shell
+	words    []string // -W
+	actions  []string // -f, -d and -c: file, directory, command
+	command  string   // -C
+	fallback bool     // -o default: complete file names when nothing else matched
+}
+
+func (spec *completionSpec) Complete(args []string, word string) []string {
+	s := spec.shell
+	candidates := append([]string(nil), spec.words...)
+	for _, action := range spec.actions {
+		switch action {
+		case "file":
+			candidates = append(candidates, s.fileCompletions(word)...)
+		case "directory":
+			for _, file := range s.fileCompletions(word) {
+				if strings.HasSuffix(file, "/") {
+					candidates = append(candidates, file)
+				}
+			}
+		case "command":
+			candidates = append(candidates, s.commandCompletions(word)...)
+		}
+	}
+	if spec.command != "" {
+		candidates = append(candidates, s.runCompletionCommand(spec.command, args, word)...)
+	}
+	if spec.fallback && !hasPrefixed(candidates, word) {
+		candidates = s.fileCompletions(word)
+	}
+	return candidates
+}
+
+// runCompletionCommand runs the -C command of a completion spec, as bash
+// does: its arguments are the command name, the word being completed and the
+// word before it, and the line is in $COMP_LINE, with the cursor offset in
+// $COMP_POINT. Each line it prints is a candidate.
+func (s *Shell) runCompletionCommand(command string, args []string, word string) []string {
+	argv := strings.Fields(command)
+	file, err := s.lookPath(argv[0])
+	if err != nil {
+		return nil
+	}
+	cmd := s.newCommand(file, append(argv[1:], args[0], word, args[len(args)-1]))
+	cmd.Env = append(cmd.Env, "COMP_LINE="+s.input, "COMP_POINT="+strconv.Itoa(s.cursor))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+}
+
+func hasPrefixed(candidates []string, word string) bool {
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the spec as the complete command that defines it.
+func (spec *completionSpec) String() string {
+	var b strings.Builder
+	b.WriteString("complete")
+	if spec.fallback {
+		b.WriteString(" -o default")
+	}
+	for _, action := range spec.actions {
+		b.WriteString(" -" + action[:1])
+	}
+	if len(spec.words) > 0 {
+		fmt.Fprintf(&b, " -W '%s'", strings.Join(spec.words, " "))
+	}
+	if spec.command != "" {
+		fmt.Fprintf(&b, " -C '%s'", spec.command)
+	}
+	return b.String()
+}
+
+func init() {
+	addBuiltin("complete", "complete [-fdc] [-W WORDS] [-C CMD] [-r] [-p] NAME ...", "set how Tab completes the arguments of a command", (*Shell).builtinComplete)
+}
+
+// builtinComplete implements a subset of bash's programmable completion:
+//
+//	complete [-p] [NAME...]          list how commands are completed
+//	complete [-fdc] [-W WORDS] [-C COMMAND] [-o default] NAME...
+//	complete -r NAME...              go back to file name completion
+//
+// -W completes from a list of words, -C from the lines a command prints, -f,
+// -d and -c with file, directory and command names; -o default falls back to
+// file names when none of them match.
+func (s *Shell) builtinComplete(args []string, std *stdio) error {
+	spec := &completionSpec{shell: s}
+	list, remove := len(args) == 0, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		flag := args[0]
+		args = args[1:]
+		switch flag {
+		case "-p":
+			list = true
+		case "-r":
+			remove = true
+		case "-f":
+			spec.actions = append(spec.actions, "file")
+		case "-d":
+			spec.actions = append(spec.actions, "directory")
+		case "-c":
+			spec.actions = append(spec.actions, "command")
+		case "-W", "-C", "-o":
+			var value string
+			var ok bool
+			if value, args, ok = quotedArg(args); !ok {
+				return fmt.Errorf("%s: option requires an argument", flag)
+			}
+			switch flag {
+			case "-W":
+				spec.words = append(spec.words, strings.Fields(value)...)
+			case "-C":
+				if strings.TrimSpace(value) == "" {
+					return errors.New("-C: empty command")
+				}
+				spec.command = value
+			default:
+				if value != "default" {
+					return fmt.Errorf("%s: invalid option name", value)
+				}
+				spec.fallback = true
+			}
+		default:
+			return fmt.Errorf("%s: invalid option", flag)
+		}
+	}
+
+	switch {
+	case list:
+		names := args
+		if len(names) == 0 {
+			for name := range s.completers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		var failed error
+		for _, name := range names {
+			switch c := s.completers[name].(type) {
+			case nil:
+				fmt.Fprintf(std.err, "complete: %s: no completion specification\n", name)
+				failed = exitStatus(1)
+			case *completionSpec:
+				fmt.Fprintf(std.out, "%s %s\n", c, name)
+			default:
+				fmt.Fprintf(std.out, "# %s: completed by a registered completer\n", name)
+			}
+		}
+		return failed
+	case len(args) == 0:
+		return errors.New("usage: complete [-fdc] [-W WORDS] [-C COMMAND] [-o default] NAME...")
+	case remove:
+		for _, name := range args {
+			delete(s.completers, name)
+		}
+		return nil
+	}
+	for _, name := range args {
+		s.RegisterCompleter(name, spec)
+	}
+	return nil
+}
+
+// quotedArg takes the first of args, which may be a quoted string spanning
+// several of them, as in `-W 'start stop'`, and returns it without the
+// quotes, along with the args that follow it.
+func quotedArg(args []string) (string, []string, bool) {
+	if len(args) == 0 {
+		return "", nil, false
+	}
+	first := args[0]
+	if first == "" || (first[0] != '\'' && first[0] != '"') {
+		return first, args[1:], true
+	}
+	quote := first[:1]
+	for i := range args {
+		if (i > 0 || len(first) > 1) && strings.HasSuffix(args[i], quote) {
+			value := strings.Join(args[:i+1], " ")
+			return value[1 : len(value)-1], args[i+1:], true
+		}
+	}
+	return "", nil, false
+}
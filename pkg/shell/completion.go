@@ -0,0 +1,238 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// completionQueryItems is how many candidates can be listed without asking
+// first, as readline's completion-query-items.
+const completionQueryItems = 100
+
+// completeWord is bound to Tab. It completes the word before the cursor: a
+// command name (builtin, alias, abbreviation or PATH executable) for the first
+// word of a command, an argument for the others. It inserts what the candidates
+// have in common, and lists them when that adds nothing.
+func (s *Shell) completeWord() {
+	start := s.completionStart()
+	word := s.input[start:s.cursor]
+	candidates := s.completionCandidates(start, word)
+	if len(candidates) == 0 {
+		fmt.Fprint(s.Stdout, "\a")
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(prefix) > len(word) {
+		s.insertText(prefix[len(word):])
+	}
+	if len(candidates) == 1 {
+		// a directory can be completed further
+		if !strings.HasSuffix(prefix, "/") && !strings.HasPrefix(s.input[s.cursor:], " ") {
+			s.insertText(" ")
+		}
+		return
+	}
+	if len(prefix) == len(word) {
+		s.listCompletions(word, candidates)
+	}
+}
+
+// possibleCompletions lists the candidates for the word before the cursor
+// without changing the line.
+func (s *Shell) possibleCompletions() {
+	start := s.completionStart()
+	word := s.input[start:s.cursor]
+	if candidates := s.completionCandidates(start, word); len(candidates) > 0 {
+		s.listCompletions(word, candidates)
+	}
+}
+
+// completionStart returns the offset of the word the cursor is at the end of.
+func (s *Shell) completionStart() int {
+	return strings.LastIndexAny(s.input[:s.cursor], " \t\n") + 1
+}
+
+// completionCandidates returns the completions of word, which starts at
+// offset start, sorted and without duplicates.
+// The arguments of a command with a completer, registered from Go or with
+// the complete builtin, are completed by it instead of with file names.
+func (s *Shell) completionCandidates(start int, word string) []string {
+	var candidates []string
+	args := commandWords(s.input[:start])
+	switch {
+	case len(args) == 0 && !strings.Contains(word, "/"):
+		candidates = s.commandCompletions(word)
+	case len(args) == 0:
+		candidates = s.fileCompletions(word)
+	case s.completers[args[0]] != nil:
+		for _, candidate := range s.completers[args[0]].Complete(args, word) {
+			if strings.HasPrefix(candidate, word) {
+				candidates = append(candidates, candidate)
+			}
+		}
+	default:
+		candidates = s.fileCompletions(word)
+	}
+	sort.Strings(candidates)
+	return compactStrings(candidates)
+}
+
+// commandWords returns the words of the command the text before the word
+// being completed ends in: those after the last pipe, ; , && or ||, without
+// the leading assignments. There are none when the word is in command
+// position.
+func commandWords(before string) []string {
+	fields := strings.Fields(before)
+	for i := len(fields) - 1; i >= 0; i-- {
+		if strings.HasSuffix(fields[i], "|") || strings.HasSuffix(fields[i], "|&") || strings.HasSuffix(fields[i], ";") || strings.HasSuffix(fields[i], "&&") {
+			fields = fields[i+1:]
+			break
+		}
+	}
+	for len(fields) > 0 {
+		if name, _, ok := strings.Cut(fields[0], "="); !ok || !isVarName(name) {
+			break
+		}
+		fields = fields[1:]
+	}
+	return fields
+}
+
+func (s *Shell) commandCompletions(word string) []string {
+	var candidates []string
+	add := func(name string) {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	for _, name := range s.builtinCommandNames() {
+		add(name)
+	}
+	for name := range s.abbrs {
+		add(name)
+	}
+	for name := range s.aliases {
+		add(name)
+	}
+	for name := range s.functions {
+		add(name)
+	}
+	for _, name := range s.pathExecutables() {
+		add(name)
+	}
+	return candidates
+}
+
+// fileCompletions returns the files whose name starts with word, relative to
+// the working directory. Directories end with a slash; dot files are only
+// offered when the name typed starts with a dot.
+func (s *Shell) fileCompletions(word string) []string {
+	dir, base := path.Split(word)
+	lookup := expandTilde(dir)
+	if lookup == "" {
+		lookup = "."
+	}
+	entries, err := os.ReadDir(s.resolvePath(lookup))
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (name[0] == '.' && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		} else if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(s.resolvePath(path.Join(lookup, name))); err == nil && info.IsDir() {
+				name += "/"
+			}
+		}
+		candidates = append(candidates, dir+name)
+	}
+	return candidates
+}
+
+// listCompletions prints the candidates in columns below the line, leaving
+// out the directory part of word they all share, as ls would.
+func (s *Shell) listCompletions(word string, candidates []string) {
+	s.moveBelowLine()
+	if len(candidates) > completionQueryItems {
+		fmt.Fprintf(s.Stdout, "Display all %d possibilities? (y or n) ", len(candidates))
+		key, err := s.readKeyEvent()
+		fmt.Fprintln(s.Stdout)
+		if err != nil || (key.seq != "y" && key.seq != "Y") {
+			return
+		}
+	}
+
+	trim := strings.LastIndexByte(word, '/') + 1
+	names := make([]string, len(candidates))
+	widest := 0
+	for i, candidate := range candidates {
+		names[i] = candidate[trim:]
+		widest = max(widest, visibleWidth(names[i]))
+	}
+	width, _ := s.terminalSize()
+	cols := max(1, (width+2)/(widest+2))
+	rows := (len(names) + cols - 1) / cols
+	for row := 0; row < rows; row++ {
+		var line strings.Builder
+		for col := 0; col < cols; col++ {
+			i := col*rows + row
+			if i >= len(names) {
+				break
+			}
+			if col > 0 {
+				line.WriteString("  ")
+			}
+			line.WriteString(names[i])
+			if (col+1)*rows+row < len(names) {
+				line.WriteString(strings.Repeat(" ", widest-visibleWidth(names[i])))
+			}
+		}
+		fmt.Fprintln(s.Stdout, line.String())
+	}
+}
+
+// moveBelowLine moves the terminal cursor to a new line under the prompt and
+// the line being edited, which are drawn again from there.
+func (s *Shell) moveBelowLine() {
+	s.termMu.Lock()
+	defer s.termMu.Unlock()
+	if down := s.lastPrinted - 1 - s.cursorRow; down > 0 {
+		fmt.Fprintf(s.Stdout, "\033[%dB", down)
+	}
+	fmt.Fprint(s.Stdout, "\r\n")
+	s.lastPrinted = 0
+}
+
+// commonPrefix returns the longest prefix shared by all of words, which must
+// not be empty.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// compactStrings removes the repeated strings of a sorted slice.
+func compactStrings(words []string) []string {
+	var out []string
+	for i, word := range words {
+		if i == 0 || word != words[i-1] {
+			out = append(out, word)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package shell
+
+import (
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// runCompound runs a compound command in the shell, setting the exit status.
+func (s *Shell) runCompound(cmd parser.Command) {
+	switch cmd := cmd.(type) {
+	case *parser.IfClause:
+		s.runIf(cmd)
+	case *parser.CaseClause:
+		s.runCase(cmd)
+	case *parser.BraceGroup:
+		s.runList(cmd.List)
+	case *parser.FuncDecl:
+		s.functions[cmd.Name] = cmd
+		s.lastStatus = 0
+	}
+}
+
+// runIf runs the Then list of the first condition of clause that succeeds,
+// or its Else list. The status is the one of the list run, or 0 when none
+// is.
+func (s *Shell) runIf(clause *parser.IfClause) {
+	s.runList(clause.Cond)
+	if s.lastStatus == 0 {
+		s.runList(clause.Then)
+		return
+	}
+	for _, elif := range clause.Elifs {
+		s.runList(elif.Cond)
+		if s.lastStatus == 0 {
+			s.runList(elif.Then)
+			return
+		}
+	}
+	if clause.Else != nil {
+		s.runList(clause.Else)
+		return
+	}
+	s.lastStatus = 0
+}
+
+// runCase runs the list of the first item of clause with a pattern matching
+// its word. The status is the one of the list, or 0 when no pattern matches.
+func (s *Shell) runCase(clause *parser.CaseClause) {
+	word := s.expandWord(clause.Word)
+	for _, item := range clause.Items {
+		for _, pattern := range item.Patterns {
+			if matchPattern(s.expandPattern(pattern), word) {
+				s.lastStatus = 0
+				s.runList(item.List)
+				return
+			}
+		}
+	}
+	s.lastStatus = 0
+}
+
+// startCompound starts cmd, a compound command that is stage i of a pipeline
+// run, in a subshell reading and writing std, as other shells fork one.
+func (s *Shell) startCompound(run *pipelineRun, i int, cmd parser.Command, std *stdio, pipeIn, pipeOut *os.File, started chan struct{}) {
+	sub := s.subshell(std)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		// our ends of the pipes are closed once the command is done, so
+		// that the next one sees EOF and the previous one EPIPE
+		defer closeFile(pipeIn)
+		defer closeFile(pipeOut)
+		close(started)
+		sub.runCompound(cmd)
+		if sub.lastStatus != 0 {
+			run.errs[i] = exitStatus(sub.lastStatus)
+		}
+	}()
+}
+
+// subshell returns a shell with a copy of the state commands see, to run
+// commands alongside the shell with std: the variables, exported or not,
+// options, aliases,
+// functions, history, directory and parameters. What they change doesn't
+// reach the shell, and they have no job control, traps or hooks.
+func (s *Shell) subshell(std *stdio) *Shell {
+	return &Shell{
+		Stdin:           s.Stdin,
+		Stdout:          s.Stdout,
+		Stderr:          s.Stderr,
+		workingDir:      s.workingDir,
+		signalChan:      make(chan os.Signal, 1),
+		historyFilepath: s.historyFilepath,
+		sandbox:         s.sandbox,
+		limits:          s.limits,
+		policy:          s.policy,
+		options:         maps.Clone(s.options),
+		stdin:           s.stdin,
+		abbrs:           maps.Clone(s.abbrs),
+		aliases:         maps.Clone(s.aliases),
+		functions:       maps.Clone(s.functions),
+		vars:            maps.Clone(s.vars),
+		env:             maps.Clone(s.env),
+		history:         slices.Clone(s.history),
+		completers:      s.completers,
+		startTime:       s.startTime,
+		lineno:          s.lineno,
+		line:            s.line,
+		lastStatus:      s.lastStatus,
+		lastArg:         s.lastArg,
+		arg0:            s.arg0,
+		positional:      slices.Clone(s.positional),
+		config:          s.config,
+		builtins:        s.builtins,
+		std:             std,
+		scriptFile:      s.scriptFile,
+		scriptLine:      s.scriptLine,
+		dirEnv:          s.dirEnv,
+	}
+}
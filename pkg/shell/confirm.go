@@ -0,0 +1,87 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// defaultConfirmPatterns are the command lines the confirmation guard asks
+// about when `set -o confirm` is on. More can be added with "confirm" rules in
+// the policy file.
+var defaultConfirmPatterns = []string{
+	"rm -rf *",
+	"rm -fr *",
+	"rm -r -f *",
+	"git push --force*",
+	"git push -f*",
+	"git push * --force*",
+	"git push * -f",
+	"psql *drop table*",
+	"psql *drop database*",
+	"curl *| sh",
+	"curl *| bash",
+	"wget *| sh",
+	"wget *| bash",
+}
+
+// dangerousPattern returns the first confirmation pattern matching the
+// command line, ignoring case.
+func (s *Shell) dangerousPattern(line string) (string, bool) {
+	line = strings.ToLower(line)
+	patterns := defaultConfirmPatterns
+	if s.policy != nil {
+		patterns = append(patterns[:len(patterns):len(patterns)], s.policy.confirm...)
+	}
+	for _, pattern := range patterns {
+		if matchCommandPattern(strings.ToLower(pattern), line) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// confirmCommand shows the command about to run and asks the user whether to
+// go ahead. It returns true when the command may run.
+func (s *Shell) confirmCommand(fields []string) bool {
+	if !s.option("confirm") {
+		return true
+	}
+	line := strings.Join(fields, " ")
+	pattern, ok := s.dangerousPattern(line)
+	if !ok {
+		return true
+	}
+
+	fmt.Fprintf(s.Stdout, "gosh: command matches dangerous pattern %q:\n    %s\nrun it? [y/N] ", pattern, line)
+	return s.readYes()
+}
+
+// confirmPipeline asks, like confirmCommand, before a pipeline runs. Its
+// words are expanded for the question only with set -o confirm, since the
+// commands expand them again, running their command substitutions and
+// ${x:=...} once more.
+func (s *Shell) confirmPipeline(pipeline *parser.Pipeline) bool {
+	if !s.option("confirm") {
+		return true
+	}
+	return s.confirmCommand(s.pipelineFields(pipeline))
+}
+
+// readYes reads the answer to a [y/N] question, echoing it.
+func (s *Shell) readYes() bool {
+	s.enterEditMode()
+	b, err := s.stdin.ReadByte()
+	s.restoreTerminal()
+	if err != nil {
+		fmt.Fprintln(s.Stdout)
+		return false
+	}
+	if b == '\n' {
+		fmt.Fprintln(s.Stdout)
+	} else {
+		fmt.Fprintf(s.Stdout, "%c\n", b)
+	}
+	return b == 'y' || b == 'Y'
+}
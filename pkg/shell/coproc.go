@@ -0,0 +1,112 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// coproc is a command running asynchronously, with its stdin and stdout
+// connected to pipes the shell keeps open.
+type coproc struct {
+	cmd  *exec.Cmd
+	in   *os.File // the shell's end of the command's stdout
+	out  *os.File // the shell's end of the command's stdin
+	done chan struct{}
+}
+
+func init() {
+	addBuiltin("coproc", "coproc [-n NAME] CMD ...", "start a command connected to pipes of the shell", (*Shell).builtinCoproc)
+}
+
+// builtinCoproc implements `coproc [-n NAME] COMMAND...`, which starts
+// COMMAND in the background with its stdin and stdout connected to the shell.
+// The file descriptors are stored in $NAME (COPROC by default) as "READ
+// WRITE", to use with the <&FD and >&FD redirections, and the process ID in
+// $NAME_PID. Neither is exported:
+//
+//	coproc bc -l
+//	echo $COPROC # 8 7, say
+//	echo 2/3 >&7
+//	head -1 <&8
+//
+// Without arguments it lists the coprocesses.
+func (s *Shell) builtinCoproc(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("coproc", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	name := fs.String("n", "COPROC", "name of the coprocess")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		names := make([]string, 0, len(s.coprocs))
+		for name := range s.coprocs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cp := s.coprocs[name]
+			state := "running"
+			select {
+			case <-cp.done:
+				state = "done"
+			default:
+			}
+			fmt.Fprintf(std.out, "%s\t%d\t%s\t%v\n", name, cp.cmd.Process.Pid, state, cp.cmd.Args)
+		}
+		return nil
+	}
+	if !isVarName(*name) {
+		return fmt.Errorf("%s: invalid name", *name)
+	}
+	if cp, ok := s.coprocs[*name]; ok {
+		select {
+		case <-cp.done:
+			cp.close()
+		default:
+			return fmt.Errorf("%s: coprocess still running (pid %d)", *name, cp.cmd.Process.Pid)
+		}
+	}
+
+	cmd := s.newCommand(fs.Arg(0), fs.Args()[1:])
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		closeFiles([]*os.File{stdinR, stdinW})
+		return err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdinR, stdoutW, s.Stderr
+	err = cmd.Start()
+	// the command has its own copies now
+	closeFiles([]*os.File{stdinR, stdoutW})
+	if err != nil {
+		closeFiles([]*os.File{stdinW, stdoutR})
+		return err
+	}
+
+	cp := &coproc{cmd: cmd, in: stdoutR, out: stdinW, done: make(chan struct{})}
+	go func(name string) {
+		err := cmd.Wait()
+		close(cp.done)
+		s.notifyJob(fmt.Sprintf("[%s] %s", name, jobStatusText(err, cmd.Args)))
+	}(*name)
+	if s.coprocs == nil {
+		s.coprocs = make(map[string]*coproc)
+	}
+	s.coprocs[*name] = cp
+	s.setVar(*name, fmt.Sprintf("%d %d", cp.in.Fd(), cp.out.Fd()))
+	s.setVar(*name+"_PID", fmt.Sprint(cmd.Process.Pid))
+	fmt.Fprintf(std.err, "[%s] %d\n", *name, cmd.Process.Pid)
+	return nil
+}
+
+// close releases the pipes of a finished coprocess.
+func (cp *coproc) close() {
+	closeFiles([]*os.File{cp.in, cp.out})
+}
@@ -0,0 +1,100 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// suggestCommand returns the alias, function, builtin or PATH executable
+// closest to name, if one is within an edit distance of 2 (1 for names of up
+// to 3 characters).
+func (s *Shell) suggestCommand(name string) (string, bool) {
+	maxDistance := 2
+	if len(name) <= 3 {
+		maxDistance = 1
+	}
+
+	executables := s.pathExecutables()
+	candidates := append(executables[:len(executables):len(executables)], s.builtinCommandNames()...)
+	for name := range s.aliases {
+		candidates = append(candidates, name)
+	}
+	for name := range s.functions {
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
+
+// correctCommand is called when name isn't found. It offers the closest
+// command instead, or picks it right away with `set -o autocorrect`, and
+// returns the command to run if there is one.
+func (s *Shell) correctCommand(name string) (string, bool) {
+	suggestion, ok := s.suggestCommand(name)
+	// a script has nobody to answer
+	if !ok || !s.interactive {
+		fmt.Fprintln(s.Stderr, "gosh: command not found:", name)
+		return "", false
+	}
+	if s.option("autocorrect") {
+		fmt.Fprintf(s.Stderr, "gosh: correcting '%s' to '%s'\n", name, suggestion)
+		return suggestion, true
+	}
+	fmt.Fprintf(s.Stderr, "gosh: command not found: %s, did you mean '%s'? [y/N] ", name, suggestion)
+	return suggestion, s.readYes()
+}
+
+// editDistance is the optimal string alignment distance between a and b: the
+// number of insertions, deletions, substitutions and transpositions of
+// adjacent characters turning one into the other.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// runAlias runs the alias name, picked by the correction after the line was
+// parsed, with args after its text.
+func (s *Shell) runAlias(name string, args []string, std *stdio) {
+	words := []string{name}
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	list, err := parser.ParseAliases(strings.Join(words, " "), s.aliases)
+	if err != nil {
+		fmt.Fprintln(std.err, "gosh:", err)
+		s.lastStatus = 2
+		return
+	}
+	defer func(saved *stdio) { s.std = saved }(s.std)
+	s.std = std
+	s.runList(list)
+}
@@ -0,0 +1,247 @@
+package shell
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	dirEnvFilename      = ".gosh.env"
+	dirEnvAllowFilename = ".gosh_env_allowed"
+)
+
+// dirEnv tracks the .gosh.env file loaded for the working directory, and
+// the values its variables had before, so that leaving the directory
+// restores them.
+type dirEnv struct {
+	allowPath string
+	file      string
+	saved     map[string]*string
+}
+
+// findDirEnv returns the .gosh.env file of dir or its nearest parent.
+func findDirEnv(dir string) string {
+	for {
+		file := path.Join(dir, dirEnvFilename)
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return file
+		}
+		if dir == "/" {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// dirEnvChpwd is the chpwd hook switching environments when the working
+// directory moves in or out of a directory with a .gosh.env file.
+func (s *Shell) dirEnvChpwd(oldDir, newDir string) {
+	file := findDirEnv(newDir)
+	if file == s.dirEnv.file {
+		return
+	}
+	s.unloadDirEnv()
+	if file == "" {
+		return
+	}
+	if !s.dirEnv.allowed(file) {
+		fmt.Fprintf(s.Stderr, "gosh: %s is not allowed, run `env allow` to load it\n", file)
+		return
+	}
+	if err := s.loadDirEnv(file); err != nil {
+		fmt.Fprintf(s.Stderr, "gosh: %s: %v\n", file, err)
+	}
+}
+
+func (s *Shell) loadDirEnv(file string) error {
+	vars, err := parseDirEnv(file)
+	if err != nil {
+		return err
+	}
+	s.dirEnv.file = file
+	s.dirEnv.saved = make(map[string]*string)
+	var names []string
+	for _, v := range vars {
+		if _, ok := s.dirEnv.saved[v[0]]; !ok {
+			if old, set := s.env[v[0]]; set {
+				s.dirEnv.saved[v[0]] = &old
+			} else {
+				s.dirEnv.saved[v[0]] = nil
+			}
+			names = append(names, v[0])
+		}
+		s.env[v[0]] = os.Expand(v[1], func(name string) string { return s.env[name] })
+	}
+	fmt.Fprintf(s.Stderr, "gosh: loaded %s: %s\n", file, strings.Join(names, " "))
+	return nil
+}
+
+func (s *Shell) unloadDirEnv() {
+	if s.dirEnv.file == "" {
+		return
+	}
+	for name, old := range s.dirEnv.saved {
+		if old == nil {
+			delete(s.env, name)
+		} else {
+			s.env[name] = *old
+		}
+	}
+	fmt.Fprintf(s.Stderr, "gosh: unloaded %s\n", s.dirEnv.file)
+	s.dirEnv.file = ""
+	s.dirEnv.saved = nil
+}
+
+// parseDirEnv reads NAME=value lines, optionally prefixed with export.
+// Values may be quoted and refer to other variables as $NAME.
+func parseDirEnv(file string) ([][2]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || !isVarName(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", n)
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, [2]string{name, value})
+	}
+	return vars, scanner.Err()
+}
+
+func isVarName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// allowed reports whether file was allowed with its current content; editing
+// a .gosh.env file requires allowing it again.
+func (d *dirEnv) allowed(file string) bool {
+	sum, err := hashFile(file)
+	if err != nil {
+		return false
+	}
+	allowed, _ := d.readAllowList()
+	return allowed[file] == sum
+}
+
+func (d *dirEnv) readAllowList() (map[string]string, error) {
+	allowed := make(map[string]string)
+	data, err := os.ReadFile(d.allowPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if sum, file, ok := strings.Cut(line, " "); ok {
+			allowed[file] = sum
+		}
+	}
+	return allowed, nil
+}
+
+// setAllowed adds or removes file from the allow list.
+func (d *dirEnv) setAllowed(file string, allow bool) error {
+	allowed, err := d.readAllowList()
+	if err != nil {
+		return err
+	}
+	if allow {
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		allowed[file] = sum
+	} else {
+		delete(allowed, file)
+	}
+
+	var b strings.Builder
+	for file, sum := range allowed {
+		fmt.Fprintf(&b, "%s %s\n", sum, file)
+	}
+	return os.WriteFile(d.allowPath, []byte(b.String()), 0o600)
+}
+
+func hashFile(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// isDirEnvCommand reports whether an env command line is handled by the
+// builtin rather than the external env.
+func isDirEnvCommand(args []string) bool {
+	return len(args) > 0 && (args[0] == "allow" || args[0] == "deny" || args[0] == "reload")
+}
+
+// builtinDirEnv implements the trust step for .gosh.env files:
+//
+//	env allow [DIR]     trust the .gosh.env file of DIR and load it
+//	env deny [DIR]      stop trusting it, unloading it if loaded
+//	env reload          load the current .gosh.env file again
+//
+// Any other use of env runs the external command.
+func (s *Shell) builtinDirEnv(args []string, std *stdio) error {
+	file := findDirEnv(s.workingDir)
+	if len(args) > 1 {
+		dir := args[1]
+		if !path.IsAbs(dir) {
+			dir = path.Join(s.workingDir, dir)
+		}
+		file = findDirEnv(dir)
+	}
+	if file == "" {
+		return fmt.Errorf("no %s file found", dirEnvFilename)
+	}
+
+	switch args[0] {
+	case "allow":
+		if err := s.dirEnv.setAllowed(file, true); err != nil {
+			return err
+		}
+	case "deny":
+		if err := s.dirEnv.setAllowed(file, false); err != nil {
+			return err
+		}
+		if file == s.dirEnv.file {
+			s.unloadDirEnv()
+		}
+		return nil
+	}
+
+	// (re)load what applies to the working directory
+	s.unloadDirEnv()
+	s.dirEnvChpwd("", s.workingDir)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Package shell is gosh, an interactive shell that Go programs can embed as
+// a REPL on a terminal or as a command runner:
+//
+//	sh, err := shell.NewShell(shell.WithStdout(&out))
+//	if err != nil {
+//		return err
+//	}
+//	status, err := sh.Eval("cd /tmp && ls *.log | wc -l")
+//
+// Programs add their own commands with Register, and Tab completions with
+// RegisterCompleter. The exit builtin doesn't end the process: it stops
+// the commands, and Eval returns ErrExit with its status.
+package shell
+
+import (
+	"errors"
+	"io"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// An Option configures a Shell made by NewShell.
+type Option func(*Shell)
+
+// WithConfig gives the shell the startup settings of the gosh command line.
+func WithConfig(cfg Config) Option {
+	return func(s *Shell) {
+		s.config = cfg
+	}
+}
+
+// WithStdin makes the shell read its commands, and the commands it runs
+// their input, from r rather than os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(s *Shell) {
+		s.Stdin = r
+	}
+}
+
+// WithStdout makes the commands the shell runs write their output to w
+// rather than os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(s *Shell) {
+		s.Stdout = w
+	}
+}
+
+// WithStderr makes the commands the shell runs write their errors to w
+// rather than os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(s *Shell) {
+		s.Stderr = w
+	}
+}
+
+// ErrExit is the error of Eval and Run when the commands ran exit. The
+// shell has shut down then, running its EXIT trap, and their status is the
+// one exit was given.
+var ErrExit = errors.New("exit")
+
+// Eval runs input, a command line or a whole script, and returns the exit
+// status of its last command. The error is the *parser.Error input has when
+// it can't be parsed, in which case nothing runs and the status is 2, or
+// ErrExit.
+func (s *Shell) Eval(input string) (int, error) {
+	list, err := parser.ParseAliases(input, s.aliases)
+	if err != nil {
+		s.lastStatus = 2
+		return s.lastStatus, err
+	}
+	s.runList(list)
+	if s.exiting {
+		return s.shutdown(), ErrExit
+	}
+	return s.lastStatus, nil
+}
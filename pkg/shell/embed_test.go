@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEvalExit(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantStatus int
+		wantErr    error
+		want       string
+	}{
+		{"exit 3; echo no", 3, ErrExit, ""},
+		{"false; exit", 1, ErrExit, ""},
+		{"f() { exit 4; echo no; }; f; echo no", 4, ErrExit, ""},
+		{"if true; then exit 5; fi; echo no", 5, ErrExit, ""},
+		{"trap 'echo bye $?' EXIT; exit 6", 6, ErrExit, "bye 6\n"},
+		{"trap 'exit 8' EXIT; exit 7", 8, ErrExit, ""},
+		// a pipeline stage only leaves its subshell
+		{"exit 9 | cat; echo $?", 0, nil, "0\n"},
+		{"echo yes | { exit 2; }; echo $?", 0, nil, "2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newTestShell(t, &out)
+			status, err := s.Eval(tt.line)
+			if status != tt.wantStatus || !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %d, %v, want %d, %v", status, err, tt.wantStatus, tt.wantErr)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalAfterExit(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	if _, err := s.Eval("exit 1"); !errors.Is(err, ErrExit) {
+		t.Fatalf("got %v, want ErrExit", err)
+	}
+	if status, err := s.Eval("echo again"); status != 0 || err != nil {
+		t.Errorf("got %d, %v, want 0, nil", status, err)
+	}
+	if got := out.String(); got != "again\n" {
+		t.Errorf("got %q, want %q", got, "again\n")
+	}
+}
+
+// Shells keep their environment to themselves, leaving the one of the
+// process, and of the other shells, alone.
+func TestEvalEnvironment(t *testing.T) {
+	t.Setenv("X", "host")
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	other := newTestShell(t, &out)
+	if _, err := s.Eval("export X=1 Y=2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("X"); got != "host" {
+		t.Errorf("got X=%q in the process, want %q", got, "host")
+	}
+	if _, set := os.LookupEnv("Y"); set {
+		t.Error("got Y set in the process")
+	}
+	other.Eval("echo $X $Y")
+	if got, want := out.String(), "host\n"; got != want {
+		t.Errorf("got %q from the other shell, want %q", got, want)
+	}
+
+	// the commands get the environment of the shell, assignments ahead of
+	// them included
+	out.Reset()
+	s.Eval("FOO=bar env")
+	if env := "\n" + out.String(); !strings.Contains(env, "\nX=1\n") || !strings.Contains(env, "\nFOO=bar\n") {
+		t.Errorf("got environment %q, want X=1 and FOO=bar in it", out.String())
+	}
+	out.Reset()
+	s.Eval("sh -c 'echo $X $Y'")
+	if got, want := out.String(), "1 2\n"; got != want {
+		t.Errorf("got %q from sh, want %q", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package shell
+
+import (
+	"os"
+)
+
+// execHelperArg0 is the argv[0] gosh re-executes itself with when a command
+// needs setup that os/exec cannot do between fork and exec (entering
+// namespaces, installing seccomp filters, ...). The helper applies the
+// execSpec and then execs the real command in place.
+const execHelperArg0 = "gosh-exec-helper"
+
+// execSpec is handed to the exec helper as its first argument, JSON encoded.
+type execSpec struct {
+	Sandbox  *sandboxConfig  `json:"sandbox,omitempty"`
+	Limits   *limitsConfig   `json:"limits,omitempty"`
+	Priority *priorityConfig `json:"priority,omitempty"`
+}
+
+// IsExecHelper reports whether the current process was started as the exec
+// helper and should call RunExecHelper instead of starting a shell.
+func IsExecHelper() bool {
+	return len(os.Args) > 0 && os.Args[0] == execHelperArg0
+}
@@ -0,0 +1,211 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// wrapExecHelper rewrites cmd to run through the exec helper, letting update
+// fill in the execSpec. Wrapping an already wrapped command updates its spec.
+func wrapExecHelper(cmd *exec.Cmd, update func(*execSpec)) error {
+	if cmd.Err != nil {
+		// leave the lookup error for Start to report
+		return nil
+	}
+
+	spec := &execSpec{}
+	if len(cmd.Args) > 1 && cmd.Args[0] == execHelperArg0 {
+		if err := json.Unmarshal([]byte(cmd.Args[1]), spec); err != nil {
+			return err
+		}
+		cmd.Args = cmd.Args[2:]
+	} else {
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		cmd.Args = append([]string{cmd.Path}, cmd.Args...)
+		cmd.Path = self
+	}
+
+	update(spec)
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{execHelperArg0, string(data)}, cmd.Args...)
+	return nil
+}
+
+// wrapSandbox makes cmd run inside fresh namespaces as described by cfg.
+func wrapSandbox(cmd *exec.Cmd, cfg *sandboxConfig) error {
+	err := wrapExecHelper(cmd, func(spec *execSpec) {
+		spec.Sandbox = cfg
+	})
+	if err != nil || cmd.Err != nil {
+		return err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	// an unprivileged user namespace is what allows creating the others
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	if cfg.NoNet {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	return nil
+}
+
+// wrapLimits makes cmd run with the resource limits in cfg. The returned
+// function releases what was set up for the command once it has finished.
+func wrapLimits(cmd *exec.Cmd, cfg *limitsConfig) (func(), error) {
+	rlimits := *cfg
+	cleanup := func() {}
+
+	if cfg.Cgroup && cmd.Err == nil {
+		dir, f, err := newCgroup(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cgroup: %w", err)
+		}
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(f.Fd())
+		cleanup = func() {
+			f.Close()
+			os.Remove(dir)
+		}
+		// the cgroup takes care of these
+		rlimits.Memory, rlimits.Procs = 0, 0
+	}
+
+	if rlimits.enabled() {
+		err := wrapExecHelper(cmd, func(spec *execSpec) {
+			spec.Limits = &rlimits
+		})
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	return cleanup, nil
+}
+
+// wrapPriority makes cmd run with the CPU and I/O priority in cfg.
+func wrapPriority(cmd *exec.Cmd, cfg *priorityConfig) error {
+	return wrapExecHelper(cmd, func(spec *execSpec) {
+		spec.Priority = cfg
+	})
+}
+
+// RunExecHelper applies the execSpec passed by the parent shell and replaces
+// the process with the target command. It never returns.
+func RunExecHelper() {
+	// prctl and seccomp settings are per thread, and exec must happen on the
+	// thread that received them
+	runtime.LockOSThread()
+
+	if len(os.Args) < 4 {
+		helperFail("exec helper: missing arguments")
+	}
+	spec := &execSpec{}
+	if err := json.Unmarshal([]byte(os.Args[1]), spec); err != nil {
+		helperFail("exec helper: %v", err)
+	}
+	path, argv := os.Args[2], os.Args[3:]
+
+	if spec.Limits != nil {
+		if err := spec.Limits.apply(); err != nil {
+			helperFail("limit: %v", err)
+		}
+	}
+	if spec.Priority != nil {
+		if err := spec.Priority.apply(); err != nil {
+			helperFail("lowprio: %v", err)
+		}
+	}
+	if spec.Sandbox != nil {
+		if err := spec.Sandbox.apply(); err != nil {
+			helperFail("sandbox: %v", err)
+		}
+	}
+
+	err := syscall.Exec(path, argv, os.Environ())
+	helperFail("%s: %v", path, err)
+}
+
+func helperFail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "gosh: "+format+"\n", args...)
+	os.Exit(126)
+}
+
+// apply sets the rlimits in the helper, to be inherited by the command.
+func (c *limitsConfig) apply() error {
+	set := func(resource int, soft, hard uint64) error {
+		return unix.Setrlimit(resource, &unix.Rlimit{Cur: soft, Max: hard})
+	}
+	if c.CPU > 0 {
+		// a second of slack between SIGXCPU and SIGKILL
+		seconds := uint64((c.CPU + time.Second - 1) / time.Second)
+		if err := set(unix.RLIMIT_CPU, seconds, seconds+1); err != nil {
+			return err
+		}
+	}
+	if c.Memory > 0 {
+		if err := set(unix.RLIMIT_AS, uint64(c.Memory), uint64(c.Memory)); err != nil {
+			return err
+		}
+	}
+	if c.Procs > 0 {
+		if err := set(unix.RLIMIT_NPROC, uint64(c.Procs), uint64(c.Procs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply sets the priority of the helper, to be inherited by the command.
+func (c *priorityConfig) apply() error {
+	if err := unix.Setpriority(unix.PRIO_PROCESS, 0, c.Nice); err != nil {
+		return fmt.Errorf("setting niceness: %w", err)
+	}
+	const ioprioWhoProcess = 1
+	ioprio := c.IOClass<<13 | c.IOLevel
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(ioprio)); errno != 0 {
+		return fmt.Errorf("setting I/O priority: %w", errno)
+	}
+	return nil
+}
+
+// apply runs inside the helper, after the namespaces have been entered.
+func (c *sandboxConfig) apply() error {
+	if c.ReadOnly {
+		// keep our mount changes from propagating back to the host
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("making mounts private: %w", err)
+		}
+		attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+		if err := unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE, attr); err != nil {
+			return fmt.Errorf("remounting / read-only: %w", err)
+		}
+	}
+	if c.Seccomp != "" {
+		if err := installSeccomp(c.Seccomp); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+	}
+	return nil
+}
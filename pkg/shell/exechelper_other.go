@@ -0,0 +1,28 @@
+//go:build !linux
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func wrapSandbox(cmd *exec.Cmd, cfg *sandboxConfig) error {
+	return errors.New("sandboxing is only supported on Linux")
+}
+
+func wrapLimits(cmd *exec.Cmd, cfg *limitsConfig) (func(), error) {
+	return nil, errors.New("resource limits are only supported on Linux")
+}
+
+func wrapPriority(cmd *exec.Cmd, cfg *priorityConfig) error {
+	return errors.New("lowprio is only supported on Linux")
+}
+
+// RunExecHelper is only reachable on Linux, where commands get wrapped.
+func RunExecHelper() {
+	fmt.Fprintln(os.Stderr, "gosh: exec helper is not supported on this platform")
+	os.Exit(126)
+}
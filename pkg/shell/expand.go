@@ -0,0 +1,289 @@
+package shell
+
+import (
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// expandVars replaces the $NAME and ${NAME} references in word with the
+// values of the variables, in text that isn't parsed, like the line shown by
+// shell-expand-line. A $ that doesn't start a reference is kept.
+func (s *Shell) expandVars(word string) string {
+	if !strings.Contains(word, "$") {
+		return word
+	}
+	var b strings.Builder
+	for i := 0; i < len(word); i++ {
+		if word[i] != '$' || i+1 == len(word) {
+			b.WriteByte(word[i])
+			continue
+		}
+		if word[i+1] == '{' {
+			end := strings.IndexByte(word[i+2:], '}')
+			if end >= 0 && isVarName(word[i+2:i+2+end]) {
+				b.WriteString(s.getVar(word[i+2 : i+2+end]))
+				i += 2 + end
+				continue
+			}
+			b.WriteByte('$')
+			continue
+		}
+		j := i + 1
+		for j < len(word) && isVarName(word[i+1:j+1]) {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString(s.getVar(word[i+1 : j]))
+		i = j - 1
+	}
+	return b.String()
+}
+
+// expandWord returns the text of w, with its variables expanded and its
+// quotes removed.
+func (s *Shell) expandWord(w *parser.Word) string {
+	var b strings.Builder
+	s.expandParts(&b, w.Parts)
+	return b.String()
+}
+
+func (s *Shell) expandParts(b *strings.Builder, parts []parser.WordPart) {
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *parser.Lit:
+			b.WriteString(part.Value)
+		case *parser.Escaped:
+			b.WriteString(part.Value)
+		case *parser.SglQuoted:
+			b.WriteString(part.Value)
+		case *parser.DblQuoted:
+			s.expandParts(b, part.Parts)
+		case *parser.ParamExp:
+			b.WriteString(s.expandParam(part))
+		case *parser.CmdSubst:
+			b.WriteString(s.commandSubst(part))
+		case *parser.TildeExp:
+			b.WriteString(s.homeDir(part.User))
+		case *parser.BraceExp:
+			// only arguments are brace expanded, not assignments
+			b.WriteString(part.String())
+		}
+	}
+}
+
+// expandParam returns the value of a parameter expansion:
+//
+//	${NAME-word}  word if NAME is unset, else its value
+//	${NAME=word}  the same, assigning word to NAME when it is unset
+//	${NAME+word}  word if NAME is set, else nothing
+//
+// With a colon before the operator, as in ${NAME:-word}, a NAME set to ""
+// counts as unset too. word is only expanded when it is used.
+func (s *Shell) expandParam(param *parser.ParamExp) string {
+	value, set := s.lookupVar(param.Name)
+	if param.Op == "" {
+		return value
+	}
+	if strings.HasPrefix(param.Op, ":") && value == "" {
+		set = false
+	}
+	switch strings.TrimPrefix(param.Op, ":") {
+	case "-":
+		if !set {
+			return s.expandWord(param.Word)
+		}
+	case "=":
+		if !set {
+			value = s.expandWord(param.Word)
+			// special parameters can't be assigned to
+			if isVarName(param.Name) {
+				s.setVar(param.Name, value)
+			}
+		}
+	case "+":
+		if !set {
+			return ""
+		}
+		return s.expandWord(param.Word)
+	}
+	return value
+}
+
+// homeDir returns the home directory of name, or $HOME for "", which ~ and
+// ~name expand to. A user that doesn't exist leaves ~name as it is.
+func (s *Shell) homeDir(name string) string {
+	var u *user.User
+	var err error
+	if name == "" {
+		if home := s.getVar("HOME"); home != "" {
+			return home
+		}
+		u, err = user.Current()
+	} else {
+		u, err = user.Lookup(name)
+	}
+	if err != nil {
+		return "~" + name
+	}
+	return u.HomeDir
+}
+
+// expandFields expands the words of a command into its arguments. Brace
+// expansions make several words of one, and so do unquoted command
+// substitutions, whose output is split at the characters of $IFS. Unquoted
+// fields that expand to nothing, like references to empty variables, are
+// dropped, as in other shells. Fields that are patterns are replaced with
+// the paths they match, or kept as they are when there are none.
+func (s *Shell) expandFields(words []*parser.Word) []string {
+	expanded := make([]string, 0, len(words))
+	var braced []*parser.Word
+	for _, w := range words {
+		braced = append(braced, expandBraces(w)...)
+	}
+	for _, w := range braced {
+		for _, f := range s.splitFields(w) {
+			if hasGlobMeta(f.pattern) && !s.option("noglob") {
+				if matches := glob(s.workingDir, f.pattern, s.globDepth()); len(matches) > 0 {
+					expanded = append(expanded, matches...)
+					continue
+				}
+				if s.option("nullglob") {
+					continue
+				}
+			}
+			if f.value == "" && !f.quoted {
+				continue
+			}
+			expanded = append(expanded, f.value)
+		}
+	}
+	return expanded
+}
+
+// globDepth returns how many directories deep ** goes, from GOSH_GLOB_DEPTH,
+// or 0 for no limit.
+func (s *Shell) globDepth() int {
+	n, err := strconv.Atoi(s.getVar("GOSH_GLOB_DEPTH"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// field is an argument a word expands to, with the pattern it is, in which
+// only the *, ? and [ of unquoted text, variables and command substitutions
+// are special.
+type field struct {
+	value   string
+	pattern string
+	quoted  bool // has quoted parts, which keep it even when it is empty
+}
+
+// splitFields expands w into its fields: one, unless it has unquoted command
+// substitutions, or $@, which makes a field of each positional parameter,
+// quoted or not, like $* unquoted.
+func (s *Shell) splitFields(w *parser.Word) []field {
+	var fields []field
+	var cur field
+	// addWords adds the first of words to the current field, and starts a
+	// field with each of the others
+	addWords := func(words []string, quoted bool) {
+		for i, word := range words {
+			if i > 0 {
+				fields = append(fields, cur)
+				cur = field{}
+			}
+			cur.value += word
+			if quoted {
+				cur.pattern += globEscape(word)
+				cur.quoted = true
+			} else {
+				cur.pattern += strings.ReplaceAll(word, `\`, `\\`)
+			}
+		}
+	}
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *parser.CmdSubst:
+			out := s.commandSubst(part)
+			ifs, set := s.lookupVar("IFS")
+			if !set {
+				ifs = " \t\n"
+			}
+			isIFS := func(r rune) bool { return strings.ContainsRune(ifs, r) }
+			words := strings.FieldsFunc(out, isIFS)
+			if strings.TrimLeftFunc(out, isIFS) != out {
+				fields = append(fields, cur)
+				cur = field{}
+			}
+			addWords(words, false)
+			if len(words) > 0 && strings.TrimRightFunc(out, isIFS) != out {
+				fields = append(fields, cur)
+				cur = field{}
+			}
+			continue
+		case *parser.ParamExp:
+			if isAllParams(part, false) {
+				addWords(s.positional, false)
+				continue
+			}
+		case *parser.DblQuoted:
+			// "" is a field too, but "$@" is none without parameters
+			cur.quoted = cur.quoted || len(part.Parts) == 0
+			for _, inner := range part.Parts {
+				if param, ok := inner.(*parser.ParamExp); ok && isAllParams(param, true) {
+					addWords(s.positional, true)
+					continue
+				}
+				var b strings.Builder
+				s.expandParts(&b, []parser.WordPart{inner})
+				addWords([]string{b.String()}, true)
+			}
+			continue
+		}
+
+		var b strings.Builder
+		s.expandParts(&b, []parser.WordPart{part})
+		text := b.String()
+		cur.value += text
+		switch part.(type) {
+		case *parser.Lit, *parser.ParamExp:
+			cur.pattern += strings.ReplaceAll(text, `\`, `\\`)
+		case *parser.TildeExp, *parser.BraceExp:
+			cur.pattern += globEscape(text)
+		default:
+			cur.pattern += globEscape(text)
+			cur.quoted = true
+		}
+	}
+	return append(fields, cur)
+}
+
+// expandPattern expands w into a pattern, in which only the *, ? and [ of
+// unquoted text, variables and command substitutions are special.
+func (s *Shell) expandPattern(w *parser.Word) string {
+	var pattern strings.Builder
+	for _, part := range w.Parts {
+		var b strings.Builder
+		s.expandParts(&b, []parser.WordPart{part})
+		switch part.(type) {
+		case *parser.Lit, *parser.ParamExp, *parser.CmdSubst:
+			pattern.WriteString(strings.ReplaceAll(b.String(), `\`, `\\`))
+		default:
+			pattern.WriteString(globEscape(b.String()))
+		}
+	}
+	return pattern.String()
+}
+
+// isAllParams reports whether param is $@, or $* outside of double quotes,
+// which expand to a word for each positional parameter.
+func isAllParams(param *parser.ParamExp, quoted bool) bool {
+	return param.Op == "" && (param.Name == "@" || param.Name == "*" && !quoted)
+}
@@ -0,0 +1,131 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The environment of gosh is the one commands get: exported variables live
+// in s.env, and shell variables in s.vars, which commands don't see. It
+// starts as a copy of the process environment, which the shell leaves alone,
+// so that shells embedded in a program don't share one.
+
+func init() {
+	addBuiltin("export", "export [-n] [-p] [NAME[=VALUE] ...]", "move variables to the environment, or back", (*Shell).builtinExport)
+	addBuiltin("unset", "unset [-v] [-f] NAME ...", "remove variables or functions", (*Shell).builtinUnset)
+}
+
+// builtinExport implements `export [-n] [-p] [NAME[=value] ...]`. It moves
+// the variables to the environment, assigning them first when given a
+// value; -n moves them back to shell variables. Without names, it lists the
+// environment.
+func (s *Shell) builtinExport(args []string, std *stdio) error {
+	unexport := false
+	for len(args) > 0 && (args[0] == "-n" || args[0] == "-p") {
+		unexport = unexport || args[0] == "-n"
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		for _, kv := range s.environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			fmt.Fprintf(std.out, "export %s=%s\n", name, shellQuote(value))
+		}
+		return nil
+	}
+
+	var failed error
+	for _, arg := range args {
+		name, value, assign := strings.Cut(arg, "=")
+		if !isVarName(name) {
+			fmt.Fprintf(std.err, "export: %s: not a valid identifier\n", arg)
+			failed = exitStatus(1)
+			continue
+		}
+		if !assign {
+			// a name that isn't set has nothing to export
+			var set bool
+			if value, set = s.lookupVar(name); !set {
+				continue
+			}
+		}
+		if unexport {
+			delete(s.env, name)
+			s.vars[name] = value
+			continue
+		}
+		s.exportVar(name, value)
+	}
+	return failed
+}
+
+// builtinUnset implements `unset [-v] NAME ...`, which removes shell and
+// environment variables alike, and `unset -f NAME ...`, which removes
+// functions.
+func (s *Shell) builtinUnset(args []string, std *stdio) error {
+	if len(args) > 0 && args[0] == "-f" {
+		for _, name := range args[1:] {
+			delete(s.functions, name)
+		}
+		return nil
+	}
+	if len(args) > 0 && args[0] == "-v" {
+		args = args[1:]
+	}
+	var failed error
+	for _, name := range args {
+		if _, dynamic := dynamicVars[name]; dynamic || !isVarName(name) {
+			fmt.Fprintf(std.err, "unset: %s: cannot unset\n", name)
+			failed = exitStatus(1)
+			continue
+		}
+		delete(s.vars, name)
+		delete(s.env, name)
+	}
+	return failed
+}
+
+// builtinEnv implements env without arguments: it prints the environment
+// commands are run with.
+func (s *Shell) builtinEnv(std *stdio) {
+	for _, kv := range s.environ() {
+		fmt.Fprintln(std.out, kv)
+	}
+}
+
+// exportVar sets a variable in the environment, moving it out of the shell
+// variables.
+func (s *Shell) exportVar(name, value string) {
+	delete(s.vars, name)
+	s.env[name] = value
+}
+
+// environ returns the environment as NAME=value strings, sorted.
+func (s *Shell) environ() []string {
+	env := make([]string, 0, len(s.env))
+	for name, value := range s.env {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// environMap returns the NAME=value strings of environ as a map.
+func environMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// shellQuote quotes value with single quotes when the shell would read it
+// differently as it is.
+func shellQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\\'\"$;&|<>#*?[]{}()~`!") {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// callFunction runs the body of fn reading and writing std, with args as the
+// positional parameters, setting the exit status. The variables it declares
+// local are put back as they were once it is done.
+func (s *Shell) callFunction(fn *parser.FuncDecl, args []string, std *stdio) {
+	defer func(positional []string) { s.positional = positional }(s.positional)
+	s.positional = args
+	defer func(saved *stdio) { s.std = saved }(s.std)
+	s.std = std
+	// the statements of the body are on the lines of the definition
+	defer func(line int) { s.line = line }(s.line)
+
+	s.locals = append(s.locals, nil)
+	defer func() {
+		frame := s.locals[len(s.locals)-1]
+		s.locals = s.locals[:len(s.locals)-1]
+		// in reverse, in case a name was declared twice
+		for i := len(frame) - 1; i >= 0; i-- {
+			s.restoreVar(frame[i])
+		}
+	}()
+	s.runCompound(fn.Body)
+	s.returning = false
+}
+
+func init() {
+	addBuiltin("local", "local NAME[=VALUE] ...", "give the function running variables of its own", (*Shell).builtinLocal)
+	addBuiltin("return", "return [N]", "leave a function or a sourced file with status N", (*Shell).builtinReturn)
+}
+
+// builtinLocal implements `local NAME[=VALUE] ...`, which gives the function
+// running variables of its own: they are set to VALUE, or unset, until it
+// returns, and the functions it calls see them too.
+func (s *Shell) builtinLocal(args []string, std *stdio) error {
+	if len(s.locals) == 0 {
+		return errors.New("can only be used in a function")
+	}
+	frame := &s.locals[len(s.locals)-1]
+	var failed error
+	for _, arg := range args {
+		name, value, assign := strings.Cut(arg, "=")
+		if !isVarName(name) {
+			fmt.Fprintf(std.err, "local: %s: not a valid identifier\n", arg)
+			failed = exitStatus(1)
+			continue
+		}
+		if !slices.ContainsFunc(*frame, func(v savedVar) bool { return v.name == name }) {
+			*frame = append(*frame, s.saveVar(name))
+		}
+		if assign {
+			s.setVar(name, value)
+		} else {
+			delete(s.vars, name)
+			delete(s.env, name)
+		}
+	}
+	return failed
+}
+
+// builtinReturn implements `return [N]`, which leaves the function running,
+// or the file being sourced, with status N, or the last status.
+func (s *Shell) builtinReturn(args []string, std *stdio) error {
+	if len(s.locals) == 0 && s.sourceDepth == 0 {
+		return errors.New("can only return from a function or a sourced file")
+	}
+	status := s.lastStatus
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("%s: numeric argument required", args[0])
+		}
+		status = n & 0xff
+	}
+	s.returning = true
+	if status != 0 {
+		return exitStatus(status)
+	}
+	return nil
+}
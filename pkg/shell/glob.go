@@ -0,0 +1,270 @@
+package shell
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// glob returns the paths matching pattern, in the form pattern has them:
+// the relative ones are relative to dir. In pattern, only the *, ? and [...]
+// that aren't escaped with a backslash are special, and they match neither
+// a slash nor the leading dot of a name. A ** path element matches any
+// number of directories, down to maxDepth levels when it isn't 0.
+func glob(dir, pattern string, maxDepth int) []string {
+	matches := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		matches = []string{"/"}
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if elem == "**" && i > 0 && elems[i-1] == "**" {
+			continue
+		}
+		var next []string
+		for _, match := range matches {
+			if elem == "**" {
+				next = append(next, globTree(dir, match, maxDepth, i == len(elems)-1)...)
+			} else {
+				next = append(next, globElem(dir, match, elem)...)
+			}
+		}
+		matches = next
+		if len(matches) == 0 {
+			return nil
+		}
+	}
+	return matches
+}
+
+// globTree returns the directories under prefix, after prefix itself, that
+// a ** stands for, or all the files and directories under it when the **
+// ends the pattern. The walk skips hidden and unreadable directories and
+// doesn't follow links, so that huge trees stay fast to match, and goes
+// maxDepth levels deep at most when it isn't 0.
+func globTree(dir, prefix string, maxDepth int, all bool) []string {
+	var matches []string
+	if !all {
+		matches = append(matches, prefix)
+	}
+	root := resolvePath(dir, prefix)
+	filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if p == root {
+			return err
+		}
+		if err != nil {
+			// a directory that can't be read is left out
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		tooDeep := maxDepth > 0 && strings.Count(rel, "/") >= maxDepth
+		if entry.Name()[0] == '.' || tooDeep {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || all {
+			matches = append(matches, joinGlobPath(prefix, rel))
+		}
+		return nil
+	})
+	return matches
+}
+
+// joinGlobPath joins name to prefix, a path matched by a pattern, keeping
+// the slashes it ends with.
+func joinGlobPath(prefix, name string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix + name
+	}
+	return prefix + "/" + name
+}
+
+// globElem returns the paths in the directory prefix matching elem, a path
+// element of a pattern, joined to prefix.
+func globElem(dir, prefix, elem string) []string {
+	switch {
+	case elem == "":
+		// after a slash ending the pattern, or one of several in a row,
+		// only a directory matches; not the current directory, which a
+		// leading ** stands for, as in **/
+		if prefix == "" {
+			return nil
+		}
+		if info, err := os.Stat(resolvePath(dir, prefix)); err != nil || !info.IsDir() {
+			return nil
+		}
+		return []string{prefix + "/"}
+	case !hasGlobMeta(elem):
+		name := joinGlobPath(prefix, globUnescape(elem))
+		if _, err := os.Lstat(resolvePath(dir, name)); err != nil {
+			return nil
+		}
+		return []string{name}
+	}
+
+	// directories that can't be read have nothing to match
+	entries, err := os.ReadDir(resolvePath(dir, prefix))
+	if err != nil {
+		return nil
+	}
+	elem = goPattern(elem)
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if name[0] == '.' && elem[0] != '.' {
+			continue
+		}
+		if ok, _ := path.Match(elem, name); ok {
+			matches = append(matches, joinGlobPath(prefix, name))
+		}
+	}
+	return matches
+}
+
+// matchPattern reports whether pattern matches all of s, as the patterns of
+// case do: unlike in paths, * and ? match slashes and leading dots too.
+func matchPattern(pattern, s string) bool {
+	var re strings.Builder
+	re.WriteString("^(?s:")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '*':
+			re.WriteString(".*")
+		case c == '?':
+			re.WriteString(".")
+		case c == '[' && classEnd(pattern, i) > 0:
+			end := classEnd(pattern, i)
+			re.WriteString(regexpClass(pattern[i+1 : end]))
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString(")$")
+	matched, err := regexp.MatchString(re.String(), s)
+	return err == nil && matched
+}
+
+// classEnd returns the index of the ] closing the [...] at pattern[start],
+// or -1 when it isn't closed. A ] right after the [ or [! is in the class.
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// regexpClass returns the regexp of the [...] pattern class made of class.
+func regexpClass(class string) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	if class[0] == '!' || class[0] == '^' {
+		b.WriteByte('^')
+		class = class[1:]
+	}
+	for i := 0; i < len(class); i++ {
+		c := class[i]
+		if c == '\\' && i+1 < len(class) {
+			i++
+			c = class[i]
+		}
+		if strings.IndexByte(`\[]^`, c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// resolvePath returns the path p refers to in dir.
+func resolvePath(dir, p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(dir, p)
+}
+
+// hasGlobMeta reports whether pattern has a *, ? or [ that isn't escaped.
+func hasGlobMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// globEscape escapes the characters special in patterns, for text taken
+// literally.
+func globEscape(text string) string {
+	if !strings.ContainsAny(text, `*?[\`) {
+		return text
+	}
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// globUnescape removes the backslashes from a pattern without special
+// characters.
+func globUnescape(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// goPattern rewrites the [!...] of shell patterns to the [^...] of
+// path.Match.
+func goPattern(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		b.WriteByte(pattern[i])
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteByte(pattern[i])
+		case pattern[i] == '[' && i+1 < len(pattern) && pattern[i+1] == '!':
+			b.WriteByte('^')
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"a", "b/c", ".hidden"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"f.go", "b/g.go", "b/c/h.go"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*/", []string{"a/", "b/"}},
+		// only the directories under the current one, never /
+		{"**/", []string{"a/", "b/", "b/c/"}},
+		{"**/*.go", []string{"f.go", "b/g.go", "b/c/h.go"}},
+		{"**", []string{"a", "b", "b/c", "b/c/h.go", "b/g.go", "f.go"}},
+		{"b/**/", []string{"b/", "b/c/"}},
+		{"*.go", []string{"f.go"}},
+		{"*.txt", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := glob(dir, tt.pattern, 0); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expandHistory replaces the history references of a line typed at the
+// prompt with what they refer to, as bash does with set -o histexpand:
+//
+//	!!      the previous command line
+//	!N      the line numbered N by history, and !-N the Nth one back
+//	!word   the last line starting with word, and !?word? one containing it
+//	!$      the last word of the previous line, !^ its first argument and !*
+//	        all of its arguments
+//
+// A '!' followed by a blank, '=', '(', a quote or an operator, or at the end
+// of the line, is left as it is, and so are those of $!, ${!...} and [!...],
+// and those quoted with '...' or a backslash. It reports whether the line
+// changed, and fails when a reference matches nothing.
+func (s *Shell) expandHistory(line string) (string, bool, error) {
+	var b strings.Builder
+	changed, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '\\' && !quoted && i+1 < len(line):
+			b.WriteByte(c)
+			i++
+			c = line[i]
+		case c == '!' && !quoted && i+1 < len(line) && !strings.ContainsRune(" \t\n=(\"';&|)<>", rune(line[i+1])) &&
+			!strings.HasSuffix(line[:i], "$") && !strings.HasSuffix(line[:i], "${") && !strings.HasSuffix(line[:i], "["):
+			text, n, err := s.historyEvent(line[i+1:])
+			if err != nil {
+				return "", false, err
+			}
+			b.WriteString(text)
+			i += n
+			changed = true
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), changed, nil
+}
+
+// historyEvent returns what the history reference at the start of ref, the
+// text after a '!', expands to, and the length of the reference.
+func (s *Shell) historyEvent(ref string) (string, int, error) {
+	previous := func() (*historyEntry, error) {
+		if len(s.history) == 0 {
+			return nil, fmt.Errorf("!%c: event not found", ref[0])
+		}
+		return s.history[len(s.history)-1], nil
+	}
+	switch ref[0] {
+	case '!':
+		entry, err := previous()
+		if err != nil {
+			return "", 0, err
+		}
+		return entry.Command, 1, nil
+	case '$', '^', '*':
+		entry, err := previous()
+		if err != nil {
+			return "", 0, err
+		}
+		words := historyWords(entry.Command)
+		switch {
+		case ref[0] == '$':
+			return words[len(words)-1], 1, nil
+		case len(words) < 2 && ref[0] == '^':
+			return "", 0, fmt.Errorf("!^: bad word specifier")
+		case len(words) < 2:
+			return "", 1, nil
+		case ref[0] == '^':
+			return words[1], 1, nil
+		default:
+			return strings.Join(words[1:], " "), 1, nil
+		}
+	case '?':
+		word, _, closed := strings.Cut(ref[1:], "?")
+		n := len(word) + 1
+		if closed {
+			n++
+		}
+		for i := len(s.history) - 1; i >= 0; i-- {
+			if word != "" && strings.Contains(s.history[i].Command, word) {
+				return s.history[i].Command, n, nil
+			}
+		}
+		return "", 0, fmt.Errorf("!?%s: event not found", word)
+	}
+
+	end := strings.IndexAny(ref, " \t\n;&|()<>\"'")
+	if end < 0 {
+		end = len(ref)
+	}
+	word := ref[:end]
+	if n, err := strconv.Atoi(word); err == nil {
+		i := n - 1
+		if n < 0 {
+			i = len(s.history) + n
+		}
+		if i < 0 || i >= len(s.history) {
+			return "", 0, fmt.Errorf("!%s: event not found", word)
+		}
+		return s.history[i].Command, end, nil
+	}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if strings.HasPrefix(s.history[i].Command, word) {
+			return s.history[i].Command, end, nil
+		}
+	}
+	return "", 0, fmt.Errorf("!%s: event not found", word)
+}
+
+// historyWords splits a command line into its words, at the blanks outside
+// quotes, leaving the quotes in.
+func historyWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	var quote byte
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '\\' && i+1 < len(line):
+			word.WriteByte(c)
+			i++
+			c = line[i]
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		}
+		word.WriteByte(c)
+		inWord = true
+	}
+	if inWord || len(words) == 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
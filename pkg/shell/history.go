@@ -0,0 +1,388 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const historyFilename = ".gosh_history"
+
+// historyEntry is a command line in the history, along with what is known
+// about its execution.
+type historyEntry struct {
+	Command  string        `json:"cmd"`
+	Start    time.Time     `json:"start,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Rusage   *rusage       `json:"rusage,omitempty"`
+	Status   int           `json:"status,omitempty"`
+	Dir      string        `json:"cwd,omitempty"`
+}
+
+func (e *historyEntry) hasMetadata() bool {
+	return !e.Start.IsZero() || e.Duration > 0 || e.Rusage != nil || e.Status != 0 || e.Dir != ""
+}
+
+// loadHistory reads the history file. Entries are stored one per line, either
+// as the plain command line or, for entries saved with `set -o
+// extendedhistory`, as a JSON object carrying their metadata. Every session
+// appends to the file, so it has their entries in the order they ran.
+//
+// The sessions share the file under an advisory lock, held while they read
+// or write it. A file grown past $HISTFILESIZE lines loses the oldest ones,
+// and the history keeps the last $HISTSIZE.
+func (s *Shell) loadHistory() error {
+	f, err := os.OpenFile(s.historyFilepath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if keep := s.historySize("HISTFILESIZE"); keep >= 0 && len(lines) > keep {
+		lines = lines[len(lines)-keep:]
+		data = []byte(strings.Join(lines, "\n") + "\n")
+		if err := rewriteFile(f, data); err != nil {
+			return err
+		}
+	}
+	s.history = nil
+	for _, line := range lines {
+		s.history = append(s.history, parseHistoryLine(line))
+	}
+	s.history = trimHistory(s.history, s.historySize("HISTSIZE"))
+	s.historyRead, s.historyAppended = int64(len(data)), nil
+	return nil
+}
+
+// defaultHistorySize is how many entries the history and its file keep
+// without $HISTSIZE.
+const defaultHistorySize = 10000
+
+// historySize returns how many entries the variable name, HISTSIZE or
+// HISTFILESIZE, keeps, or -1 when it is negative, for no limit. Unset, or
+// not a number, it is defaultHistorySize, and HISTFILESIZE defaults to
+// HISTSIZE.
+func (s *Shell) historySize(name string) int {
+	value := s.getVar(name)
+	if value == "" && name == "HISTFILESIZE" {
+		return s.historySize("HISTSIZE")
+	}
+	n, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return defaultHistorySize
+	case n < 0:
+		return -1
+	}
+	return n
+}
+
+// trimHistory returns the last n of entries, or all of them for -1.
+func trimHistory(entries []*historyEntry, n int) []*historyEntry {
+	if n >= 0 && len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+	return entries
+}
+
+// rewriteFile replaces the content of f with data.
+func rewriteFile(f *os.File, data []byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt(data, 0)
+	return err
+}
+
+func parseHistoryLine(line string) *historyEntry {
+	if strings.HasPrefix(line, "{") {
+		entry := &historyEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err == nil && entry.Command != "" {
+			return entry
+		}
+	}
+	return &historyEntry{Command: line}
+}
+
+// saveHistory writes the history to the file, for `history -w`. What other
+// sessions appended to the file since this one read it is kept, merged with
+// the history by start time; the rest is replaced, so that the entries
+// cleared or deleted here are gone from the file.
+func (s *Shell) saveHistory() error {
+	f, err := os.OpenFile(s.historyFilepath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	// the file could have been rewritten by another session, in which case
+	// what is new in it isn't known
+	var others []*historyEntry
+	if int64(len(data)) >= s.historyRead {
+		for _, line := range strings.Split(string(data[s.historyRead:]), "\n") {
+			if s.historyAppended[line] > 0 {
+				s.historyAppended[line]--
+				continue
+			}
+			if line != "" {
+				others = append(others, parseHistoryLine(line))
+			}
+		}
+	}
+	s.history = trimHistory(mergeHistory(s.history, others), s.historySize("HISTSIZE"))
+
+	var b strings.Builder
+	for _, entry := range trimHistory(s.history, s.historySize("HISTFILESIZE")) {
+		b.WriteString(s.formatHistoryEntry(entry) + "\n")
+	}
+	if err := rewriteFile(f, []byte(b.String())); err != nil {
+		return err
+	}
+	s.historyRead, s.historyAppended = int64(b.Len()), nil
+	return nil
+}
+
+// mergeHistory merges two histories, each in the order its entries ran, by
+// the start time of the entries. Those without one, as saved without `set -o
+// extendedhistory`, stay where they are in their history, a's first.
+func mergeHistory(a, b []*historyEntry) []*historyEntry {
+	merged := make([]*historyEntry, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if !a[0].Start.IsZero() && !b[0].Start.IsZero() && b[0].Start.Before(a[0].Start) {
+			merged, b = append(merged, b[0]), b[1:]
+		} else {
+			merged, a = append(merged, a[0]), a[1:]
+		}
+	}
+	return append(append(merged, a...), b...)
+}
+
+// appendHistory adds entry at the end of the history file, as soon as it has
+// run: a session killed without exiting loses nothing, and sessions running
+// at the same time add to the file instead of overwriting each other's
+// entries.
+func (s *Shell) appendHistory(entry *historyEntry) error {
+	f, err := os.OpenFile(s.historyFilepath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return err
+	}
+	line := s.formatHistoryEntry(entry)
+	text := line + "\n"
+	// the files saved on exit by older versions don't end in a newline
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			text = "\n" + text
+		}
+	}
+	if _, err := f.WriteString(text); err != nil {
+		return err
+	}
+	if s.historyAppended == nil {
+		s.historyAppended = make(map[string]int)
+	}
+	s.historyAppended[line]++
+	return nil
+}
+
+func (s *Shell) formatHistoryEntry(entry *historyEntry) string {
+	// a multi-line entry only fits on a line as JSON
+	if s.option("extendedhistory") && entry.hasMetadata() || strings.Contains(entry.Command, "\n") {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return entry.Command
+}
+
+func (s *Shell) previousCommand() string {
+	idx := len(s.history) - s.historyPos - 1
+	if idx >= 0 && idx < len(s.history) {
+		s.historyPos += 1
+		cmd := s.history[idx].Command
+		return cmd
+	}
+	fmt.Fprint(s.Stdout, "\a")
+	return s.input
+}
+
+func (s *Shell) nextCommand() string {
+	idx := len(s.history) - s.historyPos + 1
+	if idx >= 0 && idx < len(s.history) {
+		s.historyPos -= 1
+		cmd := s.history[idx].Command
+		return cmd
+	}
+	fmt.Fprint(s.Stdout, "\a")
+	return s.input
+}
+
+func (s *Shell) addToHistory(entry *historyEntry) {
+	s.history = trimHistory(append(s.history, entry), s.historySize("HISTSIZE"))
+	s.appendHistory(entry)
+}
+
+// keepInHistory reports whether the command line typed, line as it runs,
+// goes to the history: not when it is empty or history itself, nor, as
+// $HISTCONTROL says, when it starts with a space (ignorespace) or is the
+// same as the previous one (ignoredups); ignoreboth is both.
+func (s *Shell) keepInHistory(typed, line string) bool {
+	if line == "" || line == "history" {
+		return false
+	}
+	for _, control := range strings.Split(s.getVar("HISTCONTROL"), ":") {
+		ignoreBoth := control == "ignoreboth"
+		if (ignoreBoth || control == "ignorespace") && strings.HasPrefix(typed, " ") {
+			return false
+		}
+		if (ignoreBoth || control == "ignoredups") && len(s.history) > 0 && s.history[len(s.history)-1].Command == line {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	addBuiltin("history", "history [--json] [-t] [--failed] [--dir DIR] [N] | -c | -d N | -w | -r", "list the commands run, or edit the history", (*Shell).builtinHistory)
+}
+
+// builtinHistory implements `history [--json] [-t] [--failed] [--dir DIR]
+// [N]`, printing the history oldest first, each command with its number, or
+// only the last N. -t adds when each command started, how long it took and
+// its exit status, and with --json each entry is printed with its number and
+// metadata. --failed keeps the commands that exited with a non-zero status
+// and --dir the ones run in DIR or below it; both rely on the metadata saved
+// with `set -o extendedhistory`.
+//
+// `history -c` clears the history, `history -d N` deletes entry N, counted
+// from the end when negative, and `history -w` and `history -r` write the
+// history file and read it again.
+func (s *Shell) builtinHistory(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	times := fs.Bool("t", false, "show the start time, duration and status of the commands")
+	failed := fs.Bool("failed", false, "only list failed commands")
+	dir := fs.String("dir", "", "only list commands run in this directory or below")
+	clearAll := fs.Bool("c", false, "clear the history")
+	del := fs.Int("d", 0, "delete the entry at this position")
+	write := fs.Bool("w", false, "write the history file")
+	read := fs.Bool("r", false, "read the history file again")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *clearAll:
+		s.history, s.historyPos = nil, 0
+		return nil
+	case *del != 0:
+		i := *del - 1
+		if *del < 0 {
+			i = len(s.history) + *del
+		}
+		if i < 0 || i >= len(s.history) {
+			return fmt.Errorf("%d: history position out of range", *del)
+		}
+		s.history = slices.Delete(s.history, i, i+1)
+		s.historyPos = 0
+		return nil
+	case *write:
+		return s.saveHistory()
+	case *read:
+		return s.loadHistory()
+	}
+	last := -1
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s: numeric argument required", fs.Arg(0))
+		}
+		last = n
+	default:
+		return errors.New("too many arguments")
+	}
+	if *dir != "" && !path.IsAbs(*dir) {
+		*dir = path.Join(s.workingDir, *dir)
+	}
+	subdirs := strings.TrimSuffix(path.Clean(*dir), "/") + "/"
+
+	type numberedEntry struct {
+		Index int `json:"index"`
+		*historyEntry
+	}
+	var entries []numberedEntry
+	for i, entry := range s.history {
+		if *failed && entry.Status == 0 {
+			continue
+		}
+		if *dir != "" && path.Clean(*dir) != entry.Dir && !strings.HasPrefix(entry.Dir, subdirs) {
+			continue
+		}
+		entries = append(entries, numberedEntry{i + 1, entry})
+	}
+	if last >= 0 && last < len(entries) {
+		entries = entries[len(entries)-last:]
+	}
+
+	if *asJSON {
+		if entries == nil {
+			entries = []numberedEntry{}
+		}
+		return writeJSON(std, entries)
+	}
+	for _, entry := range entries {
+		if *times {
+			fmt.Fprintf(std.out, "%5d  %s  %s\n", entry.Index, entry.times(), entry.Command)
+		} else {
+			fmt.Fprintf(std.out, "%5d  %s\n", entry.Index, entry.Command)
+		}
+	}
+	return nil
+}
+
+// times returns the start time, duration and exit status of the entry in
+// columns for `history -t`, blank for an entry loaded from a line without
+// them.
+func (e *historyEntry) times() string {
+	if e.Start.IsZero() {
+		return fmt.Sprintf("%-19s  %8s  %3s", "", "", "")
+	}
+	return fmt.Sprintf("%-19s  %8s  %3d", e.Start.Local().Format(time.DateTime), e.Duration.Round(time.Millisecond), e.Status)
+}
@@ -0,0 +1,63 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// historySearches are the edit functions searching the history for the text
+// typed, with the way an entry matches it.
+var historySearches = map[string]func(command, text string) bool{
+	"history-search-backward":           strings.HasPrefix,
+	"history-search-forward":            strings.HasPrefix,
+	"history-substring-search-backward": strings.Contains,
+	"history-substring-search-forward":  strings.Contains,
+}
+
+func init() {
+	for name, match := range historySearches {
+		backward := strings.HasSuffix(name, "-backward")
+		editFunctions[name] = func(s *Shell) bool {
+			s.searchHistory(match, backward)
+			return false
+		}
+	}
+}
+
+// searchHistory replaces the line with the previous entry of the history
+// that matches the text typed, or the next one going forward, as zsh's
+// history-substring-search does. The text is the line as it was before the
+// first of the searches in a row, and the search goes back to it after the
+// last entry. With no text typed, it browses the whole history.
+func (s *Shell) searchHistory(match func(command, text string) bool, backward bool) {
+	if _, searching := historySearches[s.lastEdit]; !searching {
+		s.searchText, s.searchPos = s.input, len(s.history)
+	}
+	if s.searchText == "" {
+		if backward {
+			s.setInput(s.previousCommand())
+		} else {
+			s.setInput(s.nextCommand())
+		}
+		return
+	}
+
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := s.searchPos + step; i >= 0 && i < len(s.history); i += step {
+		// the same command twice in a row comes up once
+		if command := s.history[i].Command; match(command, s.searchText) && command != s.input {
+			s.searchPos = i
+			s.setInput(command)
+			return
+		}
+	}
+	if !backward && s.searchPos < len(s.history) {
+		s.searchPos = len(s.history)
+		s.setInput(s.searchText)
+		return
+	}
+	fmt.Fprint(s.Stdout, "\a")
+}
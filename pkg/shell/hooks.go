@@ -0,0 +1,87 @@
+package shell
+
+import "strings"
+
+// chpwdHook is called after the working directory changed from oldDir to
+// newDir. oldDir is empty when the shell starts.
+type chpwdHook func(oldDir, newDir string)
+
+// AddChpwdHook registers a function called after the working directory
+// changed from oldDir to newDir, and when the shell starts, with an empty
+// oldDir.
+func (s *Shell) AddChpwdHook(hook func(oldDir, newDir string)) {
+	s.chpwdHooks = append(s.chpwdHooks, hook)
+}
+
+func (s *Shell) runChpwdHooks(oldDir, newDir string) {
+	for _, hook := range s.chpwdHooks {
+		hook(oldDir, newDir)
+	}
+}
+
+// AddPrecmdHook registers a function called before each prompt is drawn,
+// once the command line before has run.
+func (s *Shell) AddPrecmdHook(hook func()) {
+	s.precmdHooks = append(s.precmdHooks, hook)
+}
+
+func (s *Shell) runPrecmdHooks() {
+	for _, hook := range s.precmdHooks {
+		hook()
+	}
+}
+
+// AddPreexecHook registers a function called with each command line typed
+// at the prompt, before it runs.
+func (s *Shell) AddPreexecHook(hook func(line string)) {
+	s.preexecHooks = append(s.preexecHooks, hook)
+}
+
+func (s *Shell) runPreexecHooks(line string) {
+	for _, hook := range s.preexecHooks {
+		hook(line)
+	}
+}
+
+// addFunctionHooks makes the shell functions named precmd, preexec and
+// chpwd hooks, as in zsh, along with the ones listed in $precmd_functions,
+// $preexec_functions and $chpwd_functions.
+func (s *Shell) addFunctionHooks() {
+	s.AddPrecmdHook(func() { s.runHookFunctions("precmd") })
+	s.AddPreexecHook(func(line string) { s.runHookFunctions("preexec", line) })
+	s.AddChpwdHook(func(oldDir, newDir string) {
+		// unlike the Go hooks, the functions aren't defined yet at startup
+		if oldDir != "" {
+			s.runHookFunctions("chpwd")
+		}
+	})
+}
+
+// runHookFunctions runs the hook functions of the kind name with args. $?
+// is left as it was, for the prompt and the command line to see, and a cd
+// run by a hook doesn't run the hooks again.
+func (s *Shell) runHookFunctions(name string, args ...string) {
+	if s.inHook {
+		return
+	}
+	names := append([]string{name}, strings.Fields(s.getVar(name+"_functions"))...)
+	defer func(status int) { s.lastStatus, s.inHook = status, false }(s.lastStatus)
+	s.inHook = true
+	for _, n := range names {
+		if fn, ok := s.functions[n]; ok {
+			s.callFunction(fn, args, s.terminalIO())
+		}
+	}
+}
+
+// addExitHook registers a function run when the shell exits, once the
+// commands have stopped and before the terminal is restored.
+func (s *Shell) addExitHook(hook func()) {
+	s.exitHooks = append(s.exitHooks, hook)
+}
+
+func (s *Shell) runExitHooks() {
+	for _, hook := range s.exitHooks {
+		hook()
+	}
+}
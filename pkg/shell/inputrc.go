@@ -0,0 +1,361 @@
+package shell
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const inputrcFilename = ".inputrc"
+
+// inputrcPath returns $INPUTRC, or ~/.inputrc.
+func inputrcPath(home string) string {
+	if p := os.Getenv("INPUTRC"); p != "" {
+		return p
+	}
+	return path.Join(home, inputrcFilename)
+}
+
+// loadInputrc applies the key bindings of a readline init file to the
+// keymaps, so existing readline configuration carries over. Bindings to
+// functions gosh doesn't have are ignored, as are the variables it doesn't
+// know and the keymaps other than emacs, vi-insert and vi-command.
+func (s *Shell) loadInputrc(file string) {
+	s.readInputrc(file, 0)
+}
+
+func (s *Shell) readInputrc(file string, depth int) {
+	// guard against files including each other
+	if depth > 10 {
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// skipping holds, for each open $if, whether its branch is skipped
+	var skipping []bool
+	skipped := func() bool {
+		for _, skip := range skipping {
+			if skip {
+				return true
+			}
+		}
+		return false
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '$' {
+			directive, arg, _ := strings.Cut(line[1:], " ")
+			arg = strings.TrimSpace(arg)
+			switch directive {
+			case "if":
+				skipping = append(skipping, !s.inputrcTest(arg))
+			case "else":
+				if len(skipping) > 0 {
+					skipping[len(skipping)-1] = !skipping[len(skipping)-1]
+				}
+			case "endif":
+				if len(skipping) > 0 {
+					skipping = skipping[:len(skipping)-1]
+				}
+			case "include":
+				if !skipped() {
+					s.readInputrc(expandTilde(arg), depth+1)
+				}
+			}
+			continue
+		}
+		if skipped() {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "set "); ok {
+			name, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			s.setInputrcVar(name, strings.TrimSpace(value))
+			continue
+		}
+		keymap := s.bindingKeymap()
+		if keymap == nil {
+			continue
+		}
+		if seq, binding, ok := parseInputrcBinding(line); ok {
+			keymap[canonicalKeyseq(seq)] = binding
+		}
+	}
+}
+
+// inputrcTest evaluates the condition of an $if directive.
+func (s *Shell) inputrcTest(cond string) bool {
+	if mode, ok := strings.CutPrefix(cond, "mode="); ok {
+		return mode == s.editingMode()
+	}
+	if name, ok := strings.CutPrefix(cond, "term="); ok {
+		term := s.getVar("TERM")
+		return term == name || strings.HasPrefix(term, name+"-")
+	}
+	// otherwise it names the application reading the file
+	return cond == "gosh"
+}
+
+func (s *Shell) editingMode() string {
+	if s.option("vi") {
+		return "vi"
+	}
+	return "emacs"
+}
+
+// bindingKeymap returns the keymap the bindings of the init file go to: the
+// one chosen with `set keymap`, or else the one for the editing mode.
+func (s *Shell) bindingKeymap() keymap {
+	switch s.inputrcVars["keymap"] {
+	case "":
+		if s.editingMode() == "vi" {
+			return s.keymaps["vi-insert"]
+		}
+		return s.keymaps["emacs"]
+	case "emacs", "emacs-standard":
+		return s.keymaps["emacs"]
+	case "vi-insert":
+		return s.keymaps["vi-insert"]
+	case "vi", "vi-command", "vi-move":
+		return s.keymaps["vi-command"]
+	}
+	return nil
+}
+
+func (s *Shell) setInputrcVar(name, value string) {
+	if s.inputrcVars == nil {
+		s.inputrcVars = make(map[string]string)
+	}
+	s.inputrcVars[name] = value
+	if name == "editing-mode" && (value == "emacs" || value == "vi") {
+		s.setOption(value, true)
+		// the bindings that follow are for the new mode
+		delete(s.inputrcVars, "keymap")
+	}
+}
+
+// expandTilde replaces a leading ~ in the file name of an $include.
+func expandTilde(name string) string {
+	if name == "~" || strings.HasPrefix(name, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + name[1:]
+		}
+	}
+	return name
+}
+
+// parseInputrcBinding parses a key binding line: either `"keyseq": binding`
+// or `keyname: binding`, where the binding is a function name or a quoted
+// macro.
+func parseInputrcBinding(line string) (string, keyBinding, bool) {
+	var seq, rest string
+	if line[0] == '"' {
+		end := closingQuote(line)
+		if end < 0 {
+			return "", keyBinding{}, false
+		}
+		seq = unescapeKeyseq(line[1:end])
+		rest = line[end+1:]
+		var ok bool
+		if rest, ok = strings.CutPrefix(strings.TrimSpace(rest), ":"); !ok {
+			return "", keyBinding{}, false
+		}
+	} else {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return "", keyBinding{}, false
+		}
+		if seq, ok = parseKeyname(strings.TrimSpace(name)); !ok {
+			return "", keyBinding{}, false
+		}
+		rest = value
+	}
+	if seq == "" {
+		return "", keyBinding{}, false
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return "", keyBinding{}, false
+	}
+	if rest[0] == '"' || rest[0] == '\'' {
+		end := closingQuote(rest)
+		if end < 0 {
+			return "", keyBinding{}, false
+		}
+		return seq, keyBinding{macro: unescapeKeyseq(rest[1:end])}, true
+	}
+	function, _, _ := strings.Cut(rest, " ")
+	function = strings.ToLower(function)
+	if _, ok := editFunctions[function]; !ok && function != "self-insert" {
+		return "", keyBinding{}, false
+	}
+	return seq, keyBinding{function: function}, true
+}
+
+// closingQuote returns the index of the quote ending the string that s
+// starts with, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+var keynames = map[string]string{
+	"del":     "\x7f",
+	"esc":     "\x1b",
+	"escape":  "\x1b",
+	"lfd":     "\n",
+	"newline": "\n",
+	"ret":     "\r",
+	"return":  "\r",
+	"rubout":  "\x7f",
+	"space":   " ",
+	"spc":     " ",
+	"tab":     "\t",
+}
+
+// parseKeyname parses a readline key name such as Control-u, M-x or TAB.
+func parseKeyname(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	prefix := ""
+	for {
+		if rest, ok := cutAnyPrefix(lower, "meta-", "m-"); ok {
+			prefix += "\x1b"
+			lower, name = rest, name[len(name)-len(rest):]
+			continue
+		}
+		break
+	}
+	control := false
+	if rest, ok := cutAnyPrefix(lower, "control-", "c-"); ok {
+		control = true
+		lower, name = rest, name[len(name)-len(rest):]
+	}
+
+	key, ok := keynames[lower]
+	if !ok {
+		if len(name) != 1 {
+			return "", false
+		}
+		key = name
+	}
+	if control {
+		key = string(controlKey(key[0]))
+	}
+	return prefix + key, true
+}
+
+func cutAnyPrefix(s string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			return rest, true
+		}
+	}
+	return s, false
+}
+
+// controlKey returns the byte typed with Control and c.
+func controlKey(c byte) byte {
+	if c == '?' {
+		return 0x7f
+	}
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	return c & 0x1f
+}
+
+// unescapeKeyseq expands the backslash escapes of a quoted key sequence or
+// macro.
+func unescapeKeyseq(s string) string {
+	var b strings.Builder
+	control, meta := false, false
+	emit := func(c byte) {
+		if control {
+			c = controlKey(c)
+		}
+		if meta {
+			b.WriteByte(0x1b)
+		}
+		b.WriteByte(c)
+		control, meta = false, false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			emit(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; {
+		case (c == 'C' || c == 'M') && i+1 < len(s) && s[i+1] == '-':
+			if c == 'C' {
+				control = true
+			} else {
+				meta = true
+			}
+			i++
+		case c == 'e':
+			emit(0x1b)
+		case c == 'a':
+			emit('\a')
+		case c == 'b':
+			emit('\b')
+		case c == 'd':
+			emit(0x7f)
+		case c == 'f':
+			emit('\f')
+		case c == 'n':
+			emit('\n')
+		case c == 'r':
+			emit('\r')
+		case c == 't':
+			emit('\t')
+		case c == 'v':
+			emit('\v')
+		case c >= '0' && c <= '7':
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(s[i:j], 8, 8)
+			emit(byte(n))
+			i = j - 1
+		case c == 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if j == i+1 {
+				emit('x')
+				continue
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			emit(byte(n))
+			i = j - 1
+		default:
+			// \\, \", \' and anything else stand for themselves
+			emit(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// errInterrupted is returned by readKey when Ctrl-C is pressed while the
+// shell waits for a key.
+var errInterrupted = errors.New("interrupted")
+
+// catchPromptInterrupts lets SIGINT wake the line editor up. The signal
+// can't be relied on to interrupt the poll on stdin, since the Go runtime
+// takes it on any thread, so a byte is written for it to a pipe that is
+// polled along with stdin.
+func (s *Shell) catchPromptInterrupts() {
+	if !s.openInterrupts() {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			s.wakeLineEditor()
+		}
+	}()
+}
+
+// openInterrupts opens the interrupts pipe, reporting whether it could.
+func (s *Shell) openInterrupts() bool {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return false
+	}
+	s.interrupts, s.interruptsWriter = r, w
+	return true
+}
+
+// interrupt does what the terminal does on Ctrl-C or Ctrl-\ for a shell
+// whose terminal doesn't raise signals in the process, as in a session of
+// gosh serve: sig goes to the commands running, and SIGINT wakes the line
+// editor up.
+func (s *Shell) interrupt(sig syscall.Signal) {
+	select {
+	case s.signalChan <- sig:
+	default:
+	}
+	if sig == syscall.SIGINT {
+		s.wakeLineEditor()
+	}
+}
+
+// wakeLineEditor makes the line editor waiting for a key return with
+// errInterrupted, as Ctrl-C does.
+func (s *Shell) wakeLineEditor() {
+	if s.interruptsWriter != nil {
+		s.interruptsWriter.Write([]byte{0})
+	}
+}
+
+// interruptPollFd returns the poll entry for the interrupts pipe, which
+// waitForInput adds after stdin.
+func (s *Shell) interruptPollFd() (unix.PollFd, bool) {
+	if s.interrupts == nil {
+		return unix.PollFd{}, false
+	}
+	return unix.PollFd{Fd: int32(s.interrupts.Fd()), Events: unix.POLLIN}, true
+}
+
+// forgetInterrupts empties the interrupts pipe, of the Ctrl-C pressed while
+// a command ran as well.
+func (s *Shell) forgetInterrupts() {
+	fd, ok := s.interruptPollFd()
+	if !ok {
+		return
+	}
+	buf := make([]byte, 64)
+	fds := []unix.PollFd{fd}
+	for {
+		n, err := unix.Poll(fds, 0)
+		if err != nil || n == 0 {
+			return
+		}
+		if _, err := unix.Read(int(fd.Fd), buf); err != nil {
+			return
+		}
+	}
+}
+
+// cancelLine drops the line being edited after Ctrl-C: it stays on screen
+// followed by ^C, and a fresh prompt is drawn below it. The status is 130,
+// as for a command interrupted.
+func (s *Shell) cancelLine() {
+	s.suggesting = false
+	s.cursor = len(s.input)
+	s.printPrompt()
+	s.termMu.Lock()
+	fmt.Fprint(s.Stdout, "^C\r\n")
+	s.termMu.Unlock()
+
+	s.newLine()
+	s.lastStatus = 130
+}
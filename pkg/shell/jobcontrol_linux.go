@@ -0,0 +1,17 @@
+package shell
+
+import "golang.org/x/sys/unix"
+
+// jobControlSupported tells whether stopped jobs can be told apart, for Ctrl-Z.
+const jobControlSupported = true
+
+// cldStopped is the si_code of a child that was stopped by a signal.
+const cldStopped = 5
+
+// processStopped reports whether the child pid has been stopped since it was
+// last asked. A child that exited isn't reaped, it is left to exec.Cmd.Wait.
+func processStopped(pid int) bool {
+	var info unix.Siginfo
+	err := unix.Waitid(unix.P_PID, pid, &info, unix.WSTOPPED|unix.WNOHANG, nil)
+	return err == nil && info.Code == cldStopped
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package shell
+
+// jobControlSupported is false: without a way to tell that a foreground job
+// was stopped, gosh would wait on it forever, so commands stay in its process
+// group and Ctrl-Z is left to the terminal.
+const jobControlSupported = false
+
+// processStopped always reports false: telling a stopped child from one that
+// exited, without reaping it, needs waitid.
+func processStopped(pid int) bool {
+	return false
+}
@@ -0,0 +1,509 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// stoppedStatus is the exit status of a foreground job stopped with Ctrl-Z:
+// 128 plus SIGTSTP, as for a command killed by a signal.
+const stoppedStatus = 128 + int(syscall.SIGTSTP)
+
+// job is a pipeline stopped with Ctrl-Z, or a statement run in the
+// background with &. Its commands are in a process group of their own,
+// signaled as a whole, that fg makes the terminal's foreground group.
+type job struct {
+	id      int
+	command string
+	pgid    int
+	pids    []int // of the first pipeline of the statement
+	stopped bool
+	// foreground is set while the shell waits for the job, which then
+	// isn't announced when done
+	foreground atomic.Bool
+	done       chan struct{}
+	errs       []error // of the commands of a pipeline, once done is closed
+	status     int     // once done is closed
+}
+
+// state describes the job as the jobs table shows it.
+func (j *job) state() string {
+	select {
+	case <-j.done:
+		if j.status != 0 {
+			return fmt.Sprintf("Exit %d", j.status)
+		}
+		return "Done"
+	default:
+	}
+	if j.stopped {
+		return "Stopped"
+	}
+	return "Running"
+}
+
+// initJobControl turns job control on when the shell owns its terminal:
+// commands then run in process groups of their own, given the terminal while
+// in the foreground, and the signals that would stop the shell itself are
+// caught.
+func (s *Shell) initJobControl() {
+	fd := s.stdinFd()
+	if !jobControlSupported || !term.IsTerminal(fd) {
+		return
+	}
+	pgid, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || pgid != unix.Getpgrp() {
+		return
+	}
+	s.jobControl, s.shellPgid = true, pgid
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU)
+	s.childSignals = make(chan os.Signal, 1)
+	signal.Notify(s.childSignals, syscall.SIGCHLD)
+}
+
+// setProcessGroup makes cmd join the process group pgid, or lead a new one
+// when pgid is 0, which is given the terminal if foreground is set.
+func (s *Shell) setProcessGroup(cmd *exec.Cmd, pgid int, foreground bool) {
+	if !s.jobControl {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pgid = pgid
+	if foreground && pgid == 0 {
+		// the child takes the terminal itself, before running the command
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = s.stdinFd()
+	}
+}
+
+// takeTerminal makes the shell's process group the terminal's foreground one
+// again. Doing so from the background raises SIGTTOU, which has to be
+// ignored for the call to go through.
+func (s *Shell) takeTerminal() {
+	if !s.jobControl {
+		return
+	}
+	signal.Ignore(syscall.SIGTTOU)
+	unix.IoctlSetPointerInt(s.stdinFd(), unix.TIOCSPGRP, s.shellPgid)
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTTOU)
+}
+
+// newJob returns the job of the pipeline run, in the foreground, done once
+// all of its commands are.
+func (s *Shell) newJob(run *pipelineRun) *job {
+	j := &job{command: s.currentStmt, pgid: run.pgid, pids: run.pids, done: make(chan struct{})}
+	j.foreground.Store(true)
+	go func() {
+		j.errs = run.wait()
+		j.status = s.pipelineStatus(errStatuses(j.errs))
+		s.jobDone(j)
+	}()
+	return j
+}
+
+// jobDone marks j as done, announcing it unless the shell was waiting for it.
+func (s *Shell) jobDone(j *job) {
+	close(j.done)
+	if !j.foreground.Load() {
+		s.notifyJob(fmt.Sprintf("[%d] %-8s %s", j.id, j.state(), j.command))
+	}
+}
+
+// waitForeground waits for the foreground job j and reports whether it is
+// done, rather than stopped with Ctrl-Z. A stopped job goes to the job table,
+// for fg and bg to resume it. Either way the shell gets the terminal back.
+//
+// The terminal sends Ctrl-C and Ctrl-\ to the job's process group, the
+// commands of a pipeline and their own children included. Interrupts sent to
+// the shell alone, as with kill -INT, are passed on to the group as well.
+func (s *Shell) waitForeground(j *job) bool {
+	defer s.takeTerminal()
+	// forget interrupts that came in at the prompt
+	for len(s.signalChan) > 0 {
+		<-s.signalChan
+	}
+	for {
+		select {
+		case <-j.done:
+			return true
+		case sig := <-s.signalChan:
+			if j.pgid != 0 {
+				syscall.Kill(-j.pgid, sig.(syscall.Signal))
+			} else if s.remote {
+				// no terminal sends it to the commands
+				for _, pid := range j.pids {
+					syscall.Kill(pid, sig.(syscall.Signal))
+				}
+			}
+		case <-s.childSignals:
+			if j.pgid == 0 || !s.jobStopped(j) {
+				continue
+			}
+			j.stopped = true
+			j.foreground.Store(false)
+			s.addJob(j)
+			fmt.Fprintf(s.Stderr, "\n%s\n", s.jobLine(j, false))
+			return false
+		}
+	}
+}
+
+// jobStopped reports whether one of the processes of j was stopped.
+func (s *Shell) jobStopped(j *job) bool {
+	stopped := false
+	for _, pid := range j.pids {
+		// each one is asked, to take note of all the stops
+		if processStopped(pid) {
+			stopped = true
+		}
+	}
+	return stopped
+}
+
+// addJob puts j in the job table, where it becomes the current job.
+func (s *Shell) addJob(j *job) {
+	if j.id == 0 {
+		j.id = s.nextJobID()
+	}
+	s.removeJob(j)
+	s.jobs = append(s.jobs, j)
+}
+
+func (s *Shell) removeJob(j *job) {
+	for i, other := range s.jobs {
+		if other == j {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// runBackground starts stmt as a job and returns without waiting for it.
+// Its commands read /dev/null rather than the terminal, which stays the
+// shell's. Once the job is done, its status is announced as coprocesses'
+// are, at the next prompt or right away with set -o notify. Only the first
+// pipeline of the statement is signaled by kill, fg and bg. The pipelines
+// chained to it with && and || run in a subshell, as the shell goes on with
+// the next commands meanwhile.
+func (s *Shell) runBackground(stmt *parser.Stmt) {
+	if !s.confirmPipeline(stmt.Pipeline) {
+		s.lastStatus = 1
+		return
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		fmt.Fprintln(s.Stderr, "gosh:", err)
+		s.lastStatus = 1
+		return
+	}
+
+	run := s.startPipeline(stmt.Pipeline, devNull, false)
+	j := &job{command: stmt.String(), pgid: run.pgid, pids: run.pids, done: make(chan struct{})}
+	s.addJob(j)
+	if len(j.pids) > 0 {
+		s.lastBackgroundPid = j.pids[len(j.pids)-1]
+		fmt.Fprintf(s.Stderr, "[%d] %d\n", j.id, s.lastBackgroundPid)
+	}
+	s.lastStatus = 0
+
+	sub := s.subshell(s.terminalIO())
+	go func() {
+		defer devNull.Close()
+		status := sub.pipelineStatus(errStatuses(run.wait()))
+		for _, next := range stmt.AndOr {
+			if (next.Op == "&&") == (status == 0) {
+				status = sub.pipelineStatus(errStatuses(sub.startPipeline(next.Pipeline, devNull, false).wait()))
+			}
+		}
+		j.status = status
+		s.jobDone(j)
+	}()
+}
+
+// errStatuses returns the exit statuses for the errors of commands.
+func errStatuses(errs []error) []int {
+	statuses := make([]int, len(errs))
+	for i, err := range errs {
+		statuses[i] = statusOf(err)
+	}
+	return statuses
+}
+
+// nextJobID returns the number of a new job: one more than the highest in
+// use, so that numbers start over at 1 once all the jobs are done.
+func (s *Shell) nextJobID() int {
+	id := 1
+	for _, j := range s.jobs {
+		id = max(id, j.id+1)
+	}
+	return id
+}
+
+// reapJobs removes the jobs that are done from the job table, once their
+// notification has been queued, and announces the background jobs that were
+// stopped, as by SIGSTOP.
+func (s *Shell) reapJobs() {
+	running := s.jobs[:0]
+	for _, j := range s.jobs {
+		select {
+		case <-j.done:
+			continue
+		default:
+		}
+		if !j.stopped && s.jobStopped(j) {
+			j.stopped = true
+			s.notifyJob(s.jobLine(j, false))
+		}
+		running = append(running, j)
+	}
+	clear(s.jobs[len(running):])
+	s.jobs = running
+}
+
+// signalJobs sends sig to the process groups of the jobs still running.
+func (s *Shell) signalJobs(sig syscall.Signal) {
+	for _, j := range s.jobs {
+		select {
+		case <-j.done:
+		default:
+			if j.pgid != 0 {
+				syscall.Kill(-j.pgid, sig)
+			}
+		}
+	}
+}
+
+// hangupStoppedJobs is an exit hook: stopped jobs get SIGHUP, and SIGCONT to
+// act on it, as they would otherwise be left stopped forever.
+func (s *Shell) hangupStoppedJobs() {
+	for _, j := range s.jobs {
+		if j.stopped && j.pgid != 0 {
+			syscall.Kill(-j.pgid, syscall.SIGHUP)
+			syscall.Kill(-j.pgid, syscall.SIGCONT)
+		}
+	}
+}
+
+// warnStoppedJobs tells, once, that there are stopped jobs when the shell is
+// about to exit, and reports whether it did: exiting again right after that
+// exits anyway.
+func (s *Shell) warnStoppedJobs() bool {
+	for _, j := range s.jobs {
+		if j.stopped && (s.stoppedWarning == 0 || s.lineno > s.stoppedWarning+1) {
+			fmt.Fprintln(s.Stderr, "There are stopped jobs.")
+			s.stoppedWarning = s.lineno
+			return true
+		}
+	}
+	return false
+}
+
+// jobLine describes j as the jobs builtin lists it, with its process IDs if
+// pids is set. The current job, the one fg and bg act on by default, is
+// marked with a +, and the previous one with a -.
+func (s *Shell) jobLine(j *job, pids bool) string {
+	mark := " "
+	switch {
+	case len(s.jobs) > 0 && s.jobs[len(s.jobs)-1] == j:
+		mark = "+"
+	case len(s.jobs) > 1 && s.jobs[len(s.jobs)-2] == j:
+		mark = "-"
+	}
+	line := fmt.Sprintf("[%d]%s  ", j.id, mark)
+	if pids {
+		for _, pid := range j.pids {
+			line += strconv.Itoa(pid) + " "
+		}
+	}
+	return fmt.Sprintf("%s%-24s%s", line, j.state(), j.command)
+}
+
+// findJob returns the job spec refers to: %N, the job numbered N, %+ or %%,
+// the current job, which an empty spec also means, %-, the previous one, or
+// %PREFIX, the one whose command starts with PREFIX.
+func (s *Shell) findJob(spec string) (*job, error) {
+	if len(s.jobs) == 0 {
+		if spec == "" {
+			return nil, errors.New("no current job")
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	name := strings.TrimPrefix(spec, "%")
+	switch name {
+	case "", "+", "%":
+		return s.jobs[len(s.jobs)-1], nil
+	case "-":
+		if len(s.jobs) < 2 {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		return s.jobs[len(s.jobs)-2], nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		for _, j := range s.jobs {
+			if j.id == id {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	var found *job
+	for _, j := range s.jobs {
+		if strings.HasPrefix(j.command, name) {
+			if found != nil {
+				return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+			}
+			found = j
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+func init() {
+	addBuiltin("jobs", "jobs [-l] [-p] [--json]", "list the background and stopped jobs", (*Shell).builtinJobs)
+	addBuiltin("fg", "fg [JOB]", "resume a job in the foreground", (*Shell).builtinFg)
+	addBuiltin("bg", "bg [JOB ...]", "resume stopped jobs in the background", (*Shell).builtinBg)
+}
+
+// builtinJobs implements `jobs [-l] [-p] [--json] [JOB...]`, which lists the
+// background and stopped jobs: -l adds their process IDs, -p only prints
+// those.
+func (s *Shell) builtinJobs(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("jobs", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	long := fs.Bool("l", false, "list the process IDs too")
+	pidsOnly := fs.Bool("p", false, "only list the process IDs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	jobs := append([]*job(nil), s.jobs...)
+	if fs.NArg() > 0 {
+		jobs = jobs[:0]
+		for _, spec := range fs.Args() {
+			j, err := s.findJob(spec)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, j)
+		}
+	} else {
+		sort.Slice(jobs, func(a, b int) bool { return jobs[a].id < jobs[b].id })
+	}
+
+	if *asJSON {
+		type jobJSON struct {
+			ID      int    `json:"id"`
+			State   string `json:"state"`
+			Command string `json:"command"`
+			Pids    []int  `json:"pids"`
+		}
+		out := make([]jobJSON, len(jobs))
+		for i, j := range jobs {
+			out[i] = jobJSON{j.id, j.state(), j.command, j.pids}
+		}
+		return writeJSON(std, out)
+	}
+	for _, j := range jobs {
+		if *pidsOnly {
+			for _, pid := range j.pids {
+				fmt.Fprintln(std.out, pid)
+			}
+			continue
+		}
+		fmt.Fprintln(std.out, s.jobLine(j, *long))
+	}
+	return nil
+}
+
+// builtinFg implements `fg [JOB]`: it resumes the job, the current one by
+// default, in the foreground, giving it the terminal, and waits for it.
+func (s *Shell) builtinFg(args []string, std *stdio) error {
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+	j, err := s.resumableJob(args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(std.out, strings.TrimSuffix(j.command, " &"))
+	j.stopped = false
+	j.foreground.Store(true)
+	unix.IoctlSetPointerInt(s.stdinFd(), unix.TIOCSPGRP, j.pgid)
+	syscall.Kill(-j.pgid, syscall.SIGCONT)
+	if !s.waitForeground(j) {
+		return exitStatus(stoppedStatus)
+	}
+	s.removeJob(j)
+	if j.status != 0 {
+		return exitStatus(j.status)
+	}
+	return nil
+}
+
+// builtinBg implements `bg [JOB...]`: it resumes stopped jobs, the current
+// one by default, in the background.
+func (s *Shell) builtinBg(args []string, std *stdio) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, spec := range args {
+		j, err := s.resumableJob([]string{spec})
+		if err != nil {
+			return err
+		}
+		if !j.stopped {
+			return fmt.Errorf("job %d already in background", j.id)
+		}
+		j.stopped = false
+		syscall.Kill(-j.pgid, syscall.SIGCONT)
+		fmt.Fprintf(std.out, "[%d] %s &\n", j.id, strings.TrimSuffix(j.command, " &"))
+	}
+	return nil
+}
+
+// resumableJob returns the job fg and bg were given, which must still be
+// running or stopped.
+func (s *Shell) resumableJob(args []string) (*job, error) {
+	if !s.jobControl {
+		return nil, errors.New("no job control")
+	}
+	spec := ""
+	if len(args) > 0 {
+		spec = args[0]
+	}
+	j, err := s.findJob(spec)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-j.done:
+		return nil, fmt.Errorf("%%%d: job has terminated", j.id)
+	default:
+	}
+	if j.pgid == 0 {
+		return nil, fmt.Errorf("%%%d: job has no process to resume", j.id)
+	}
+	return j, nil
+}
@@ -0,0 +1,29 @@
+package shell
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBackgroundAndOr(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	if _, err := s.Eval("x=0; true && x=1 && echo $x &"); err != nil {
+		t.Fatal(err)
+	}
+	j := s.jobs[len(s.jobs)-1]
+	// the shell goes on while the job runs
+	for done := false; !done; {
+		select {
+		case <-j.done:
+			done = true
+		default:
+			s.Eval("y=$x")
+		}
+	}
+	out.Reset()
+	s.Eval("echo $x")
+	if got, want := out.String(), "0\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,428 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addBuiltin("json", "json [-r] [-c] FILTER [FILE ...]", "query JSON with a subset of jq", (*Shell).builtinJSON)
+}
+
+// builtinJSON implements `json [-r] [-c] FILTER [FILE...]`, a small subset of
+// jq for poking at JSON on stdin or in files. A filter is a '|'-separated
+// list of paths and functions:
+//
+//	.               the input itself
+//	.name .["key"]  object fields
+//	.[0] .[-1]      array elements
+//	.[1:3]          array slices
+//	.[]             every element of an array or value of an object
+//	keys length type
+//
+// Path steps can be chained (.items[].name) and suffixed with '?' to skip
+// values they don't apply to. With -r strings are printed without quotes,
+// and with -c values are printed on a single line.
+func (s *Shell) builtinJSON(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("json", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	raw := fs.Bool("r", false, "print strings without JSON quoting")
+	compact := fs.Bool("c", false, "print each value on a single line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing filter")
+	}
+	filter, err := parseJSONFilter(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var inputs []io.Reader
+	for _, name := range fs.Args()[1:] {
+		if !path.IsAbs(name) {
+			name = path.Join(s.workingDir, name)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		inputs = append(inputs, f)
+	}
+	if len(inputs) == 0 {
+		if std.in == nil {
+			return errors.New("no input")
+		}
+		inputs = append(inputs, std.in)
+	}
+
+	for _, input := range inputs {
+		dec := json.NewDecoder(input)
+		dec.UseNumber()
+		for {
+			var value any
+			if err := dec.Decode(&value); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			results, err := filter.eval(value)
+			if err != nil {
+				return err
+			}
+			for _, result := range results {
+				if err := writeJSONValue(std.out, result, *raw, *compact); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func writeJSONValue(w io.Writer, value any, raw, compact bool) error {
+	if str, ok := value.(string); ok && raw {
+		_, err := fmt.Fprintln(w, str)
+		return err
+	}
+	var data []byte
+	var err error
+	if compact {
+		data, err = json.Marshal(value)
+	} else {
+		data, err = json.MarshalIndent(value, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+type jsonStepKind int
+
+const (
+	jsonField jsonStepKind = iota
+	jsonIndex
+	jsonSlice
+	jsonIterate
+	jsonFunc
+)
+
+// jsonStep is one element of a path, such as .name or [2].
+type jsonStep struct {
+	kind     jsonStepKind
+	key      string // field name or function name
+	index    int
+	from, to *int
+	optional bool
+}
+
+// jsonFilter is a pipeline of paths; each path is applied to every result of
+// the previous one.
+type jsonFilter [][]jsonStep
+
+func parseJSONFilter(expr string) (jsonFilter, error) {
+	var filter jsonFilter
+	for _, part := range splitJSONPipes(expr) {
+		steps, err := parseJSONPath(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, steps)
+	}
+	return filter, nil
+}
+
+// splitJSONPipes splits expr on '|' outside of quoted keys.
+func splitJSONPipes(expr string) []string {
+	var parts []string
+	inQuote, start := false, 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case '|':
+			if !inQuote {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseJSONPath(expr string) ([]jsonStep, error) {
+	switch expr {
+	case "keys", "length", "type":
+		return []jsonStep{{kind: jsonFunc, key: expr}}, nil
+	case "":
+		return nil, errors.New("empty filter")
+	}
+	if expr[0] != '.' {
+		return nil, fmt.Errorf("invalid filter %q: paths start with '.'", expr)
+	}
+
+	var steps []jsonStep
+	i := 0
+	for i < len(expr) {
+		var step jsonStep
+		switch {
+		case expr[i] == '.' && i+1 < len(expr) && expr[i+1] == '"':
+			key, n, err := parseJSONQuoted(expr[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			step = jsonStep{kind: jsonField, key: key}
+			i += 1 + n
+		case expr[i] == '.' && i+1 < len(expr) && expr[i+1] != '[':
+			j := i + 1
+			for j < len(expr) && (isIdentByte(expr[j])) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid filter %q at offset %d", expr, i)
+			}
+			step = jsonStep{kind: jsonField, key: expr[i+1 : j]}
+			i = j
+		case expr[i] == '.':
+			// "." alone, or the dot in .[...]
+			i++
+			continue
+		case expr[i] == '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid filter %q: missing ']'", expr)
+			}
+			inner := strings.TrimSpace(expr[i+1 : i+end])
+			var err error
+			if step, err = parseJSONBracket(inner); err != nil {
+				return nil, err
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("invalid filter %q at offset %d", expr, i)
+		}
+		if i < len(expr) && expr[i] == '?' {
+			step.optional = true
+			i++
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// parseJSONQuoted parses the quoted string at the start of s, returning it
+// along with the number of bytes it spans.
+func parseJSONQuoted(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			key, err := strconv.Unquote(s[:i+1])
+			return key, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string in %q", s)
+}
+
+func parseJSONBracket(inner string) (jsonStep, error) {
+	if inner == "" {
+		return jsonStep{kind: jsonIterate}, nil
+	}
+	if inner[0] == '"' {
+		key, n, err := parseJSONQuoted(inner)
+		if err != nil || n != len(inner) {
+			return jsonStep{}, fmt.Errorf("invalid key [%s]", inner)
+		}
+		return jsonStep{kind: jsonField, key: key}, nil
+	}
+	if from, to, ok := strings.Cut(inner, ":"); ok {
+		step := jsonStep{kind: jsonSlice}
+		for _, bound := range []struct {
+			text string
+			dst  **int
+		}{{from, &step.from}, {to, &step.to}} {
+			text := strings.TrimSpace(bound.text)
+			if text == "" {
+				continue
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return jsonStep{}, fmt.Errorf("invalid slice [%s]", inner)
+			}
+			*bound.dst = &n
+		}
+		return step, nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return jsonStep{}, fmt.Errorf("invalid index [%s]", inner)
+	}
+	return jsonStep{kind: jsonIndex, index: n}, nil
+}
+
+func (f jsonFilter) eval(input any) ([]any, error) {
+	values := []any{input}
+	for _, path := range f {
+		for _, step := range path {
+			var next []any
+			for _, value := range values {
+				results, err := step.apply(value)
+				if err != nil {
+					if step.optional {
+						continue
+					}
+					return nil, err
+				}
+				next = append(next, results...)
+			}
+			values = next
+		}
+	}
+	return values, nil
+}
+
+func (st jsonStep) apply(value any) ([]any, error) {
+	switch st.kind {
+	case jsonField:
+		switch v := value.(type) {
+		case map[string]any:
+			return []any{v[st.key]}, nil
+		case nil:
+			return []any{nil}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with %q", jsonType(value), st.key)
+	case jsonIndex:
+		switch v := value.(type) {
+		case []any:
+			i := st.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i < 0 || i >= len(v) {
+				return []any{nil}, nil
+			}
+			return []any{v[i]}, nil
+		case nil:
+			return []any{nil}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with a number", jsonType(value))
+	case jsonSlice:
+		v, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot slice %s", jsonType(value))
+		}
+		from, to := 0, len(v)
+		if st.from != nil {
+			from = *st.from
+		}
+		if st.to != nil {
+			to = *st.to
+		}
+		if from < 0 {
+			from += len(v)
+		}
+		if to < 0 {
+			to += len(v)
+		}
+		from, to = max(0, min(from, len(v))), max(0, min(to, len(v)))
+		if from > to {
+			from = to
+		}
+		return []any{v[from:to]}, nil
+	case jsonIterate:
+		switch v := value.(type) {
+		case []any:
+			return v, nil
+		case map[string]any:
+			var results []any
+			for _, key := range sortedKeys(v) {
+				results = append(results, v[key])
+			}
+			return results, nil
+		}
+		return nil, fmt.Errorf("cannot iterate over %s", jsonType(value))
+	case jsonFunc:
+		return applyJSONFunc(st.key, value)
+	}
+	return nil, errors.New("invalid filter")
+}
+
+func applyJSONFunc(name string, value any) ([]any, error) {
+	switch name {
+	case "type":
+		return []any{jsonType(value)}, nil
+	case "length":
+		switch v := value.(type) {
+		case []any:
+			return []any{len(v)}, nil
+		case map[string]any:
+			return []any{len(v)}, nil
+		case string:
+			return []any{len([]rune(v))}, nil
+		case nil:
+			return []any{0}, nil
+		}
+	case "keys":
+		switch v := value.(type) {
+		case map[string]any:
+			var keys []any
+			for _, key := range sortedKeys(v) {
+				keys = append(keys, key)
+			}
+			return []any{keys}, nil
+		case []any:
+			keys := make([]any, len(v))
+			for i := range v {
+				keys[i] = i
+			}
+			return []any{keys}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no %s", jsonType(value), name)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64, int:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
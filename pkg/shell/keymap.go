@@ -0,0 +1,335 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// keyBinding is what a key sequence does: run a line editing function, or
+// type a macro as if its text had been entered.
+type keyBinding struct {
+	function string
+	macro    string
+}
+
+// keymap maps key sequences to bindings.
+type keymap map[string]keyBinding
+
+// isPrefix reports whether seq starts a longer bound sequence.
+func (km keymap) isPrefix(seq string) bool {
+	for bound := range km {
+		if len(bound) > len(seq) && strings.HasPrefix(bound, seq) {
+			return true
+		}
+	}
+	return false
+}
+
+// editFunctions are the line editing functions keys can be bound to, named
+// after their readline equivalents where there is one. They return true when
+// the line is complete.
+var editFunctions = map[string]func(s *Shell) bool{
+	"accept-line": func(s *Shell) bool {
+		s.expandAbbr()
+		s.moveCursor(len(s.input))
+		// a line ending in a backslash, or in the middle of a quote or an
+		// if, goes on below under PROMPT2 rather than failing to parse
+		if s.incomplete(s.input) {
+			s.insertText("\n")
+			return false
+		}
+		return true
+	},
+	"backward-delete-char": func(s *Shell) bool {
+		s.deleteChar()
+		return false
+	},
+	"delete-char": func(s *Shell) bool {
+		s.deleteForward()
+		return false
+	},
+	"backward-char": func(s *Shell) bool {
+		_, size := utf8.DecodeLastRuneInString(s.input[:s.cursor])
+		s.moveCursor(s.cursor - size)
+		return false
+	},
+	"forward-char": func(s *Shell) bool {
+		if s.acceptSuggestion(false) {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(s.input[s.cursor:])
+		s.moveCursor(s.cursor + size)
+		return false
+	},
+	"backward-word": func(s *Shell) bool {
+		s.moveCursor(s.wordStart())
+		return false
+	},
+	"forward-word": func(s *Shell) bool {
+		if s.acceptSuggestion(true) {
+			return false
+		}
+		s.moveCursor(s.wordEnd())
+		return false
+	},
+	"beginning-of-line": func(s *Shell) bool {
+		s.moveCursor(0)
+		return false
+	},
+	"end-of-line": func(s *Shell) bool {
+		if s.acceptSuggestion(false) {
+			return false
+		}
+		s.moveCursor(len(s.input))
+		return false
+	},
+	"previous-history": func(s *Shell) bool {
+		s.setInput(s.previousCommand())
+		return false
+	},
+	"next-history": func(s *Shell) bool {
+		s.setInput(s.nextCommand())
+		return false
+	},
+	"unix-line-discard": func(s *Shell) bool {
+		s.killTo(0)
+		return false
+	},
+	"kill-line": func(s *Shell) bool {
+		s.killTo(len(s.input))
+		return false
+	},
+	"unix-word-rubout": func(s *Shell) bool {
+		s.killTo(s.spaceWordStart())
+		return false
+	},
+	"kill-word": func(s *Shell) bool {
+		s.killTo(s.wordEnd())
+		return false
+	},
+	"backward-kill-word": func(s *Shell) bool {
+		s.killTo(s.wordStart())
+		return false
+	},
+	"yank": func(s *Shell) bool {
+		s.yank()
+		return false
+	},
+	"yank-pop": func(s *Shell) bool {
+		s.yankPop()
+		return false
+	},
+	// Ctrl-D: the end of the input on an empty line, delete-char otherwise
+	"end-of-file": func(s *Shell) bool {
+		if s.input == "" {
+			s.atEOF = true
+			return true
+		}
+		s.deleteForward()
+		return false
+	},
+	"clear-screen": func(s *Shell) bool {
+		fmt.Fprint(s.Stdout, "\033[H\033[2J")
+		return false
+	},
+	"complete": func(s *Shell) bool {
+		s.completeWord()
+		return false
+	},
+	"possible-completions": func(s *Shell) bool {
+		s.possibleCompletions()
+		return false
+	},
+	"shell-expand-line": func(s *Shell) bool {
+		s.setInput(s.expandPreview(s.input))
+		return false
+	},
+	"pick-files": func(s *Shell) bool {
+		s.pickFiles()
+		return false
+	},
+	"pick-directory": func(s *Shell) bool {
+		s.pickDir()
+		return false
+	},
+	"bracketed-paste-begin": func(s *Shell) bool {
+		s.bracketedPaste()
+		return false
+	},
+	"vi-movement-mode": func(s *Shell) bool {
+		s.viMovementMode()
+		return false
+	},
+	"vi-insertion-mode": func(s *Shell) bool {
+		s.viCommandMode = false
+		return false
+	},
+	"vi-append-mode": func(s *Shell) bool {
+		s.viCommandMode = false
+		s.moveCursor(s.afterRune(s.cursor))
+		return false
+	},
+	"vi-insert-beg": func(s *Shell) bool {
+		s.viCommandMode = false
+		s.moveCursor(s.viFirstPrint())
+		return false
+	},
+	"vi-append-eol": func(s *Shell) bool {
+		s.viCommandMode = false
+		s.moveCursor(len(s.input))
+		return false
+	},
+	"vi-next-word": func(s *Shell) bool {
+		s.moveCursor(s.viNextWord())
+		return false
+	},
+	"vi-prev-word": func(s *Shell) bool {
+		s.moveCursor(s.viPrevWord())
+		return false
+	},
+	"vi-end-word": func(s *Shell) bool {
+		s.moveCursor(s.viEndWord())
+		return false
+	},
+	"vi-first-print": func(s *Shell) bool {
+		s.moveCursor(s.viFirstPrint())
+		return false
+	},
+	"vi-delete-to": func(s *Shell) bool {
+		s.viOperate("d")
+		return false
+	},
+	"vi-change-to": func(s *Shell) bool {
+		s.viOperate("c")
+		return false
+	},
+	"vi-yank-to": func(s *Shell) bool {
+		s.viOperate("y")
+		return false
+	},
+	"vi-change-char": func(s *Shell) bool {
+		s.viChangeChar()
+		return false
+	},
+	"vi-put": func(s *Shell) bool {
+		s.viPut(true)
+		return false
+	},
+	"vi-put-before": func(s *Shell) bool {
+		s.viPut(false)
+		return false
+	},
+	// to ignore a key
+	"do-nothing": func(s *Shell) bool {
+		return false
+	},
+}
+
+func defaultKeymap() keymap {
+	return keymap{
+		"\n":        {function: "accept-line"},
+		"\r":        {function: "accept-line"},
+		"\x7f":      {function: "backward-delete-char"},
+		"\b":        {function: "backward-delete-char"},
+		"\x1b[A":    {function: "history-substring-search-backward"},
+		"\x10":      {function: "previous-history"},
+		"\x1b[B":    {function: "history-substring-search-forward"},
+		"\x0e":      {function: "next-history"},
+		"\x1b[C":    {function: "forward-char"},
+		"\x06":      {function: "forward-char"},
+		"\x1b[D":    {function: "backward-char"},
+		"\x02":      {function: "backward-char"},
+		"\x1b[1;5C": {function: "forward-word"},
+		"\x1b[1;5D": {function: "backward-word"},
+		"\x1b[1;3C": {function: "forward-word"},
+		"\x1b[1;3D": {function: "backward-word"},
+		"\x1bf":     {function: "forward-word"},
+		"\x1bb":     {function: "backward-word"},
+		"\x1b[H":    {function: "beginning-of-line"},
+		"\x01":      {function: "beginning-of-line"},
+		"\x1b[F":    {function: "end-of-line"},
+		"\x05":      {function: "end-of-line"},
+		"\x1b[3~":   {function: "delete-char"},
+		"\x04":      {function: "end-of-file"},
+		"\x15":      {function: "unix-line-discard"},
+		"\x0b":      {function: "kill-line"},
+		"\x17":      {function: "unix-word-rubout"},
+		"\x1bd":     {function: "kill-word"},
+		"\x1b\x7f":  {function: "backward-kill-word"},
+		"\x19":      {function: "yank"},
+		"\x1by":     {function: "yank-pop"},
+		"\x0c":      {function: "clear-screen"},
+		"\t":        {function: "complete"},
+		"\x1b?":     {function: "possible-completions"},
+		"\x1b\x05":  {function: "shell-expand-line"},
+		"\x14":      {function: "pick-files"},
+		"\x1bc":     {function: "pick-directory"},
+		pasteStart:  {function: "bracketed-paste-begin"},
+	}
+}
+
+// selfInsert types key, a character, into the line. A space completes an
+// abbreviation.
+func (s *Shell) selfInsert(key string) {
+	r, size := utf8.DecodeRuneInString(key)
+	if size != len(key) || r == utf8.RuneError {
+		return
+	}
+	if r == ' ' && s.cursor == len(s.input) {
+		s.expandAbbr()
+	}
+	if s.isValidChar(r) {
+		s.insertText(key)
+	}
+}
+
+// readKey returns the next input byte, taking macro text first.
+func (s *Shell) readKey() (byte, error) {
+	if len(s.pendingKeys) > 0 {
+		b := s.pendingKeys[0]
+		s.pendingKeys = s.pendingKeys[1:]
+		return b, nil
+	}
+	if err := s.waitForInput(); err != nil {
+		return 0, err
+	}
+	return s.stdin.ReadByte()
+}
+
+// handleKey processes a complete key sequence, reporting whether the line is
+// complete.
+func (s *Shell) handleKey(seq string) bool {
+	binding, ok := s.currentKeymap()[seq]
+	if !ok && s.editingMode() == "vi" && len(seq) == 2 && seq[0] == 0x1b {
+		// ESC typed quickly before a command comes as a Meta key
+		if s.handleKey("\x1b") {
+			return true
+		}
+		return s.handleKey(seq[1:])
+	}
+	if !ok {
+		if s.viCommandMode {
+			// vi commands that don't exist do nothing
+			return false
+		}
+		// unbound sequences are dropped, characters typed
+		binding = keyBinding{function: "self-insert"}
+	}
+	if binding.macro != "" {
+		s.pendingKeys = append([]byte(binding.macro), s.pendingKeys...)
+		return false
+	}
+	done := false
+	if fn, ok := editFunctions[binding.function]; ok {
+		done = fn(s)
+	} else if binding.function == "self-insert" {
+		s.selfInsert(seq)
+	}
+	if s.viCommandMode && !done {
+		s.viClampCursor()
+	}
+	// for the functions that depend on the one before, like yank-pop
+	s.lastEdit = binding.function
+	return done
+}
@@ -0,0 +1,235 @@
+package shell
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// escDelay is how long to wait for the rest of an escape sequence before
+// taking ESC as a key of its own.
+const escDelay = 50 * time.Millisecond
+
+// keyEvent is a key press decoded from the terminal input: a character, or a
+// key like an arrow, Home or F5 sent as an escape sequence. Keys that
+// terminals encode in several ways get the same canonical sequence, so that
+// a binding for one encoding works with all of them.
+type keyEvent struct {
+	seq  string
+	name string // for keys sent as escape sequences, e.g. "C-Up" or "F5"; "" for unknown ones and characters
+}
+
+// namedKeys maps the canonical sequences to key names. Up to F4 and for
+// Home and End, terminals also send SS3 forms (ESC O A) and older variants
+// (ESC [ 1 ~), which the decoder maps to these.
+var namedKeys = map[string]string{
+	"\x1b[A":   "Up",
+	"\x1b[B":   "Down",
+	"\x1b[C":   "Right",
+	"\x1b[D":   "Left",
+	"\x1b[H":   "Home",
+	"\x1b[F":   "End",
+	"\x1b[2~":  "Insert",
+	"\x1b[3~":  "Delete",
+	"\x1b[5~":  "PageUp",
+	"\x1b[6~":  "PageDown",
+	"\x1bOP":   "F1",
+	"\x1bOQ":   "F2",
+	"\x1bOR":   "F3",
+	"\x1bOS":   "F4",
+	"\x1b[15~": "F5",
+	"\x1b[17~": "F6",
+	"\x1b[18~": "F7",
+	"\x1b[19~": "F8",
+	"\x1b[20~": "F9",
+	"\x1b[21~": "F10",
+	"\x1b[23~": "F11",
+	"\x1b[24~": "F12",
+	pasteStart: "PasteStart",
+	pasteEnd:   "PasteEnd",
+}
+
+// tildeAliases are the ESC [ N ~ codes of keys whose canonical sequence has
+// another form.
+var tildeAliases = map[string]string{
+	"1":  "H", // Home
+	"7":  "H",
+	"4":  "F", // End
+	"8":  "F",
+	"11": "P", // F1 to F4 on rxvt
+	"12": "Q",
+	"13": "R",
+	"14": "S",
+}
+
+// decodeKey reads a key from next. pending reports whether more input
+// follows right away, which tells a lone ESC from the start of a sequence,
+// and unread gives back a byte read past the key, to start the next one.
+func decodeKey(next func() (byte, error), pending func() bool, unread func(byte)) (keyEvent, error) {
+	b, err := next()
+	if err != nil {
+		return keyEvent{}, err
+	}
+	if b >= 0xc0 {
+		return utf8Key(b, next, unread), nil
+	}
+	if b != 0x1b || !pending() {
+		return keyEvent{seq: string([]byte{b})}, nil
+	}
+
+	b, err = next()
+	if err != nil {
+		return keyEvent{seq: "\x1b"}, nil
+	}
+	switch b {
+	case '[':
+		// CSI: parameter bytes, intermediate bytes, then a final byte
+		var params []byte
+		for {
+			c, err := next()
+			if err != nil {
+				return keyEvent{seq: "\x1b[" + string(params)}, nil
+			}
+			if c >= 0x40 && c <= 0x7e {
+				return csiKey(string(params), c), nil
+			}
+			params = append(params, c)
+		}
+	case 'O':
+		// SS3: a single final byte
+		c, err := next()
+		if err != nil {
+			return keyEvent{seq: "\x1bO"}, nil
+		}
+		if strings.IndexByte("ABCDHF", c) >= 0 {
+			return csiKey("", c), nil
+		}
+		return namedKey("\x1bO" + string(c)), nil
+	}
+	// ESC followed by a character is how terminals send Meta
+	return keyEvent{seq: "\x1b" + string(b)}, nil
+}
+
+// utf8Key reads the rest of a character encoded in several bytes, from its
+// first byte. A character cut short ends at the first byte that isn't one
+// of its continuation bytes, which is given back to unread.
+func utf8Key(first byte, next func() (byte, error), unread func(byte)) keyEvent {
+	n := 2
+	switch {
+	case first >= 0xf0:
+		n = 4
+	case first >= 0xe0:
+		n = 3
+	}
+	seq := []byte{first}
+	for len(seq) < n {
+		c, err := next()
+		if err != nil {
+			break
+		}
+		if c&0xc0 != 0x80 {
+			// the character was cut short
+			unread(c)
+			break
+		}
+		seq = append(seq, c)
+	}
+	return keyEvent{seq: string(seq)}
+}
+
+// csiKey decodes ESC [ params final, where params may end with a modifier,
+// as in ESC [ 1 ; 5 A for Ctrl-Up.
+func csiKey(params string, final byte) keyEvent {
+	code, modifier, _ := strings.Cut(params, ";")
+	if final == '~' {
+		if alias, ok := tildeAliases[code]; ok {
+			code, final = "1", alias[0]
+		}
+	}
+
+	// the key without modifiers, in its canonical form
+	var base string
+	switch {
+	case final == '~':
+		base = "\x1b[" + code + "~"
+	case strings.IndexByte("PQRS", final) >= 0:
+		base = "\x1bO" + string(final)
+	default:
+		base = "\x1b[" + string(final)
+	}
+	key := namedKey(base)
+	switch {
+	case key.name == "":
+		// not a key we know, keep it as it came
+		key.seq = "\x1b[" + params + string(final)
+	case modifier != "":
+		if code == "" {
+			code = "1"
+		}
+		key.seq = "\x1b[" + code + ";" + modifier + string(final)
+		key.name = modifierNames(modifier) + key.name
+	}
+	return key
+}
+
+func namedKey(seq string) keyEvent {
+	return keyEvent{seq: seq, name: namedKeys[seq]}
+}
+
+// modifierNames gives the prefix for the xterm modifier parameter, which is
+// 1 plus a bit mask of Shift (1), Alt (2) and Ctrl (4).
+func modifierNames(modifier string) string {
+	n, err := strconv.Atoi(modifier)
+	if err != nil || n < 2 {
+		return ""
+	}
+	var prefix string
+	if (n-1)&4 != 0 {
+		prefix += "C-"
+	}
+	if (n-1)&2 != 0 {
+		prefix += "M-"
+	}
+	if (n-1)&1 != 0 {
+		prefix += "S-"
+	}
+	return prefix
+}
+
+// readKeyEvent reads the next key typed, or sent by a macro.
+func (s *Shell) readKeyEvent() (keyEvent, error) {
+	return decodeKey(s.readKey, func() bool {
+		return len(s.pendingKeys) > 0 || s.stdin.Buffered() > 0 || s.inputReady(escDelay)
+	}, func(b byte) {
+		s.pendingKeys = append([]byte{b}, s.pendingKeys...)
+	})
+}
+
+// inputReady reports whether stdin has input within timeout.
+func (s *Shell) inputReady(timeout time.Duration) bool {
+	fds := []unix.PollFd{{Fd: int32(s.stdinFd()), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+	return err == nil && n > 0
+}
+
+// canonicalKeyseq rewrites the keys of a sequence to their canonical form,
+// for the bindings read from .inputrc.
+func canonicalKeyseq(seq string) string {
+	var b strings.Builder
+	next := func() (byte, error) {
+		if seq == "" {
+			return 0, io.EOF
+		}
+		c := seq[0]
+		seq = seq[1:]
+		return c, nil
+	}
+	for seq != "" {
+		key, _ := decodeKey(next, func() bool { return seq != "" }, func(c byte) { seq = string([]byte{c}) + seq })
+		b.WriteString(key.seq)
+	}
+	return b.String()
+}
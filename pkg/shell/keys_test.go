@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeKeyUTF8(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"é", []string{"é"}},
+		{"日本", []string{"日", "本"}},
+		{"😀a", []string{"😀", "a"}},
+		// a character cut short leaves the next key alone
+		{"\xc3x", []string{"\xc3", "x"}},
+		{"\xe6\x97y", []string{"\xe6\x97", "y"}},
+		{"\xc3\xc3\xa9", []string{"\xc3", "é"}},
+		{"\xe6\x97", []string{"\xe6\x97"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			input := tt.input
+			next := func() (byte, error) {
+				if input == "" {
+					return 0, io.EOF
+				}
+				c := input[0]
+				input = input[1:]
+				return c, nil
+			}
+			pending := func() bool { return input != "" }
+			unread := func(c byte) { input = string([]byte{c}) + input }
+			var got []string
+			for input != "" {
+				key, err := decodeKey(next, pending, unread)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, key.seq)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package shell
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// killRingSize is how many killed texts are kept for yanking.
+const killRingSize = 10
+
+// killEdits are the edit functions that kill text. Kills made one after the
+// other go into the same kill ring entry, so that pressing Ctrl-W twice and
+// then Ctrl-Y brings both words back.
+var killEdits = map[string]bool{
+	"kill-line":          true,
+	"unix-line-discard":  true,
+	"unix-word-rubout":   true,
+	"kill-word":          true,
+	"backward-kill-word": true,
+}
+
+// killTo deletes the text between the cursor and offset and saves it in the
+// kill ring.
+func (s *Shell) killTo(offset int) {
+	start, end := min(s.cursor, offset), max(s.cursor, offset)
+	text := s.input[start:end]
+	if text == "" {
+		return
+	}
+	backward := offset < s.cursor
+	s.input = s.input[:start] + s.input[end:]
+	s.cursor = start
+
+	if killEdits[s.lastEdit] && len(s.killRing) > 0 {
+		last := &s.killRing[len(s.killRing)-1]
+		if backward {
+			*last = text + *last
+		} else {
+			*last += text
+		}
+		return
+	}
+	s.pushKill(text)
+}
+
+// pushKill adds text to the kill ring, dropping the oldest entry when it is
+// full.
+func (s *Shell) pushKill(text string) {
+	if text == "" {
+		return
+	}
+	s.killRing = append(s.killRing, text)
+	if len(s.killRing) > killRingSize {
+		s.killRing = s.killRing[1:]
+	}
+}
+
+// yank inserts the text killed last.
+func (s *Shell) yank() {
+	if len(s.killRing) == 0 {
+		return
+	}
+	s.yankIndex = len(s.killRing) - 1
+	s.yankLen = len(s.killRing[s.yankIndex])
+	s.insertText(s.killRing[s.yankIndex])
+}
+
+// yankPop replaces the text just yanked with the kill before it, going round
+// the ring.
+func (s *Shell) yankPop() {
+	if s.lastEdit != "yank" && s.lastEdit != "yank-pop" || len(s.killRing) == 0 {
+		return
+	}
+	s.input = s.input[:s.cursor-s.yankLen] + s.input[s.cursor:]
+	s.cursor -= s.yankLen
+	s.yankIndex = (s.yankIndex + len(s.killRing) - 1) % len(s.killRing)
+	s.yankLen = len(s.killRing[s.yankIndex])
+	s.insertText(s.killRing[s.yankIndex])
+}
+
+// spaceWordStart returns the offset of the start of the whitespace-delimited
+// word before the cursor, which Ctrl-W kills back to.
+func (s *Shell) spaceWordStart() int {
+	i := s.cursor
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s.input[:i])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i -= size
+	}
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s.input[:i])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i -= size
+	}
+	return i
+}
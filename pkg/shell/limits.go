@@ -0,0 +1,175 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// limitsConfig holds the resource limits applied to a spawned command. Zero
+// values mean "no limit".
+type limitsConfig struct {
+	CPU    time.Duration `json:"cpu,omitempty"`    // RLIMIT_CPU
+	Memory int64         `json:"memory,omitempty"` // bytes, RLIMIT_AS or memory.max
+	Procs  int64         `json:"nproc,omitempty"`  // RLIMIT_NPROC or pids.max
+	// Cgroup enforces Memory and Procs with a dedicated cgroup instead of
+	// rlimits, which accounts for resident memory rather than address space
+	// and covers every process of the command.
+	Cgroup bool `json:"-"`
+}
+
+func (c *limitsConfig) enabled() bool {
+	return c != nil && (c.CPU > 0 || c.Memory > 0 || c.Procs > 0)
+}
+
+func (c *limitsConfig) String() string {
+	if !c.enabled() {
+		return "off"
+	}
+	var parts []string
+	if c.CPU > 0 {
+		parts = append(parts, "cpu "+c.CPU.String())
+	}
+	if c.Memory > 0 {
+		parts = append(parts, "memory "+formatKilobytes(c.Memory>>10))
+	}
+	if c.Procs > 0 {
+		parts = append(parts, "nproc "+strconv.FormatInt(c.Procs, 10))
+	}
+	if c.Cgroup {
+		parts = append(parts, "via cgroup")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// limitsValue adapts a string flag that is parsed with a custom function.
+type limitsValue struct {
+	set func(string) error
+	str string
+}
+
+func (v *limitsValue) String() string { return v.str }
+
+func (v *limitsValue) Set(value string) error {
+	v.str = value
+	return v.set(value)
+}
+
+// parseSize parses a byte count with an optional K, M, G or T suffix.
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(value), "B")
+	shift := 0
+	if n := len(number); n > 0 {
+		switch number[n-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		case 'T':
+			shift = 40
+		}
+		if shift > 0 {
+			number = number[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
+
+// parseCPUTime parses a CPU time limit given in seconds or as a duration.
+func parseCPUTime(value string) (time.Duration, error) {
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("invalid cpu time %q", value)
+	}
+	return d, nil
+}
+
+// limitsFlags registers the limit options on fs, filling cfg.
+func limitsFlags(fs *flag.FlagSet, cfg *limitsConfig) {
+	fs.Var(&limitsValue{set: func(v string) (err error) {
+		cfg.CPU, err = parseCPUTime(v)
+		return err
+	}}, "t", "CPU `time` limit, in seconds or as a duration")
+	fs.Var(&limitsValue{set: func(v string) (err error) {
+		cfg.Memory, err = parseSize(v)
+		return err
+	}}, "m", "memory `size` limit, e.g. 512M or 4G")
+	fs.Var(&limitsValue{set: func(v string) (err error) {
+		cfg.Procs, err = strconv.ParseInt(v, 10, 64)
+		if err == nil && cfg.Procs <= 0 {
+			err = errors.New("must be positive")
+		}
+		return err
+	}}, "u", "maximum number of processes")
+}
+
+func init() {
+	addBuiltin("limit", "limit [-c] [-t CPU] [-m SIZE] [-u NPROC] CMD ...", "run a command with resource limits", (*Shell).builtinLimit)
+}
+
+// builtinLimit implements the limit builtin:
+//
+//	limit                        show the global limits
+//	limit -g [-t t] [-m m] [-u n] set limits applied to every command
+//	limit -g off                 remove the global limits
+//	limit [-c] [-t t] [-m m] [-u n] cmd
+//	                             run a single command with limits, -c using
+//	                             a cgroup for the memory and process limits
+func (s *Shell) builtinLimit(args []string, std *stdio) error {
+	if len(args) == 0 {
+		fmt.Fprintln(std.out, "limit:", s.limits.String())
+		return nil
+	}
+
+	fs := flag.NewFlagSet("limit", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	global := fs.Bool("g", false, "apply the limits to every command")
+	cfg := &limitsConfig{}
+	fs.BoolVar(&cfg.Cgroup, "c", false, "enforce memory and process limits with a cgroup")
+	limitsFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	if *global {
+		if fs.Arg(0) == "off" {
+			s.limits = nil
+			return nil
+		}
+		if cfg.Cgroup {
+			return errors.New("-c can only be used for a single command")
+		}
+		if !cfg.enabled() {
+			return errors.New("-g requires at least one of -t, -m, -u or 'off'")
+		}
+		s.limits = cfg
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("missing command")
+	}
+	if !cfg.enabled() {
+		return errors.New("at least one of -t, -m or -u is required")
+	}
+
+	cmd := s.newCommand(fs.Arg(0), fs.Args()[1:])
+	cleanup, err := wrapLimits(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return commandStatus(s.runForeground(cmd, std))
+}
@@ -0,0 +1,202 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The line being edited is s.input, with the cursor at byte offset s.cursor.
+
+// setInput replaces the line, with the cursor at its end.
+func (s *Shell) setInput(text string) {
+	s.input = text
+	s.cursor = len(text)
+}
+
+// insertText inserts text at the cursor.
+func (s *Shell) insertText(text string) {
+	s.input = s.input[:s.cursor] + text + s.input[s.cursor:]
+	s.cursor += len(text)
+}
+
+func (s *Shell) moveCursor(offset int) {
+	s.cursor = max(0, min(len(s.input), offset))
+}
+
+// deleteForward deletes the character under the cursor.
+func (s *Shell) deleteForward() {
+	if s.cursor < len(s.input) {
+		_, size := utf8.DecodeRuneInString(s.input[s.cursor:])
+		s.input = s.input[:s.cursor] + s.input[s.cursor+size:]
+	}
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordStart returns the offset of the start of the word before the cursor,
+// as Alt-b moves to in readline.
+func (s *Shell) wordStart() int {
+	i := s.cursor
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s.input[:i])
+		if isWordChar(r) {
+			break
+		}
+		i -= size
+	}
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s.input[:i])
+		if !isWordChar(r) {
+			break
+		}
+		i -= size
+	}
+	return i
+}
+
+// wordEnd returns the offset of the end of the word after the cursor.
+func (s *Shell) wordEnd() int {
+	i := s.cursor
+	for i < len(s.input) {
+		r, size := utf8.DecodeRuneInString(s.input[i:])
+		if isWordChar(r) {
+			break
+		}
+		i += size
+	}
+	for i < len(s.input) {
+		r, size := utf8.DecodeRuneInString(s.input[i:])
+		if !isWordChar(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// renderLine returns what draws the prompt and the line, from the start of
+// the current terminal line, and leaves the terminal cursor at the editing
+// cursor. It also returns the number of lines drawn and the line the cursor
+// is left on.
+func (s *Shell) renderLine() (string, int, int) {
+	prompt := s.promptString()
+	var b strings.Builder
+	b.WriteString(prompt)
+	continuation := s.continuationPrompt()
+	b.WriteString(strings.ReplaceAll(s.input, "\n", "\n"+continuation))
+	suggestion := s.suggestion()
+	if suggestion != "" {
+		// dimmed, the cursor stays before it
+		b.WriteString("\033[90m" + suggestion + "\033[0m")
+	}
+	if !strings.Contains(s.input, "\n") {
+		s.writeRprompt(&b, visibleWidth(prompt[strings.LastIndexByte(prompt, '\n')+1:])+visibleWidth(s.input+suggestion))
+	}
+
+	lines := 1 + strings.Count(s.input, "\n")
+	before := s.input[:s.cursor]
+	row := strings.Count(before, "\n")
+	if up := lines - 1 - row; up > 0 {
+		fmt.Fprintf(&b, "\033[%dA", up)
+	}
+	// the column of the cursor on its line, after the prompt or PROMPT2
+	col := visibleWidth(prompt[strings.LastIndexByte(prompt, '\n')+1:])
+	if row > 0 {
+		col = visibleWidth(continuation)
+	}
+	col += visibleWidth(before[strings.LastIndexByte(before, '\n')+1:])
+	b.WriteString("\r")
+	if col > 0 {
+		fmt.Fprintf(&b, "\033[%dC", col)
+	}
+	return b.String(), lines, row
+}
+
+// writeRprompt writes RPROMPT at the right end of the line, whose first used
+// columns are taken, leaving the last column free as zsh does. It is left
+// out once the line grows into it, and so cleared by the redraw.
+func (s *Shell) writeRprompt(b *strings.Builder, used int) {
+	rprompt := s.rpromptString()
+	if rprompt == "" || strings.Contains(rprompt, "\n") {
+		return
+	}
+	width, _ := s.terminalSize()
+	// a space at least between the two
+	col := width - 1 - visibleWidth(rprompt)
+	if col <= used {
+		return
+	}
+	fmt.Fprintf(b, "\r\033[%dC%s", col, rprompt)
+}
+
+// visibleWidth returns the number of columns text takes on screen, leaving
+// out escape sequences such as colors.
+func visibleWidth(text string) int {
+	width := 0
+	for i := 0; i < len(text); {
+		if text[i] == 0x1b && i+1 < len(text) && text[i+1] == '[' {
+			i += 2
+			for i < len(text) && (text[i] < 0x40 || text[i] > 0x7e) {
+				i++
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		width += runeWidth(r)
+		i += size
+	}
+	return width
+}
+
+// wideRanges are the characters that take two columns, the East Asian wide
+// and fullwidth ones and most emoji.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f251},
+	{0x1f300, 0x1f64f}, {0x1f680, 0x1f6ff}, {0x1f7e0, 0x1f7eb}, {0x1f900, 0x1f9ff},
+	{0x1fa70, 0x1faff}, {0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// runeWidth returns the number of columns r takes on screen: none for
+// combining marks and other zero-width characters, two for wide ones.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r < wide[0] {
+			break
+		}
+		if r <= wide[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// truncateWidth cuts text to fit in width columns.
+func truncateWidth(text string, width int) string {
+	used := 0
+	for i, r := range text {
+		if used += runeWidth(r); used > width {
+			return text[:i]
+		}
+	}
+	return text
+}
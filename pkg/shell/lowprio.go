@@ -0,0 +1,69 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// I/O scheduling classes, as used by ioprio_set(2).
+const (
+	ioprioClassRealtime   = 1
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+)
+
+// priorityConfig holds the CPU and I/O priority of a spawned command.
+type priorityConfig struct {
+	Nice    int `json:"nice"`
+	IOClass int `json:"ioclass"`
+	IOLevel int `json:"iolevel"`
+}
+
+var ioprioClasses = map[string]int{
+	"realtime":    ioprioClassRealtime,
+	"rt":          ioprioClassRealtime,
+	"best-effort": ioprioClassBestEffort,
+	"be":          ioprioClassBestEffort,
+	"idle":        ioprioClassIdle,
+}
+
+func init() {
+	addBuiltin("lowprio", "lowprio [-n NICE] [-c CLASS] [-l LEVEL] CMD ...", "run a command with a lower CPU and I/O priority", (*Shell).builtinLowprio)
+}
+
+// builtinLowprio implements `lowprio [-n nice] [-c class] [-l level] cmd`,
+// running cmd with a lower CPU niceness (10 by default) and I/O priority
+// (best-effort level 7 by default). The priority is inherited by everything
+// the command starts.
+func (s *Shell) builtinLowprio(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("lowprio", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	cfg := &priorityConfig{}
+	fs.IntVar(&cfg.Nice, "n", 10, "CPU niceness, from -20 to 19")
+	class := fs.String("c", "best-effort", "I/O scheduling class: idle, best-effort or realtime")
+	fs.IntVar(&cfg.IOLevel, "l", 7, "I/O priority level within the class, from 0 to 7")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	if cfg.Nice < -20 || cfg.Nice > 19 {
+		return fmt.Errorf("niceness %d out of range", cfg.Nice)
+	}
+	var ok bool
+	if cfg.IOClass, ok = ioprioClasses[*class]; !ok {
+		return fmt.Errorf("unknown I/O class %q", *class)
+	}
+	if cfg.IOLevel < 0 || cfg.IOLevel > 7 {
+		return fmt.Errorf("I/O level %d out of range", cfg.IOLevel)
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing command")
+	}
+
+	cmd := s.newCommand(fs.Arg(0), fs.Args()[1:])
+	if err := wrapPriority(cmd, cfg); err != nil {
+		return err
+	}
+	return commandStatus(s.runForeground(cmd, std))
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runNotFoundHandler runs the handler of a command that wasn't found, if
+// there is one, with its argv as the arguments: the command_not_found_handler
+// function, or else the command in $COMMAND_NOT_FOUND_HANDLER, as in
+//
+//	COMMAND_NOT_FOUND_HANDLER=/usr/lib/command-not-found --
+//
+// It reports whether a handler ran; the handler then replaces the usual
+// "command not found" message and spelling suggestion, and its status is the
+// one of the command. A command the handler doesn't find doesn't run it
+// again.
+func (s *Shell) runNotFoundHandler(name string, args []string, std *stdio) bool {
+	if s.handlingNotFound {
+		return false
+	}
+	s.handlingNotFound = true
+	defer func() { s.handlingNotFound = false }()
+
+	if fn, ok := s.functions["command_not_found_handler"]; ok {
+		s.callFunction(fn, append([]string{name}, args...), std)
+		return true
+	}
+
+	handler := strings.Fields(s.getVar("COMMAND_NOT_FOUND_HANDLER"))
+	if len(handler) == 0 {
+		return false
+	}
+	if _, err := s.lookPath(handler[0]); err != nil {
+		fmt.Fprintf(std.err, "gosh: command not found handler: %v\n", err)
+		return false
+	}
+
+	argv := append(append(handler[1:len(handler):len(handler)], name), args...)
+	err := s.runForeground(s.newCommand(handler[0], argv), std)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		fmt.Fprintln(std.err, err)
+	}
+	s.lastStatus = statusOf(err)
+	return true
+}
@@ -0,0 +1,54 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// notifyJob announces a change in the state of a background job. By default
+// the message waits until the next prompt; with `set -b` (`set -o notify`)
+// it is printed right away when the shell is waiting for input, and the line
+// being edited is redrawn below it.
+func (s *Shell) notifyJob(msg string) {
+	s.termMu.Lock()
+	defer s.termMu.Unlock()
+	if s.option("notify") && s.reading {
+		// the line is redrawn below the message
+		if s.cursorRow > 0 {
+			fmt.Fprintf(s.Stdout, "\033[%dA", s.cursorRow)
+		}
+		fmt.Fprintf(s.Stdout, "\033[2K\r%s\n\033[J", msg)
+		var line string
+		line, s.lastPrinted, s.cursorRow = s.renderLine()
+		fmt.Fprint(s.Stdout, line)
+		return
+	}
+	s.jobNotices = append(s.jobNotices, msg)
+}
+
+// printJobNotices prints the job messages kept for the prompt.
+func (s *Shell) printJobNotices() {
+	s.termMu.Lock()
+	defer s.termMu.Unlock()
+	for _, msg := range s.jobNotices {
+		fmt.Fprintln(s.Stdout, msg)
+	}
+	s.jobNotices = nil
+}
+
+// setReading tells the notifications whether the shell is waiting for a key,
+// with the prompt and the line on screen.
+func (s *Shell) setReading(reading bool) {
+	s.termMu.Lock()
+	s.reading = reading
+	s.termMu.Unlock()
+}
+
+// jobStatusText describes how a job ended, as in job notifications.
+func jobStatusText(err error, args []string) string {
+	state := "Done"
+	if status := statusOf(err); status != 0 {
+		state = fmt.Sprintf("Exit %d", status)
+	}
+	return fmt.Sprintf("%-8s %s", state, strings.Join(args, " "))
+}
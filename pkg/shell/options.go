@@ -0,0 +1,103 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+)
+
+// shellOptions lists the options that can be toggled with set -o/+o.
+var shellOptions = map[string]string{
+	"autocorrect":     "run the suggested command when a command is not found, instead of asking",
+	"autosuggest":     "suggest the rest of the line from the history as it is typed (on by default)",
+	"confirm":         "ask before running commands that match a dangerous pattern",
+	"emacs":           "edit the command line with emacs keys (the default)",
+	"extendedhistory": "save command metadata (start time, duration, resource usage, exit status, working directory) in the history file",
+	"histexpand":      "expand history references such as !! and !$ in the lines typed (on by default)",
+	"huponexit":       "send SIGHUP to the coprocesses when the shell exits",
+	"noclobber":       "do not let > overwrite existing files, >| still does",
+	"noglob":          "do not expand *, ? and [...] to the paths they match",
+	"nullglob":        "drop the patterns that match no path, instead of keeping them",
+	"notify":          "report background jobs that finish right away, not at the next prompt",
+	"pipefail":        "give pipelines the status of the last command that failed, not of the last command",
+	"rusage":          "record the resource usage of foreground commands",
+	"vi":              "edit the command line with vi keys",
+}
+
+// shortOptions are the single-letter forms of options, as in set -b.
+var shortOptions = map[rune]string{
+	'b': "notify",
+	'C': "noclobber",
+	'f': "noglob",
+	'H': "histexpand",
+}
+
+func (s *Shell) option(name string) bool {
+	return s.options[name]
+}
+
+// setOption turns an option on or off. emacs and vi choose the editing mode,
+// so turning one on turns the other off, and the other way round.
+func (s *Shell) setOption(name string, on bool) {
+	s.options[name] = on
+	switch name {
+	case "emacs":
+		s.options["vi"] = !on
+	case "vi":
+		s.options["emacs"] = !on
+	}
+}
+
+func init() {
+	addBuiltin("set", "set [-o NAME] [+o NAME]", "list, enable or disable shell options", (*Shell).builtinSet)
+}
+
+// builtinSet implements the option part of the set builtin:
+//
+//	set -o          list the options and their state
+//	set -o name     enable an option
+//	set +o name     disable an option
+//	set -b, set +b  the same with the single-letter form of an option
+func (s *Shell) builtinSet(args []string, std *stdio) error {
+	if len(args) == 0 || (len(args) == 1 && args[0] == "-o") {
+		var names []string
+		for name := range shellOptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			state := "off"
+			if s.options[name] {
+				state = "on"
+			}
+			fmt.Fprintf(std.out, "%-15s %s\n", name, state)
+		}
+		return nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if len(flag) > 1 && (flag[0] == '-' || flag[0] == '+') && flag[1:] != "o" {
+			for _, letter := range flag[1:] {
+				name, ok := shortOptions[letter]
+				if !ok {
+					return fmt.Errorf("%c%c: invalid option", flag[0], letter)
+				}
+				s.setOption(name, flag[0] == '-')
+			}
+			continue
+		}
+		if flag != "-o" && flag != "+o" {
+			return fmt.Errorf("%s: invalid option", flag)
+		}
+		if i+1 == len(args) {
+			return fmt.Errorf("%s: option name required", flag)
+		}
+		i++
+		name := args[i]
+		if _, ok := shellOptions[name]; !ok {
+			return fmt.Errorf("%s: invalid option name", name)
+		}
+		s.setOption(name, flag == "-o")
+	}
+	return nil
+}
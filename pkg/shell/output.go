@@ -0,0 +1,14 @@
+package shell
+
+import "flag"
+
+// jsonFlag registers the --json flag of builtins whose output can be
+// consumed by scripts. It defaults to true when GOSH_OUTPUT=json.
+func (s *Shell) jsonFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("json", s.getVar("GOSH_OUTPUT") == "json", "print the output as JSON")
+}
+
+// writeJSON prints value as indented JSON.
+func writeJSON(std *stdio, value any) error {
+	return writeJSONValue(std.out, value, false, false)
+}
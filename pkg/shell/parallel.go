@@ -0,0 +1,202 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+func init() {
+	addBuiltin("parallel", "parallel [-j N] [-k] CMD ... [::: ITEM ...]", "run a command for each item, on N workers", (*Shell).builtinParallel)
+}
+
+// builtinParallel implements `parallel [-j N] [-k] cmd ... [::: item ...]`.
+// It runs the command template once per item on N workers (one per CPU by
+// default). Items come after ":::" or, when there is none, one per line from
+// a non-terminal stdin. Each "{}" in the template is replaced by the item,
+// or the item is appended when the template has no "{}".
+//
+// Output is interleaved line by line as jobs produce it; with -k each job's
+// output is buffered and printed in the order of the items.
+func (s *Shell) builtinParallel(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("parallel", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jobs := fs.Int("j", runtime.NumCPU(), "number of jobs to run at once")
+	keepOrder := fs.Bool("k", false, "print the output of each job in item order")
+	if err := fs.Parse(splitJobsFlag(args)); err != nil {
+		return err
+	}
+	if *jobs < 1 {
+		return fmt.Errorf("invalid number of jobs %d", *jobs)
+	}
+
+	template := fs.Args()
+	var items []string
+	for i, arg := range template {
+		if arg == ":::" {
+			template, items = template[:i], template[i+1:]
+			break
+		}
+	}
+	if len(template) == 0 {
+		return errors.New("missing command")
+	}
+	if items == nil {
+		lines, err := stdinLines(std)
+		if err != nil {
+			return fmt.Errorf("no items: pass them after ::: or on stdin")
+		}
+		for _, line := range lines {
+			if line != "" {
+				items = append(items, line)
+			}
+		}
+	}
+
+	// forget interrupts received before we started
+	for len(s.signalChan) > 0 {
+		<-s.signalChan
+	}
+
+	var (
+		stdout  = &lockedWriter{w: std.out}
+		stderr  = &lockedWriter{w: std.err}
+		outputs = make([]bytes.Buffer, len(items))
+		errs    = make([]error, len(items))
+		queue   = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < *jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				argv := expandParallelTemplate(template, items[i])
+				cmd := s.newCommand(argv[0], argv[1:])
+				if *keepOrder {
+					cmd.Stdout = &outputs[i]
+					cmd.Stderr = &outputs[i]
+					errs[i] = cmd.Run()
+					continue
+				}
+				out, errOut := newLineWriter(stdout), newLineWriter(stderr)
+				cmd.Stdout, cmd.Stderr = out, errOut
+				errs[i] = cmd.Run()
+				out.Flush()
+				errOut.Flush()
+			}
+		}()
+	}
+
+	interrupted := false
+dispatch:
+	for i := range items {
+		select {
+		case queue <- i:
+		case <-s.signalChan:
+			interrupted = true
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if *keepOrder {
+		for i := range outputs {
+			std.out.Write(outputs[i].Bytes())
+		}
+	}
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if interrupted {
+		return errors.New("interrupted")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(items))
+	}
+	return nil
+}
+
+func expandParallelTemplate(template []string, item string) []string {
+	argv := make([]string, 0, len(template)+1)
+	replaced := false
+	for _, arg := range template {
+		if strings.Contains(arg, "{}") {
+			arg = strings.ReplaceAll(arg, "{}", item)
+			replaced = true
+		}
+		argv = append(argv, arg)
+	}
+	if !replaced {
+		argv = append(argv, item)
+	}
+	return argv
+}
+
+// lockedWriter serializes writes from concurrent jobs.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// lineWriter forwards only complete lines, so that output from concurrent
+// jobs never gets mixed within a line.
+type lineWriter struct {
+	buf bytes.Buffer
+	w   io.Writer
+}
+
+func newLineWriter(w io.Writer) *lineWriter {
+	return &lineWriter{w: w}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf.Write(p)
+	if i := bytes.LastIndexByte(l.buf.Bytes(), '\n'); i >= 0 {
+		if _, err := l.w.Write(l.buf.Next(i + 1)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes out a trailing incomplete line.
+func (l *lineWriter) Flush() {
+	if l.buf.Len() > 0 {
+		l.w.Write(l.buf.Bytes())
+		l.buf.Reset()
+	}
+}
+
+// splitJobsFlag splits the -jN options ahead of the command, as in
+// `parallel -j4 gzip`, into -j N, which is how the flag package reads them.
+func splitJobsFlag(args []string) []string {
+	split := make([]string, 0, len(args)+1)
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return append(split, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "-j") && len(arg) > 2 && arg[2] != '=' {
+			split = append(split, "-j", arg[2:])
+			continue
+		}
+		split = append(split, arg)
+	}
+	return split
+}
@@ -0,0 +1,54 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// bracketedPaste inserts pasted text into the line instead of typing it, so
+// that the newlines it contains don't run anything. A paste of several
+// commands becomes a block shown for review, that Enter runs as a whole and
+// Ctrl-U discards.
+func (s *Shell) bracketedPaste() {
+	var text strings.Builder
+	for !strings.HasSuffix(text.String(), pasteEnd) {
+		b, err := s.readKey()
+		if err != nil {
+			break
+		}
+		text.WriteByte(b)
+	}
+	pasted := strings.TrimSuffix(text.String(), pasteEnd)
+	pasted = strings.ReplaceAll(pasted, "\r\n", "\n")
+	pasted = strings.ReplaceAll(pasted, "\r", "\n")
+	pasted = strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, pasted)
+
+	if lines := commandLines(pasted); len(lines) > 0 {
+		s.insertText(strings.Join(lines, "\n"))
+	}
+	if n := len(commandLines(s.input)); n > 1 {
+		fmt.Fprintf(s.Stdout, "\033[2K\rgosh: pasted %d commands, Enter runs them, Ctrl-U discards them\n", n)
+		s.lastPrinted = 0
+	}
+}
+
+// commandLines returns the non-blank lines of a block of commands.
+func commandLines(input string) []string {
+	var lines []string
+	for _, line := range strings.Split(input, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
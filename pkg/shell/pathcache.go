@@ -0,0 +1,210 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandCache remembers where commands were found in PATH, and which
+// executables the PATH directories hold. It is thrown away whenever PATH
+// changes or one of its directories is modified, so newly installed or
+// removed executables are picked up without a rehash.
+type commandCache struct {
+	mu      sync.Mutex // commands of pipelines are looked up concurrently
+	pathVar string
+	mtimes  map[string]time.Time
+	paths   map[string]string // command name -> path, "" when not found
+	names   []string          // nil until listed
+}
+
+// validate resets the cache if it wasn't built for the current PATH and
+// directory contents.
+func (c *commandCache) validate(pathVar string) {
+	dirs := filepath.SplitList(pathVar)
+	valid := c.paths != nil && pathVar == c.pathVar
+	if valid {
+		for _, dir := range dirs {
+			if dirModTime(dir) != c.mtimes[dir] {
+				valid = false
+				break
+			}
+		}
+	}
+	if valid {
+		return
+	}
+
+	c.pathVar = pathVar
+	c.mtimes = make(map[string]time.Time, len(dirs))
+	for _, dir := range dirs {
+		c.mtimes[dir] = dirModTime(dir)
+	}
+	c.paths = make(map[string]string)
+	c.names = nil
+}
+
+func dirModTime(dir string) time.Time {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// lookPath looks a command up in PATH, going through the command cache.
+func (s *Shell) lookPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return exec.LookPath(name)
+	}
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+	s.commands.validate(s.getVar("PATH"))
+	if file, ok := s.commands.paths[name]; ok {
+		if file == "" {
+			return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+		}
+		return file, nil
+	}
+	file, err := findExecutable(name, s.commands.pathVar)
+	s.commands.paths[name] = file
+	return file, err
+}
+
+// findExecutable is exec.LookPath in the directories of pathVar, the PATH of
+// the shell rather than of the process. As exec.LookPath does, it doesn't
+// run commands found relative to the current directory.
+func findExecutable(name, pathVar string) (string, error) {
+	for _, dir := range filepath.SplitList(pathVar) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		info, err := os.Stat(file)
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0 {
+			return file, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// pathExecutables returns the names of the executables in the PATH
+// directories.
+func (s *Shell) pathExecutables() []string {
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+	s.commands.validate(s.getVar("PATH"))
+	if s.commands.names != nil {
+		return s.commands.names
+	}
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, dir := range filepath.SplitList(s.commands.pathVar) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if seen[entry.Name()] || entry.IsDir() {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, entry.Name()))
+			if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+				continue
+			}
+			seen[entry.Name()] = true
+			names = append(names, entry.Name())
+		}
+	}
+	s.commands.names = names
+	return names
+}
+
+func init() {
+	addBuiltin("hash", "hash [--json] [-r] [-d] [NAME ...]", "list, look up or forget where commands are in PATH", (*Shell).builtinHash)
+	addBuiltin("rehash", "rehash", "forget where commands are in PATH", (*Shell).builtinRehash)
+}
+
+// builtinHash implements the command cache builtins:
+//
+//	hash                list the commands found so far, and their path
+//	hash NAME ...       look the commands up, to remember where they are
+//	hash -d NAME ...    forget where the commands are
+//	hash -r, rehash     forget all of them
+//
+// The cache follows the changes of PATH and of its directories, so rehash is
+// only needed when a command was replaced in a directory that comes first.
+func (s *Shell) builtinHash(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("hash", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	reset := fs.Bool("r", false, "forget all the commands")
+	forget := fs.Bool("d", false, "forget the commands")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *reset {
+		s.commands.mu.Lock()
+		s.commands.paths = nil
+		s.commands.mu.Unlock()
+	}
+	if *forget {
+		s.commands.mu.Lock()
+		defer s.commands.mu.Unlock()
+		for _, name := range fs.Args() {
+			delete(s.commands.paths, name)
+		}
+		return nil
+	}
+	if fs.NArg() > 0 {
+		var failed error
+		for _, name := range fs.Args() {
+			if strings.Contains(name, "/") {
+				continue
+			}
+			if _, err := s.lookPath(name); err != nil {
+				fmt.Fprintf(std.err, "hash: %s: not found\n", name)
+				failed = exitStatus(1)
+			}
+		}
+		return failed
+	}
+	if *reset {
+		return nil
+	}
+
+	s.commands.mu.Lock()
+	s.commands.validate(s.getVar("PATH"))
+	found := make(map[string]string)
+	for name, file := range s.commands.paths {
+		if file != "" {
+			found[name] = file
+		}
+	}
+	s.commands.mu.Unlock()
+	if *asJSON {
+		return writeJSON(std, found)
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(std.out, "%s=%s\n", name, found[name])
+	}
+	return nil
+}
+
+func (s *Shell) builtinRehash(args []string, std *stdio) error {
+	return s.builtinHash(append([]string{"-r"}, args...), std)
+}
@@ -0,0 +1,340 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPickerEntries bounds the walk of large trees.
+const maxPickerEntries = 100000
+
+// ignoreRule is a line of a .gitignore file.
+type ignoreRule struct {
+	dir      string // directory of the .gitignore, relative to the walk root
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func readIgnoreRules(root, dir string) []ignoreRule {
+	f, err := os.Open(filepath.Join(root, dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule := ignoreRule{dir: dir}
+		if line[0] == '!' {
+			rule.negate, line = true, line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		// a slash other than a trailing one anchors the pattern
+		if strings.Contains(line, "/") {
+			rule.anchored, line = true, strings.TrimPrefix(line, "/")
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignored reports whether rel, relative to the walk root, is ignored. As
+// in git, the last matching rule wins.
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if rule.dir != "." {
+			var ok bool
+			if name, ok = strings.CutPrefix(rel, rule.dir+"/"); !ok {
+				continue
+			}
+		}
+		if !rule.anchored {
+			name = path.Base(name)
+		}
+		if matched, _ := path.Match(rule.pattern, name); matched {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// pickerCandidates lists the files, or the directories, under root, leaving
+// out hidden VCS directories and what .gitignore files exclude.
+func pickerCandidates(root string, dirs bool) []string {
+	var candidates []string
+	rules := readIgnoreRules(root, ".")
+	filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || file == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, file)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".hg" || d.Name() == ".svn") || ignored(rules, rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			rules = append(rules, readIgnoreRules(root, rel)...)
+		}
+		if d.IsDir() == dirs {
+			candidates = append(candidates, rel)
+		}
+		if len(candidates) >= maxPickerEntries {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return candidates
+}
+
+// fuzzyScore scores how well candidate matches query, whose characters must
+// appear in order. Consecutive matches and matches at the start of a path
+// segment or word score higher.
+func fuzzyScore(query, candidate string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	q := []rune(strings.ToLower(query))
+	score, qi, prevMatch := 0, 0, false
+	var prev rune = '/'
+	for _, r := range strings.ToLower(candidate) {
+		if qi < len(q) && r == q[qi] {
+			score++
+			if prevMatch {
+				score += 3
+			}
+			if prev == '/' || prev == '_' || prev == '-' || prev == '.' || unicode.IsSpace(prev) {
+				score += 2
+			}
+			qi++
+			prevMatch = true
+		} else {
+			prevMatch = false
+		}
+		prev = r
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score*100 - utf8.RuneCountInString(candidate), true
+}
+
+// pick runs the fuzzy finder over candidates in the alternate screen and
+// returns the chosen ones: the entries marked with Tab, or the highlighted
+// one. It returns nil when cancelled with Esc or Ctrl-C. Entries can also be
+// chosen with a click, and the list scrolled with the mouse wheel, on
+// terminals that support SGR mouse reporting; the others ignore the request
+// to enable it.
+func (s *Shell) pick(title string, candidates []string, multi bool) []string {
+	fmt.Fprint(s.Stdout, "\033[?1049h\033[?1000h\033[?1006h")
+	defer fmt.Fprint(s.Stdout, "\033[?1006l\033[?1000l\033[?1049l")
+
+	query, cursor, top := "", 0, 0
+	marked := make(map[string]bool)
+	choose := func(matches []string) []string {
+		var chosen []string
+		for _, m := range matches {
+			if marked[m] {
+				chosen = append(chosen, m)
+			}
+		}
+		if len(chosen) == 0 && len(matches) > 0 {
+			chosen = []string{matches[cursor]}
+		}
+		return chosen
+	}
+	for {
+		type match struct {
+			text  string
+			score int
+		}
+		var matches []match
+		for _, candidate := range candidates {
+			if score, ok := fuzzyScore(query, candidate); ok {
+				matches = append(matches, match{candidate, score})
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+		cursor = max(0, min(cursor, len(matches)-1))
+		texts := make([]string, len(matches))
+		for i, m := range matches {
+			texts[i] = m.text
+		}
+
+		width, height := s.terminalSize()
+		// scroll the list to keep the cursor in view
+		rows := max(1, height-2)
+		if cursor < top {
+			top = cursor
+		} else if cursor >= top+rows {
+			top = cursor - rows + 1
+		}
+		top = max(0, min(top, len(matches)-rows))
+		var b strings.Builder
+		b.WriteString("\033[H\033[2J")
+		fmt.Fprintf(&b, "%s %d/%d\r\n> %s", title, len(matches), len(candidates), query)
+		for i, m := range matches[top:min(len(matches), top+rows)] {
+			i += top
+			prefix := "  "
+			if marked[m.text] {
+				prefix = "* "
+			}
+			line := prefix + m.text
+			line = truncateWidth(line, width)
+			if i == cursor {
+				line = "\033[7m" + line + "\033[0m"
+			}
+			fmt.Fprintf(&b, "\033[%d;1H%s", i-top+3, line)
+		}
+		fmt.Fprintf(&b, "\033[2;%dH", 3+visibleWidth(query))
+		fmt.Fprint(s.Stdout, b.String())
+
+		c, err := s.stdin.ReadByte()
+		if err != nil {
+			return nil
+		}
+		switch c {
+		case '\n', '\r':
+			return choose(texts)
+		case 3, 7:
+			// Ctrl-C, Ctrl-G
+			return nil
+		case 27:
+			// arrow keys come as ESC [ A; a lone ESC cancels
+			if s.stdin.Buffered() == 0 {
+				return nil
+			}
+			if next, _ := s.stdin.ReadByte(); next == '[' {
+				switch key, _ := s.stdin.ReadByte(); key {
+				case 'A':
+					cursor--
+				case 'B':
+					cursor++
+				case '<':
+					button, _, y, press, ok := s.readMouseEvent()
+					if !ok {
+						break
+					}
+					switch row := top + y - 3; button {
+					case 0:
+						// a click on an entry chooses it, once the button is
+						// released so that the release isn't left to be read
+						if y < 3 || row >= len(matches) {
+							break
+						}
+						cursor = row
+						if !press {
+							return choose(texts)
+						}
+					case 64:
+						cursor--
+					case 65:
+						cursor++
+					}
+				}
+			}
+		case 16:
+			// Ctrl-P
+			cursor--
+		case 14:
+			// Ctrl-N
+			cursor++
+		case '\t':
+			if multi && len(matches) > 0 {
+				text := matches[cursor].text
+				marked[text] = !marked[text]
+				cursor++
+			}
+		case 127, '\b':
+			if query != "" {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+				cursor = 0
+			}
+		default:
+			if c >= ' ' {
+				// the bytes of a character typed, one at a time
+				query += string([]byte{c})
+				cursor = 0
+			}
+		}
+	}
+}
+
+// readMouseEvent reads the rest of an SGR mouse report, ESC [ < button ; x ;
+// y followed by M for a press or m for a release, once ESC [ < has been read.
+func (s *Shell) readMouseEvent() (button, x, y int, press, ok bool) {
+	var params []byte
+	for len(params) < 32 {
+		c, err := s.stdin.ReadByte()
+		if err != nil {
+			return 0, 0, 0, false, false
+		}
+		if c == 'M' || c == 'm' {
+			fields := strings.Split(string(params), ";")
+			if len(fields) != 3 {
+				return 0, 0, 0, false, false
+			}
+			var errs [3]error
+			button, errs[0] = strconv.Atoi(fields[0])
+			x, errs[1] = strconv.Atoi(fields[1])
+			y, errs[2] = strconv.Atoi(fields[2])
+			ok = errs[0] == nil && errs[1] == nil && errs[2] == nil
+			return button, x, y, c == 'M', ok
+		}
+		params = append(params, c)
+	}
+	return 0, 0, 0, false, false
+}
+
+// pickFiles is the Ctrl-T widget: it inserts the files chosen under the
+// working directory into the command line.
+func (s *Shell) pickFiles() {
+	chosen := s.pick("files", pickerCandidates(s.workingDir, false), true)
+	if len(chosen) == 0 {
+		return
+	}
+	if before := s.input[:s.cursor]; before != "" && !strings.HasSuffix(before, " ") {
+		s.insertText(" ")
+	}
+	s.insertText(strings.Join(chosen, " "))
+}
+
+// pickDir is the Alt-C widget: it changes to a directory chosen under the
+// working directory.
+func (s *Shell) pickDir() {
+	chosen := s.pick("directories", pickerCandidates(s.workingDir, true), false)
+	if len(chosen) == 0 {
+		return
+	}
+	fmt.Fprintln(s.Stdout)
+	if err := s.changeDir(chosen[0]); err != nil {
+		fmt.Fprintln(s.Stdout, "cd: error: ", err.Error())
+	}
+}
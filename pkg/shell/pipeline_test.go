@@ -0,0 +1,64 @@
+package shell
+
+import (
+	"bytes"
+	"testing"
+)
+
+// newTestShell returns a shell writing to out, with a home directory of its
+// own.
+func newTestShell(t *testing.T, out *bytes.Buffer) *Shell {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	s, err := NewShell(WithStdout(out), WithStderr(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPipelineBuiltinStages(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		// the builtins run in subshells: what read assigns stays there
+		{"a=x; echo 1 | read a | read b; echo $a $b", "x\n"},
+		{"echo hello | read line; echo [$line]", "[]\n"},
+		{"true | false; echo $?", "1\n"},
+		{"echo one two | { read a b; echo $b $a; }", "two one\n"},
+		{"x=1; f() { x=2; echo $x; }; f | cat; echo $x", "2\n1\n"},
+		// and so do exports
+		{"export Y=2 | cat; echo [$Y]", "[]\n"},
+		{"echo x | { export W=4; }; echo [$W]", "[]\n"},
+		{"FOO=bar env | grep -x FOO=bar", "FOO=bar\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newTestShell(t, &out)
+			if _, err := s.Eval(tt.line); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineExpandsOnce(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	dir := t.TempDir()
+	line := "cd " + dir + "; echo $(echo x >> f) | cat; echo $(echo y >> f) | cat &>/dev/null &"
+	if _, err := s.Eval(line); err != nil {
+		t.Fatal(err)
+	}
+	<-s.jobs[len(s.jobs)-1].done
+	out.Reset()
+	s.Eval("cat f")
+	if got, want := out.String(), "x\ny\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
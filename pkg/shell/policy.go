@@ -0,0 +1,216 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	policyFilename    = ".gosh_policy"
+	policyLogFilename = ".gosh_policy.log"
+)
+
+// policy decides which commands the shell may spawn. It is loaded from
+// $GOSH_POLICY, or ~/.gosh_policy when that is unset. The file holds one rule
+// per line:
+//
+//	# comments and blank lines are ignored
+//	mode allowlist     only commands matching an allow rule may run
+//	allow git *
+//	deny rm -rf /*
+//	confirm terraform destroy*   ask first when `set -o confirm` is on
+//	log /var/log/gosh-policy.log
+//
+// Deny rules win over allow rules. Patterns are matched against the command
+// line with '*' matching any run of characters and '?' a single one; a
+// pattern also matches any command line it is a word-prefix of, so
+// "allow ls" allows "ls -la".
+type policy struct {
+	path      string
+	allowlist bool
+	allow     []string
+	deny      []string
+	confirm   []string
+	logger    *log.Logger
+}
+
+// loadPolicy reads the policy file at filePath. A missing file yields a nil
+// policy, which allows everything.
+func loadPolicy(filePath, logPath string) (*policy, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &policy{path: filePath}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		keyword, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		switch {
+		case keyword == "mode" && value == "allowlist":
+			p.allowlist = true
+		case keyword == "mode" && value == "denylist":
+			p.allowlist = false
+		case keyword == "allow" && value != "":
+			p.allow = append(p.allow, value)
+		case keyword == "deny" && value != "":
+			p.deny = append(p.deny, value)
+		case keyword == "confirm" && value != "":
+			p.confirm = append(p.confirm, value)
+		case keyword == "log" && value != "":
+			logPath = value
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid rule %q", filePath, lineNo, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening policy log: %w", err)
+	}
+	p.logger = log.New(logFile, "", log.LstdFlags)
+	return p, nil
+}
+
+// policyPath returns the policy file the shell should load for userDir.
+func policyPath(userDir string) string {
+	if p := os.Getenv("GOSH_POLICY"); p != "" {
+		return p
+	}
+	return path.Join(userDir, policyFilename)
+}
+
+// check returns an error if the command line is not allowed to run.
+func (p *policy) check(argv []string) error {
+	if p == nil {
+		return nil
+	}
+
+	// "/bin/rm" is matched like "rm"
+	line := strings.Join(append([]string{path.Base(argv[0])}, argv[1:]...), " ")
+	for _, pattern := range p.deny {
+		if matchCommandPattern(pattern, line) {
+			return fmt.Errorf("policy: %q denied by rule %q", line, "deny "+pattern)
+		}
+	}
+	if !p.allowlist {
+		return nil
+	}
+	for _, pattern := range p.allow {
+		if matchCommandPattern(pattern, line) {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy: %q is not in the allowlist", line)
+}
+
+// enforce checks argv and logs violations run from dir.
+func (p *policy) enforce(argv []string, dir string) error {
+	err := p.check(argv)
+	if err != nil {
+		p.logger.Printf("uid=%d cwd=%s %v", os.Getuid(), dir, err)
+	}
+	return err
+}
+
+// matchCommandPattern reports whether pattern matches line entirely, or
+// matches a prefix of it that ends on a word boundary.
+func matchCommandPattern(pattern, line string) bool {
+	if wildcardMatch(pattern, line) {
+		return true
+	}
+	for i := 0; i < len(line); i++ {
+		if line[i] == ' ' && wildcardMatch(pattern, line[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches s against pattern where '*' matches any (possibly
+// empty) sequence and '?' any single byte. Unlike path.Match, '*' also
+// matches '/'.
+func wildcardMatch(pattern, s string) bool {
+	px, sx := 0, 0
+	// position to resume from after the last '*'
+	starPx, starSx := -1, 0
+	for sx < len(s) {
+		switch {
+		case px < len(pattern) && pattern[px] == '*':
+			starPx, starSx = px, sx
+			px++
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == s[sx]):
+			px++
+			sx++
+		case starPx >= 0:
+			starSx++
+			px, sx = starPx+1, starSx
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
+
+func init() {
+	addBuiltin("policy", "policy [check CMD]", "show the command policy, or check a command against it", (*Shell).builtinPolicy)
+}
+
+// builtinPolicy implements the policy builtin:
+//
+//	policy              show the loaded rules
+//	policy check cmd    report whether cmd would be allowed
+func (s *Shell) builtinPolicy(args []string, std *stdio) error {
+	if len(args) > 0 && args[0] == "check" {
+		if len(args) == 1 {
+			return fmt.Errorf("check: missing command")
+		}
+		if err := s.policy.check(args[1:]); err != nil {
+			fmt.Fprintln(std.out, err)
+			return nil
+		}
+		fmt.Fprintln(std.out, "allowed")
+		return nil
+	}
+
+	p := s.policy
+	if p == nil {
+		fmt.Fprintln(std.out, "no policy loaded, all commands are allowed")
+		return nil
+	}
+	mode := "denylist"
+	if p.allowlist {
+		mode = "allowlist"
+	}
+	fmt.Fprintf(std.out, "policy %s (mode %s)\n", p.path, mode)
+	for _, pattern := range p.deny {
+		fmt.Fprintln(std.out, "deny", pattern)
+	}
+	for _, pattern := range p.allow {
+		fmt.Fprintln(std.out, "allow", pattern)
+	}
+	for _, pattern := range p.confirm {
+		fmt.Fprintln(std.out, "confirm", pattern)
+	}
+	return nil
+}
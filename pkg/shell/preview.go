@@ -0,0 +1,97 @@
+package shell
+
+import (
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// expandPreview returns line as gosh would run it, for the Ctrl-Alt-E key:
+// the abbreviations in command position are expanded, even those that
+// weren't followed by a space, then the history references, the aliases and
+// the words of the simple commands, as they are when the line runs. Quoted
+// text stays as it is, and the line is left alone when it doesn't parse.
+// The commands of compound commands aren't expanded, as they may depend on
+// what runs before them.
+func (s *Shell) expandPreview(line string) string {
+	line = s.previewAbbrs(line)
+	if s.option("histexpand") {
+		expanded, _, err := s.expandHistory(line)
+		if err != nil {
+			return line
+		}
+		line = expanded
+	}
+	list, err := parser.ParseAliases(line, s.aliases)
+	if err != nil {
+		return line
+	}
+	for _, command := range simpleCommands(list) {
+		for _, a := range command.Assigns {
+			a.Value = literalWord(s.expandWord(a.Value))
+		}
+		fields := s.expandFields(command.Args)
+		command.Args = make([]*parser.Word, len(fields))
+		for i, field := range fields {
+			command.Args[i] = literalWord(field)
+		}
+		for _, r := range command.Redirs {
+			r.Target = literalWord(s.expandWord(r.Target))
+		}
+	}
+	return list.String()
+}
+
+// previewAbbrs expands the abbreviations of line that are command words.
+func (s *Shell) previewAbbrs(line string) string {
+	if len(s.abbrs) == 0 {
+		return line
+	}
+	list, err := parser.Parse(line)
+	if err != nil {
+		return line
+	}
+	commands := simpleCommands(list)
+	// from the end, so that the positions before stay right
+	for i := len(commands) - 1; i >= 0; i-- {
+		command := commands[i]
+		if len(command.Assigns) > 0 || len(command.Args) == 0 {
+			continue
+		}
+		word := command.Args[0]
+		name, ok := word.Lit()
+		if expansion, abbr := s.abbrs[name]; ok && abbr {
+			line = line[:word.Pos] + expansion + line[word.Pos+len(name):]
+		}
+	}
+	return line
+}
+
+// simpleCommands returns the simple commands of the pipelines of list, in
+// the order they appear, leaving out those of compound commands.
+func simpleCommands(list *parser.List) []*parser.SimpleCommand {
+	var commands []*parser.SimpleCommand
+	add := func(p *parser.Pipeline) {
+		for _, cmd := range p.Cmds {
+			if command, ok := cmd.(*parser.SimpleCommand); ok {
+				commands = append(commands, command)
+			}
+		}
+	}
+	for _, stmt := range list.Stmts {
+		add(stmt.Pipeline)
+		for _, next := range stmt.AndOr {
+			add(next.Pipeline)
+		}
+	}
+	return commands
+}
+
+// literalWord returns a word that is the text value, taken literally: it is
+// quoted when it is empty or would match paths.
+func literalWord(value string) *parser.Word {
+	if value == "" || strings.ContainsAny(value, "*?[") && !strings.Contains(value, "'") {
+		return &parser.Word{Parts: []parser.WordPart{&parser.SglQuoted{Value: value}}}
+	}
+	return &parser.Word{Parts: []parser.WordPart{&parser.Lit{Value: value}}}
+}
@@ -0,0 +1,327 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	addBuiltin("echo", "echo [-neE] [ARG ...]", "print the arguments", (*Shell).builtinEcho)
+	addBuiltin("printf", "printf [-v NAME] FORMAT [ARG ...]", "print the arguments as the format says", (*Shell).builtinPrintf)
+}
+
+// builtinEcho implements `echo [-neE] [ARG ...]`, which prints the ARGs
+// separated by spaces, and a newline unless -n is given. With -e, the
+// backslash escapes of the ARGs are interpreted, as in printf; \c stops the
+// output there.
+func (s *Shell) builtinEcho(args []string, std *stdio) error {
+	newline, escapes := true, false
+	for len(args) > 0 && isEchoOptions(args[0]) {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+		args = args[1:]
+	}
+	out := strings.Join(args, " ")
+	if escapes {
+		var stop bool
+		if out, stop = expandEscapes(out, true); stop {
+			newline = false
+		}
+	}
+	if newline {
+		out += "\n"
+	}
+	_, err := fmt.Fprint(std.out, out)
+	return err
+}
+
+// isEchoOptions reports whether arg is options of echo, like -n or -ne.
+// Anything else, like -x or -, is printed.
+func isEchoOptions(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && strings.Trim(arg[1:], "neE") == ""
+}
+
+// expandEscapes interprets the backslash escapes of text, as echo -e and
+// the %b of printf do. It reports whether the text stops at a \c.
+func expandEscapes(text string, echo bool) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '\\' {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+		var stop bool
+		if i, stop = writeEscape(&b, text, i, echo); stop {
+			return b.String(), true
+		}
+	}
+	return b.String(), false
+}
+
+// writeEscape writes what the backslash escape at text[i] stands for, and
+// returns the index after it: \a, \b, \e, \f, \n, \r, \t, \v, \\, \xHH and
+// the octal ones, \0NNN for echo and \NNN in the format of printf. It
+// reports whether the escape is \c, which stops the output of echo -e and
+// the %b of printf.
+func writeEscape(b *strings.Builder, text string, i int, echo bool) (int, bool) {
+	if i+1 == len(text) {
+		b.WriteByte('\\')
+		return i + 1, false
+	}
+	i += 2
+	switch c := text[i-1]; c {
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'c':
+		if echo {
+			return i, true
+		}
+		b.WriteString(`\c`)
+	case 'e', 'E':
+		b.WriteByte('\033')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'v':
+		b.WriteByte('\v')
+	case '\\':
+		b.WriteByte('\\')
+	case 'x':
+		start := i
+		for i < len(text) && i < start+2 && isHexDigit(text[i]) {
+			i++
+		}
+		if i == start {
+			b.WriteString(`\x`)
+			break
+		}
+		n, _ := strconv.ParseUint(text[start:i], 16, 8)
+		b.WriteByte(byte(n))
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		if echo && c != '0' {
+			b.WriteByte('\\')
+			b.WriteByte(c)
+			break
+		}
+		// for echo, the digits come after the 0
+		start := i
+		if !echo {
+			start--
+		}
+		for i < len(text) && i < start+3 && text[i] >= '0' && text[i] <= '7' {
+			i++
+		}
+		n, _ := strconv.ParseUint("0"+text[start:i], 8, 16)
+		b.WriteByte(byte(n))
+	default:
+		b.WriteByte('\\')
+		b.WriteByte(c)
+	}
+	return i, false
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// builtinPrintf implements `printf [-v NAME] FORMAT [ARG ...]`, which prints
+// the ARGs as FORMAT says, with its backslash escapes and these
+// conversions, which take the flags, width and precision of C:
+//
+//	%s   the ARG
+//	%b   the ARG with its backslash escapes interpreted, as echo -e does
+//	%q   the ARG quoted, so that the shell reads it back as it is
+//	%c   the first character of the ARG
+//	%d, %i, %o, %u, %x, %X   the ARG as an integer
+//	%e, %E, %f, %g, %G       the ARG as a floating-point number
+//	%%   a %
+//
+// FORMAT is used again as long as ARGs are left, and missing ones are empty,
+// or 0. A number can be written as 'C, for the code of character C. With
+// -v, the output is assigned to the variable NAME instead.
+func (s *Shell) builtinPrintf(args []string, std *stdio) error {
+	var name string
+	if len(args) > 1 && args[0] == "-v" {
+		name, args = args[1], args[2:]
+		if !isVarName(name) {
+			return fmt.Errorf("%s: not a valid identifier", name)
+		}
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("usage: printf [-v NAME] FORMAT [ARG ...]")
+	}
+
+	p := &printer{args: args[1:], std: std}
+	for {
+		used := p.next
+		if p.format(args[0]) || p.next == used || p.next == len(p.args) {
+			break
+		}
+	}
+	if name != "" {
+		s.setVar(name, p.out.String())
+	} else if _, err := fmt.Fprint(std.out, p.out.String()); err != nil {
+		return err
+	}
+	if p.failed {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// printer formats the output of printf.
+type printer struct {
+	out    strings.Builder
+	args   []string
+	next   int // the argument the next conversion takes
+	std    *stdio
+	failed bool
+}
+
+// arg returns the next argument, or "" when there are none left.
+func (p *printer) arg() string {
+	if p.next == len(p.args) {
+		return ""
+	}
+	p.next++
+	return p.args[p.next-1]
+}
+
+// format writes the arguments as format says, reporting whether a \c in a
+// %b argument stops the output.
+func (p *printer) format(format string) bool {
+	for i := 0; i < len(format); i++ {
+		switch c := format[i]; {
+		case c == '\\':
+			i, _ = writeEscape(&p.out, format, i, false)
+			i--
+		case c == '%' && i+1 < len(format):
+			j := i + 1
+			for j < len(format) && strings.IndexByte("-+ #0", format[j]) >= 0 {
+				j++
+			}
+			spec := format[i:j]
+			j, spec = p.number(format, j, spec)
+			if j < len(format) && format[j] == '.' {
+				j, spec = p.number(format, j+1, spec+".")
+			}
+			if j == len(format) {
+				p.out.WriteString(format[i:])
+				return false
+			}
+			if p.convert(spec, format[j]) {
+				return true
+			}
+			i = j
+		default:
+			p.out.WriteByte(c)
+		}
+	}
+	return false
+}
+
+// number adds the width or precision at format[j:] to spec: digits, or a *
+// that takes it from the next argument.
+func (p *printer) number(format string, j int, spec string) (int, string) {
+	if j < len(format) && format[j] == '*' {
+		return j + 1, spec + strconv.FormatInt(p.integer(p.arg()), 10)
+	}
+	start := j
+	for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+		j++
+	}
+	return j, spec + format[start:j]
+}
+
+// convert writes the next argument with the conversion verb, spec being the
+// % and the flags, width and precision before it. It reports whether a \c
+// in a %b argument stops the output.
+func (p *printer) convert(spec string, verb byte) bool {
+	switch verb {
+	case '%':
+		p.out.WriteByte('%')
+	case 's':
+		fmt.Fprintf(&p.out, spec+"s", p.arg())
+	case 'b':
+		text, stop := expandEscapes(p.arg(), true)
+		fmt.Fprintf(&p.out, spec+"s", text)
+		return stop
+	case 'q':
+		fmt.Fprintf(&p.out, spec+"s", shellQuote(p.arg()))
+	case 'c':
+		r, _ := utf8.DecodeRuneInString(p.arg())
+		if r != utf8.RuneError {
+			fmt.Fprintf(&p.out, spec+"c", r)
+		}
+	case 'd', 'i':
+		fmt.Fprintf(&p.out, spec+"d", p.integer(p.arg()))
+	case 'o', 'u', 'x', 'X':
+		goVerb := map[byte]string{'o': "o", 'u': "d", 'x': "x", 'X': "X"}[verb]
+		fmt.Fprintf(&p.out, spec+goVerb, uint64(p.integer(p.arg())))
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		fmt.Fprintf(&p.out, spec+string(verb), p.float(p.arg()))
+	default:
+		fmt.Fprintf(p.std.err, "printf: %%%c: invalid conversion\n", verb)
+		p.failed = true
+	}
+	return false
+}
+
+// integer returns the value of arg as an integer: decimal, octal with a 0
+// or hexadecimal with 0x in front, or 'C for the code of character C.
+func (p *printer) integer(arg string) int64 {
+	if code, ok := charCode(arg); ok {
+		return code
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(arg), 0, 64)
+	if err != nil && strings.TrimSpace(arg) != "" {
+		fmt.Fprintf(p.std.err, "printf: %s: invalid number\n", arg)
+		p.failed = true
+	}
+	return n
+}
+
+// float returns the value of arg as a floating-point number.
+func (p *printer) float(arg string) float64 {
+	if code, ok := charCode(arg); ok {
+		return float64(code)
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	if err != nil && strings.TrimSpace(arg) != "" {
+		fmt.Fprintf(p.std.err, "printf: %s: invalid number\n", arg)
+		p.failed = true
+	}
+	return f
+}
+
+// charCode returns the code of the character after the ' or " arg starts
+// with.
+func charCode(arg string) (int64, bool) {
+	if len(arg) < 2 || arg[0] != '\'' && arg[0] != '"' {
+		return 0, false
+	}
+	r, _ := utf8.DecodeRuneInString(arg[1:])
+	return int64(r), true
+}
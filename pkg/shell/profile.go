@@ -0,0 +1,174 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime/pprof"
+	"sort"
+	"time"
+)
+
+// timing accumulates the time spent in a part of the shell.
+type timing struct {
+	Count int           `json:"count"`
+	Total time.Duration `json:"total"`
+	Max   time.Duration `json:"max"`
+}
+
+// timed starts timing a part of the shell; call the returned function when
+// it is done:
+//
+//	defer s.timed("parse")()
+//
+// The parts are parse (parsing the command line), expand
+// (variable expansion), spawn (starting a process) and render (drawing the
+// prompt and the line).
+func (s *Shell) timed(part string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		s.timingsMu.Lock()
+		defer s.timingsMu.Unlock()
+		if s.timings == nil {
+			s.timings = make(map[string]*timing)
+		}
+		t, ok := s.timings[part]
+		if !ok {
+			t = &timing{}
+			s.timings[part] = t
+		}
+		t.Count++
+		t.Total += elapsed
+		t.Max = max(t.Max, elapsed)
+	}
+}
+
+// startProfiling writes a CPU profile of the whole session to dir, and a
+// heap profile when the shell exits, for `gosh --profile DIR`.
+func (s *Shell) startProfiling(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := s.startCPUProfile(path.Join(dir, "cpu.pprof")); err != nil {
+		return err
+	}
+	s.addExitHook(func() {
+		s.stopCPUProfile()
+		writeHeapProfile(path.Join(dir, "heap.pprof"))
+	})
+	return nil
+}
+
+func (s *Shell) startCPUProfile(file string) error {
+	if s.cpuProfile != nil {
+		return fmt.Errorf("a CPU profile is already being written to %s", s.cpuProfile.Name())
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	s.cpuProfile = f
+	return nil
+}
+
+func (s *Shell) stopCPUProfile() error {
+	if s.cpuProfile == nil {
+		return errors.New("no CPU profile is being written")
+	}
+	pprof.StopCPUProfile()
+	err := s.cpuProfile.Close()
+	s.cpuProfile = nil
+	return err
+}
+
+func writeHeapProfile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return pprof.WriteHeapProfile(f)
+}
+
+func init() {
+	addBuiltin("profile", "profile [--json] [--reset] | cpu FILE | heap FILE", "the time spent in each part of the shell, or profiles of it", (*Shell).builtinProfile)
+}
+
+// builtinProfile implements the profile builtin:
+//
+//	profile [--json] [--reset]   time spent parsing, expanding, spawning and rendering
+//	profile cpu FILE             start writing a CPU profile to FILE
+//	profile cpu stop             stop it
+//	profile heap FILE            write a heap profile to FILE
+//
+// The profiles are read with `go tool pprof`.
+func (s *Shell) builtinProfile(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	reset := fs.Bool("reset", false, "reset the timings")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "":
+	case "cpu":
+		if fs.NArg() != 2 {
+			return errors.New("usage: profile cpu FILE | profile cpu stop")
+		}
+		if fs.Arg(1) == "stop" {
+			return s.stopCPUProfile()
+		}
+		return s.startCPUProfile(s.resolvePath(fs.Arg(1)))
+	case "heap":
+		if fs.NArg() != 2 {
+			return errors.New("usage: profile heap FILE")
+		}
+		return writeHeapProfile(s.resolvePath(fs.Arg(1)))
+	default:
+		return fmt.Errorf("%s: unknown subcommand", fs.Arg(0))
+	}
+
+	s.timingsMu.Lock()
+	defer s.timingsMu.Unlock()
+	if *reset {
+		s.timings = nil
+		return nil
+	}
+	if *asJSON {
+		timings := s.timings
+		if timings == nil {
+			timings = map[string]*timing{}
+		}
+		return writeJSON(std, timings)
+	}
+	parts := make([]string, 0, len(s.timings))
+	for part := range s.timings {
+		parts = append(parts, part)
+	}
+	sort.Strings(parts)
+	fmt.Fprintf(std.out, "%-8s %8s %12s %12s %12s\n", "part", "count", "total", "avg", "max")
+	for _, part := range parts {
+		t := s.timings[part]
+		fmt.Fprintf(std.out, "%-8s %8d %12s %12s %12s\n", part, t.Count, t.Total.Round(time.Microsecond),
+			(t.Total / time.Duration(t.Count)).Round(time.Microsecond), t.Max.Round(time.Microsecond))
+	}
+	return nil
+}
+
+// resolvePath makes name relative to the working directory.
+func (s *Shell) resolvePath(name string) string {
+	if path.IsAbs(name) {
+		return name
+	}
+	return path.Join(s.workingDir, name)
+}
@@ -0,0 +1,205 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPrompt = "gosh > $ "
+
+// promptColors are the colors %F takes by name, in the order of their ANSI
+// codes.
+var promptColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// promptString renders the PROMPT variable, or the default prompt when it is
+// unset. The following escapes are expanded, as in zsh:
+//
+//	%n   the user name
+//	%m   the host name, up to the first dot, and %M all of it
+//	%~   the working directory, with $HOME as ~, and %d without it; a number
+//	     in between, as in %2~, keeps that many trailing components
+//	%c   the last component of the working directory, like %1~
+//	%T   the time as 15:04, %* as 15:04:05, %t as 3:04PM, and %D the date
+//	     as 24-01-02
+//	%?   the exit status of the last command
+//	%#   '#' for root, '$' for the other users
+//	%j   the number of jobs
+//	%E   how long the last command line took to run
+//	%F{color}, %f   start and stop a color, a name such as red or a number
+//	     of the 256 colors
+//	%B, %b   start and stop bold text
+//	%r   resource usage of the last foreground command (with set -o rusage)
+//	%%   a literal '%'
+func (s *Shell) promptString() string {
+	format := s.getVar("PROMPT")
+	if format == "" {
+		return defaultPrompt
+	}
+	return s.expandPrompt(format)
+}
+
+// continuationPrompt renders the PROMPT2 variable, or "> " when it is unset,
+// which starts the lines after the first of a command typed on several.
+func (s *Shell) continuationPrompt() string {
+	format := s.getVar("PROMPT2")
+	if format == "" {
+		return "> "
+	}
+	return s.expandPrompt(format)
+}
+
+// rpromptString renders the RPROMPT variable, shown at the right end of the
+// line being typed, with the escapes of PROMPT.
+func (s *Shell) rpromptString() string {
+	format := s.getVar("RPROMPT")
+	if format == "" {
+		return ""
+	}
+	return s.expandPrompt(format)
+}
+
+func (s *Shell) expandPrompt(format string) string {
+	now := time.Now()
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		start := i
+		i++
+		n := 0
+		for i < len(format)-1 && format[i] >= '0' && format[i] <= '9' {
+			n = n*10 + int(format[i]-'0')
+			i++
+		}
+		switch format[i] {
+		case 'n':
+			b.WriteString(s.userName())
+		case 'm':
+			host, _, _ := strings.Cut(hostname(), ".")
+			b.WriteString(host)
+		case 'M':
+			b.WriteString(hostname())
+		case '~':
+			b.WriteString(trailingDirs(s.abbreviateHome(s.workingDir), n))
+		case 'd', '/':
+			b.WriteString(trailingDirs(s.workingDir, n))
+		case 'c':
+			b.WriteString(trailingDirs(s.abbreviateHome(s.workingDir), 1))
+		case 'T':
+			b.WriteString(now.Format("15:04"))
+		case '*':
+			b.WriteString(now.Format("15:04:05"))
+		case 't', '@':
+			b.WriteString(now.Format("3:04PM"))
+		case 'D':
+			b.WriteString(now.Format("06-01-02"))
+		case '?':
+			b.WriteString(strconv.Itoa(s.lastStatus))
+		case '#':
+			if os.Geteuid() == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('$')
+			}
+		case 'j':
+			b.WriteString(strconv.Itoa(len(s.jobs)))
+		case 'E':
+			if s.current != nil {
+				b.WriteString(s.current.Duration.Round(time.Millisecond).String())
+			}
+		case 'F':
+			color, end, ok := promptColor(format[i+1:])
+			if !ok {
+				b.WriteString(format[start : i+1])
+				continue
+			}
+			b.WriteString(color)
+			i += end
+		case 'f':
+			b.WriteString("\033[39m")
+		case 'B':
+			b.WriteString("\033[1m")
+		case 'b':
+			b.WriteString("\033[22m")
+		case 'r':
+			if s.lastRusage != nil {
+				b.WriteString(s.lastRusage.String())
+			}
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(format[start : i+1])
+		}
+	}
+	return b.String()
+}
+
+// promptColor returns the escape sequence of the color of a %F escape, in
+// braces at the start of text, and the length of the braces.
+func promptColor(text string) (string, int, bool) {
+	end := strings.IndexByte(text, '}')
+	if !strings.HasPrefix(text, "{") || end < 0 {
+		return "", 0, false
+	}
+	name := text[1:end]
+	for i, color := range promptColors {
+		if name == color {
+			return fmt.Sprintf("\033[%dm", 30+i), end + 1, true
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 && n < 256 {
+		return fmt.Sprintf("\033[38;5;%dm", n), end + 1, true
+	}
+	return "", 0, false
+}
+
+// userName returns $USER, or the name of the user running the shell when it
+// is unset.
+func (s *Shell) userName() string {
+	if name := s.getVar("USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// abbreviateHome writes dir with $HOME as ~, as in ~/src for $HOME/src.
+func (s *Shell) abbreviateHome(dir string) string {
+	home := s.homeDir("")
+	if home == "" || home == "/" || home[0] == '~' {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(dir, home+"/"); ok {
+		return "~/" + rest
+	}
+	return dir
+}
+
+// trailingDirs returns the last n components of dir, or all of dir when n
+// is 0 or it has no more than n.
+func trailingDirs(dir string, n int) string {
+	if n == 0 || dir == "/" {
+		return dir
+	}
+	parts := strings.Split(dir, "/")
+	if len(parts) <= n {
+		return dir
+	}
+	return strings.Join(parts[len(parts)-n:], "/")
+}
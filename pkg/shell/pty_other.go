@@ -0,0 +1,23 @@
+//go:build !linux
+
+package shell
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var errNoPTY = errors.New("pseudo-terminals are only supported on Linux")
+
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errNoPTY
+}
+
+func setPTYSize(master *os.File, rows, cols int) error {
+	return errNoPTY
+}
+
+func startOnPTY(cmd *exec.Cmd, rows, cols int) (*os.File, error) {
+	return nil, errNoPTY
+}
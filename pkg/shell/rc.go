@@ -0,0 +1,176 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	rcFilename      = ".goshrc"
+	profileFilename = ".gosh_profile"
+)
+
+// Config holds the startup settings given on the gosh command line.
+type Config struct {
+	Login       bool   // read ~/.gosh_profile before the rc file
+	Interactive bool   // run interactively even when stdin isn't a terminal
+	NoRC        bool   // don't read the rc file
+	RCFile      string // the rc file, ~/.goshrc by default
+	ProfileDir  string // where to write CPU and heap profiles of the session
+}
+
+// args returns the command line flags giving these settings to gosh.
+func (c Config) args() []string {
+	var args []string
+	if c.Login {
+		args = append(args, "--login")
+	}
+	if c.Interactive {
+		args = append(args, "-i")
+	}
+	if c.NoRC {
+		args = append(args, "--norc")
+	}
+	if c.RCFile != "" {
+		args = append(args, "--rcfile", c.RCFile)
+	}
+	if c.ProfileDir != "" {
+		args = append(args, "--profile", c.ProfileDir)
+	}
+	return args
+}
+
+// runStartupFiles runs the startup files: ~/.gosh_profile for a login shell,
+// then the rc file unless disabled.
+func (s *Shell) runStartupFiles() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	if s.config.Login {
+		s.runStartupFile(path.Join(home, profileFilename))
+	}
+	if s.config.NoRC {
+		return
+	}
+	rcFile := s.config.RCFile
+	if rcFile == "" {
+		rcFile = path.Join(home, rcFilename)
+	}
+	s.runStartupFile(rcFile)
+}
+
+// runStartupFile runs a startup file. A missing file is fine.
+func (s *Shell) runStartupFile(file string) {
+	if err := s.runFile(file); err != nil && !errors.Is(err, fs.ErrNotExist) && !isSyntaxError(err) {
+		fmt.Fprintln(s.Stderr, "gosh:", err)
+	}
+}
+
+// runFile runs the commands of a file, skipping blank lines and comments. A
+// command can go on over the next lines, after a backslash or a pipe, or in
+// quotes.
+func (s *Shell) runFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.runLines(file, f)
+}
+
+// runLines runs the commands read from r, like runFile, naming the input in
+// the error messages. It stops at the first syntax error, which it returns.
+func (s *Shell) runLines(name string, r io.Reader) error {
+	// for the error messages
+	defer func(file string, line int) {
+		s.scriptFile, s.scriptLine = file, line
+	}(s.scriptFile, s.scriptLine)
+	s.scriptFile = name
+
+	scanner := bufio.NewScanner(r)
+	var command string
+	start, lineno := 0, 0
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		if command == "" {
+			line = strings.TrimSpace(line)
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			start = lineno
+		} else {
+			command += "\n"
+		}
+		command += line
+		if s.incomplete(command) {
+			continue
+		}
+		s.scriptLine = start
+		if err := s.execute(command); err != nil {
+			return err
+		}
+		command = ""
+		if s.returning || s.exiting {
+			// return in a sourced file, or exit
+			return nil
+		}
+	}
+	if command != "" {
+		// reports what the file ends in the middle of
+		s.scriptLine = start
+		if err := s.execute(command); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func init() {
+	addBuiltin("source", "source FILE [ARG ...]", "run the commands of a file in the shell", (*Shell).builtinSource)
+	addBuiltin(".", ". FILE [ARG ...]", "run the commands of a file in the shell, like source", (*Shell).builtinSource)
+}
+
+// builtinSource implements `source FILE [ARG ...]` and `. FILE`, which run
+// the commands of the file in the shell itself, so that the variables,
+// aliases and directory changes they make last. The ARGs are the positional
+// parameters while it runs. The status is the one of the last command run,
+// or of return, which leaves the file.
+func (s *Shell) builtinSource(args []string, std *stdio) error {
+	if len(args) == 0 {
+		return errors.New("usage: source FILE [ARG ...]")
+	}
+	if len(args) > 1 {
+		defer func(positional []string) { s.positional = positional }(s.positional)
+		s.positional = args[1:]
+	}
+	defer func(saved *stdio) { s.std = saved }(s.std)
+	s.std = std
+	s.sourceDepth++
+	defer func() {
+		s.sourceDepth--
+		s.returning = false
+	}()
+	s.lastStatus = 0
+	if err := s.runFile(resolvePath(s.workingDir, args[0])); err != nil {
+		if isSyntaxError(err) {
+			return exitStatus(2)
+		}
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = fmt.Errorf("%s: %v", args[0], pathErr.Err)
+		}
+		return err
+	}
+	if s.lastStatus != 0 {
+		return exitStatus(s.lastStatus)
+	}
+	return nil
+}
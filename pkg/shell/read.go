@@ -0,0 +1,136 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+func init() {
+	addBuiltin("read", "read [-r] [-p PROMPT] [NAME ...]", "read a line of stdin into variables", (*Shell).builtinRead)
+}
+
+// builtinRead implements `read [-r] [-p PROMPT] [NAME ...]`, which reads a
+// line of stdin and assigns its words, split at the characters of $IFS, to
+// the NAMEs, the last one getting the rest of the line; REPLY gets the whole
+// line when no NAME is given. A backslash escapes the character after it,
+// and a newline to go on with the next line, unless -r is given. PROMPT is
+// printed first when stdin is a terminal. The status is 1 at the end of the
+// input.
+func (s *Shell) builtinRead(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("read", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	raw := fs.Bool("r", false, "keep backslashes")
+	prompt := fs.String("p", "", "the prompt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	names := fs.Args()
+	for _, name := range names {
+		if !isVarName(name) {
+			return fmt.Errorf("%s: not a valid identifier", name)
+		}
+	}
+
+	if f, ok := std.in.(*os.File); ok && *prompt != "" && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(std.err, *prompt)
+	}
+	line, escaped, err := readLine(std.in, *raw)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if len(names) == 0 {
+		s.setVar("REPLY", string(line))
+	} else {
+		ifs, set := s.lookupVar("IFS")
+		if !set {
+			ifs = " \t\n"
+		}
+		for i, word := range splitRead(line, escaped, ifs, len(names)) {
+			s.setVar(names[i], word)
+		}
+	}
+	if err == io.EOF {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// readLine reads a line from r a byte at a time, so that what comes after
+// it is left for the commands that read r next. Unless raw, backslashes are
+// removed, escaped tells which bytes they escaped, and escaped newlines are
+// dropped. The error is io.EOF when the input ends before a newline, even
+// with nothing read.
+func readLine(r io.Reader, raw bool) (line []byte, escaped []bool, err error) {
+	var buf [1]byte
+	escape := false
+	for {
+		n, err := r.Read(buf[:])
+		if n == 0 {
+			if err == nil {
+				continue
+			}
+			return line, escaped, err
+		}
+		c := buf[0]
+		switch {
+		case escape:
+			escape = false
+			if c == '\n' {
+				continue
+			}
+			line, escaped = append(line, c), append(escaped, true)
+		case c == '\\' && !raw:
+			escape = true
+		case c == '\n':
+			return line, escaped, nil
+		default:
+			line, escaped = append(line, c), append(escaped, false)
+		}
+	}
+}
+
+// splitRead splits line into at most n words at the characters of ifs that
+// aren't escaped. The spaces, tabs and newlines of ifs around the words are
+// dropped, and the last word is the rest of the line. Missing words are "".
+func splitRead(line []byte, escaped []bool, ifs string, n int) []string {
+	isIFS := func(i int) bool { return !escaped[i] && strings.IndexByte(ifs, line[i]) >= 0 }
+	isSpace := func(i int) bool { return isIFS(i) && strings.IndexByte(" \t\n", line[i]) >= 0 }
+
+	start, end := 0, len(line)
+	for start < end && isSpace(start) {
+		start++
+	}
+	for end > start && isSpace(end-1) {
+		end--
+	}
+	words := make([]string, n)
+	i := start
+	for w := 0; w < n-1 && i < end; w++ {
+		j := i
+		for j < end && !isIFS(j) {
+			j++
+		}
+		words[w] = string(line[i:j])
+		// the separator: spaces, with at most one other IFS character
+		for j < end && isSpace(j) {
+			j++
+		}
+		if j < end && isIFS(j) && !isSpace(j) {
+			j++
+			for j < end && isSpace(j) {
+				j++
+			}
+		}
+		i = j
+	}
+	if i < end {
+		words[n-1] = string(line[i:end])
+	}
+	return words
+}
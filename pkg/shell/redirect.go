@@ -0,0 +1,158 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+	"golang.org/x/sys/unix"
+)
+
+// redirect is an I/O redirection of a command's file descriptor fd, with its
+// target expanded: < file, > file, >> file, >| file, which overwrites the
+// file even with `set -o noclobber`, &> file and &>> file, which redirect
+// both stdout and stderr, or <&FD and >&FD, which make fd a copy of FD: one
+// of the command's streams, as in 2>&1, or a file descriptor of the shell
+// such as a coprocess pipe.
+type redirect struct {
+	fd     int
+	op     string
+	target string
+}
+
+func (s *Shell) expandRedirects(redirs []*parser.Redirect) []redirect {
+	expanded := make([]redirect, len(redirs))
+	for i, r := range redirs {
+		expanded[i] = redirect{fd: r.N, op: r.Op, target: s.expandWord(r.Target)}
+	}
+	return expanded
+}
+
+// applyRedirects opens the redirection targets, returning std with them
+// applied and the files to close once the command is done. Redirections
+// apply from left to right, so that > log 2>&1 sends both streams to log
+// while 2>&1 > log only sends stdout there.
+func (s *Shell) applyRedirects(redirs []redirect, std *stdio) (*stdio, []*os.File, error) {
+	redirected := *std
+	var files []*os.File
+	fail := func(err error) (*stdio, []*os.File, error) {
+		closeFiles(files)
+		return nil, nil, err
+	}
+	for _, r := range redirs {
+		if r.fd > 2 {
+			return fail(fmt.Errorf("%d: redirecting this file descriptor is not supported", r.fd))
+		}
+
+		// target is a file opened, or the stream being copied
+		var target any
+		switch {
+		case r.op == "<&" && r.target == "0":
+			target = redirected.in
+		case r.op == ">&" && r.target == "1":
+			target = redirected.out
+		case r.op == ">&" && r.target == "2":
+			target = redirected.err
+		default:
+			f, err := s.openRedirect(r)
+			if err != nil {
+				return fail(err)
+			}
+			files = append(files, f)
+			target = f
+		}
+
+		if r.fd == 0 {
+			in, ok := target.(io.Reader)
+			if !ok {
+				return fail(fmt.Errorf("%s: bad file descriptor", r.target))
+			}
+			redirected.in = in
+			continue
+		}
+		out, ok := target.(io.Writer)
+		if !ok {
+			return fail(fmt.Errorf("%s: bad file descriptor", r.target))
+		}
+		switch {
+		case r.op[0] == '&':
+			redirected.out, redirected.err = out, out
+		case r.fd == 1:
+			redirected.out = out
+		default:
+			redirected.err = out
+		}
+	}
+	return &redirected, files, nil
+}
+
+// openRedirect opens the file, or duplicates the shell file descriptor, that
+// r redirects to.
+func (s *Shell) openRedirect(r redirect) (*os.File, error) {
+	name := r.target
+	if !path.IsAbs(name) {
+		name = path.Join(s.workingDir, name)
+	}
+
+	var f *os.File
+	var err error
+	switch r.op {
+	case "<&", ">&":
+		return dupFile(r.target)
+	case "<":
+		f, err = os.Open(name)
+	case ">>", "&>>":
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	case ">", "&>":
+		if s.option("noclobber") {
+			f, err = openNoClobber(name)
+			break
+		}
+		fallthrough
+	case ">|":
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	}
+	// report the file as it was written, not its absolute path
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return nil, fmt.Errorf("%s: %v", r.target, pathErr.Err)
+	}
+	return f, err
+}
+
+// openNoClobber opens name for > under noclobber: existing regular files are
+// not overwritten, while devices such as /dev/null still can be.
+func openNoClobber(name string) (*os.File, error) {
+	info, err := os.Stat(name)
+	if err == nil && info.Mode().IsRegular() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("cannot overwrite existing file")}
+	}
+	if err == nil {
+		return os.OpenFile(name, os.O_WRONLY, 0)
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+}
+
+// dupFile returns a duplicate of the shell's file descriptor fd.
+func dupFile(fd string) (*os.File, error) {
+	n, err := strconv.Atoi(fd)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s: bad file descriptor", fd)
+	}
+	dup, err := unix.Dup(n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fd, err)
+	}
+	unix.CloseOnExec(dup)
+	return os.NewFile(uintptr(dup), "fd "+fd), nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
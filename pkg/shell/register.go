@@ -0,0 +1,107 @@
+package shell
+
+import (
+	"context"
+	"io"
+)
+
+// IO holds the standard streams of a builtin, connected to the terminal, to
+// redirected files or to the pipes of a pipeline.
+type IO struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+// A Builtin is a command run by the shell itself, added with Register. Run
+// returns nil when it succeeds, and ExitStatus(n) to fail with status n
+// without a message. The other errors are printed after the name of the
+// builtin, with status 1. ctx is cancelled when the user hits Ctrl-C.
+type Builtin interface {
+	Name() string
+	Run(ctx context.Context, args []string, io IO) error
+}
+
+// A BuiltinDoc is a Builtin that tells help how it is used, as in "greet
+// [-n] NAME", and what it does, in a few words.
+type BuiltinDoc interface {
+	Builtin
+	Usage() string
+	Summary() string
+}
+
+// ExitStatus returns the error a Builtin returns to exit with status n, or
+// nil for 0.
+func ExitStatus(n int) error {
+	if n == 0 {
+		return nil
+	}
+	return exitStatus(n)
+}
+
+// Register adds a builtin to the shell, or replaces the one of the same
+// name, native ones included. It runs like the native builtins: it takes
+// precedence over PATH, can be a pipeline stage, have its streams
+// redirected, and is offered by command correction and help.
+func (s *Shell) Register(b Builtin) {
+	if s.builtins == nil {
+		s.builtins = make(map[string]Builtin)
+	}
+	s.builtins[b.Name()] = b
+}
+
+// BuiltinFunc implements a builtin added with RegisterBuiltin. It returns the
+// exit status of the command. ctx is cancelled when the user hits Ctrl-C.
+type BuiltinFunc func(ctx context.Context, args []string, io IO) int
+
+// RegisterBuiltin registers fn as the builtin called name.
+func (s *Shell) RegisterBuiltin(name string, fn BuiltinFunc) {
+	s.Register(funcBuiltin{name, fn})
+}
+
+// funcBuiltin is a BuiltinFunc registered as a Builtin.
+type funcBuiltin struct {
+	name string
+	fn   BuiltinFunc
+}
+
+func (b funcBuiltin) Name() string {
+	return b.name
+}
+
+func (b funcBuiltin) Run(ctx context.Context, args []string, io IO) error {
+	return ExitStatus(b.fn(ctx, args, io))
+}
+
+// runRegisteredBuiltin runs b, the shell in its context, cancelling the
+// context on Ctrl-C. The native builtins wait for the interrupts themselves
+// instead, to pass them on to the commands they run.
+func (s *Shell) runRegisteredBuiltin(b Builtin, args []string, std *stdio) error {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), shellKey{}, s))
+	defer cancel()
+
+	if _, native := b.(*builtin); !native {
+		for len(s.signalChan) > 0 {
+			<-s.signalChan
+		}
+		go func() {
+			select {
+			case <-s.signalChan:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return b.Run(ctx, args, IO{In: std.in, Out: std.out, Err: std.err})
+}
+
+// builtinCommandNames returns the names of the builtins, native and
+// registered.
+func (s *Shell) builtinCommandNames() []string {
+	names := make([]string, 0, len(s.builtins))
+	for name := range s.builtins {
+		names = append(names, name)
+	}
+	return names
+}
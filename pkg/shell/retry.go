@@ -0,0 +1,73 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+)
+
+func init() {
+	addBuiltin("retry", "retry [--times N] [--delay D] [--backoff D] CMD ...", "run a command again until it succeeds", (*Shell).builtinRetry)
+}
+
+// builtinRetry implements `retry [--times N] [--delay D] [--backoff D] cmd`.
+// It runs cmd until it succeeds, at most N times (3 by default), waiting D
+// between attempts (1s by default). With --backoff the wait starts at the
+// given duration and doubles after every failure. The error of the last
+// attempt is returned.
+func (s *Shell) builtinRetry(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("retry", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	times := fs.Int("times", 3, "maximum number of attempts")
+	delay := fs.Duration("delay", time.Second, "wait between attempts")
+	backoff := fs.Duration("backoff", 0, "initial wait, doubled after each failure")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing command")
+	}
+	if *times < 1 {
+		return fmt.Errorf("invalid number of attempts %d", *times)
+	}
+
+	wait := *delay
+	if *backoff > 0 {
+		wait = *backoff
+	}
+
+	// forget interrupts received before we started
+	for len(s.signalChan) > 0 {
+		<-s.signalChan
+	}
+
+	var err error
+	for attempt := 1; attempt <= *times; attempt++ {
+		err = s.runForeground(s.newCommand(fs.Arg(0), fs.Args()[1:]), std)
+		if err == nil {
+			return nil
+		}
+		// in its own process group, the command gets Ctrl-C and Ctrl-Z
+		// instead of the shell
+		if status := statusOf(err); status == 128+int(syscall.SIGINT) || status == stoppedStatus {
+			return commandStatus(err)
+		}
+		if attempt == *times {
+			break
+		}
+
+		fmt.Fprintf(std.err, "retry: attempt %d/%d failed (%v), retrying in %v\n", attempt, *times, err, wait)
+		select {
+		case <-s.signalChan:
+			return commandStatus(err)
+		case <-time.After(wait):
+		}
+		if *backoff > 0 {
+			wait *= 2
+		}
+	}
+	return commandStatus(err)
+}
@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// rusage is the resource usage of a finished command, as reported by wait4.
+type rusage struct {
+	MaxRSS      int64         `json:"maxrss"` // kilobytes
+	User        time.Duration `json:"utime"`
+	Sys         time.Duration `json:"stime"`
+	MinorFaults int64         `json:"minflt"`
+	MajorFaults int64         `json:"majflt"`
+}
+
+func (r *rusage) String() string {
+	return fmt.Sprintf("rss %s user %.2fs sys %.2fs faults %d/%d",
+		formatKilobytes(r.MaxRSS), r.User.Seconds(), r.Sys.Seconds(), r.MinorFaults, r.MajorFaults)
+}
+
+func formatKilobytes(kb int64) string {
+	switch {
+	case kb >= 1<<20:
+		return fmt.Sprintf("%.1fG", float64(kb)/(1<<20))
+	case kb >= 1<<10:
+		return fmt.Sprintf("%.1fM", float64(kb)/(1<<10))
+	default:
+		return fmt.Sprintf("%dK", kb)
+	}
+}
+
+// recordRusage stores the resource usage of the finished processes of the
+// current command line when `set -o rusage` is on. For pipelines, CPU time
+// and faults are summed and the peak RSS is the largest one.
+func (s *Shell) recordRusage(states ...*os.ProcessState) {
+	if !s.option("rusage") {
+		return
+	}
+
+	var total *rusage
+	for _, state := range states {
+		if state == nil {
+			continue
+		}
+		ru, ok := state.SysUsage().(*syscall.Rusage)
+		if !ok {
+			continue
+		}
+		if total == nil {
+			total = &rusage{}
+		}
+		total.MaxRSS = max(total.MaxRSS, int64(ru.Maxrss))
+		total.User += time.Duration(syscall.TimevalToNsec(ru.Utime))
+		total.Sys += time.Duration(syscall.TimevalToNsec(ru.Stime))
+		total.MinorFaults += int64(ru.Minflt)
+		total.MajorFaults += int64(ru.Majflt)
+	}
+	if total == nil {
+		return
+	}
+
+	s.lastRusage = total
+	if s.current != nil {
+		s.current.Rusage = total
+	}
+}
+
+func init() {
+	addBuiltin("lastrusage", "lastrusage", "the resource usage of the last foreground command", (*Shell).builtinLastRusage)
+}
+
+// builtinLastRusage prints the resource usage of the last foreground command.
+func (s *Shell) builtinLastRusage(args []string, std *stdio) error {
+	if !s.option("rusage") {
+		fmt.Fprintln(std.out, "lastrusage: resource usage recording is off, enable it with 'set -o rusage'")
+		return nil
+	}
+	r := s.lastRusage
+	if r == nil {
+		fmt.Fprintln(std.out, "lastrusage: no command has finished yet")
+		return nil
+	}
+	fmt.Fprintf(std.out, "max rss       %s\n", formatKilobytes(r.MaxRSS))
+	fmt.Fprintf(std.out, "user time     %.3fs\n", r.User.Seconds())
+	fmt.Fprintf(std.out, "system time   %.3fs\n", r.Sys.Seconds())
+	fmt.Fprintf(std.out, "page faults   %d minor, %d major\n", r.MinorFaults, r.MajorFaults)
+	return nil
+}
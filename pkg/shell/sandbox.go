@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// sandboxConfig describes the isolation applied to a spawned command.
+type sandboxConfig struct {
+	NoNet    bool   `json:"nonet,omitempty"`
+	ReadOnly bool   `json:"readonly,omitempty"`
+	Seccomp  string `json:"seccomp,omitempty"`
+}
+
+func (c *sandboxConfig) enabled() bool {
+	return c != nil && (c.NoNet || c.ReadOnly || c.Seccomp != "")
+}
+
+// merge returns the union of the restrictions in c and other.
+func (c *sandboxConfig) merge(other *sandboxConfig) *sandboxConfig {
+	merged := *c
+	if other != nil {
+		merged.NoNet = merged.NoNet || other.NoNet
+		merged.ReadOnly = merged.ReadOnly || other.ReadOnly
+		if merged.Seccomp == "" {
+			merged.Seccomp = other.Seccomp
+		}
+	}
+	return &merged
+}
+
+func (c *sandboxConfig) String() string {
+	if !c.enabled() {
+		return "off"
+	}
+	var parts []string
+	if c.NoNet {
+		parts = append(parts, "no network")
+	}
+	if c.ReadOnly {
+		parts = append(parts, "read-only filesystem")
+	}
+	if c.Seccomp != "" {
+		parts = append(parts, "seccomp profile "+c.Seccomp)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sandboxFlags registers the sandbox options on fs, filling cfg.
+func sandboxFlags(fs *flag.FlagSet, cfg *sandboxConfig) {
+	fs.BoolVar(&cfg.NoNet, "n", false, "run without network access")
+	fs.BoolVar(&cfg.ReadOnly, "r", false, "mount the filesystem read-only")
+	fs.StringVar(&cfg.Seccomp, "s", "", "seccomp `profile` to apply ("+strings.Join(seccompProfileNames(), ", ")+")")
+}
+
+func init() {
+	addBuiltin("sandbox", "sandbox [-n] [-r] [-s PROFILE] CMD ...", "run a command without network, or with a read-only filesystem", (*Shell).builtinSandbox)
+}
+
+// builtinSandbox implements the sandbox builtin:
+//
+//	sandbox                       show the global sandbox settings
+//	sandbox -g [-n] [-r] [-s p]   set the global settings applied to every command
+//	sandbox -g off                disable the global sandbox
+//	sandbox [-n] [-r] [-s p] cmd  run a single command sandboxed
+func (s *Shell) builtinSandbox(args []string, std *stdio) error {
+	if len(args) == 0 {
+		fmt.Fprintln(std.out, "sandbox:", s.sandbox.String())
+		return nil
+	}
+
+	fs := flag.NewFlagSet("sandbox", flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	global := fs.Bool("g", false, "apply the settings to every command")
+	cfg := &sandboxConfig{}
+	sandboxFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if cfg.Seccomp != "" && !isSeccompProfile(cfg.Seccomp) {
+		return fmt.Errorf("unknown seccomp profile %q", cfg.Seccomp)
+	}
+
+	if *global {
+		if fs.Arg(0) == "off" {
+			s.sandbox = nil
+			return nil
+		}
+		if !cfg.enabled() {
+			return fmt.Errorf("-g requires at least one of -n, -r, -s or 'off'")
+		}
+		s.sandbox = cfg
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("missing command")
+	}
+	if !cfg.enabled() {
+		cfg.NoNet, cfg.ReadOnly = true, true
+	}
+
+	cmd := s.newCommand(fs.Arg(0), fs.Args()[1:])
+	if err := wrapSandbox(cmd, cfg.merge(s.sandbox)); err != nil {
+		return err
+	}
+	return commandStatus(s.runForeground(cmd, std))
+}
@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// RunScript runs the commands of a script file, as in `gosh script.sh a b`,
+// with args as its positional parameters, $1 and up, and returns the exit
+// status of the last command, or 2 when a syntax error stops it. A script
+// doesn't use the line editor, the startup files or the history, and its
+// interrupts stop gosh as well.
+func (s *Shell) RunScript(file string, args []string) int {
+	s.handleTermination()
+	s.arg0, s.positional = file, args
+	if err := s.runFile(file); err != nil {
+		if isSyntaxError(err) {
+			return s.shutdown()
+		}
+		status := 126
+		if errors.Is(err, fs.ErrNotExist) {
+			status = 127
+		}
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = fmt.Errorf("%s: %v", file, pathErr.Err)
+		}
+		fmt.Fprintln(s.Stderr, "gosh:", err)
+		return status
+	}
+	return s.shutdown()
+}
+
+// RunString runs command, the command line of `gosh -c command`, and returns
+// its exit status, 2 for a syntax error. Like a script, it runs without the
+// line editor. args are $0 and the positional parameters, as in
+// `gosh -c 'echo $1' gosh hello`.
+func (s *Shell) RunString(command string, args []string) int {
+	s.handleTermination()
+	if len(args) > 0 {
+		s.arg0, s.positional = args[0], args[1:]
+	}
+	s.execute(command)
+	return s.shutdown()
+}
+
+// RunStdin runs the commands read from stdin, as in `echo ls | gosh`, like a
+// script. It is what gosh does when stdin isn't a terminal.
+func (s *Shell) RunStdin() int {
+	s.handleTermination()
+	if err := s.runLines("stdin", byteReader{s.Stdin}); err != nil {
+		if !isSyntaxError(err) {
+			fmt.Fprintln(s.Stderr, "gosh:", err)
+		}
+	}
+	return s.shutdown()
+}
+
+// byteReader reads one byte at a time, so that the commands read from stdin
+// find the lines after theirs there, as in `printf 'cat\nhello\n' | gosh`.
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return b.r.Read(p[:1])
+}
@@ -0,0 +1,17 @@
+//go:build !linux || !(amd64 || arm64)
+
+package shell
+
+import "errors"
+
+func seccompProfileNames() []string {
+	return nil
+}
+
+func isSeccompProfile(name string) bool {
+	return false
+}
+
+func installSeccomp(profile string) error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,150 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Serve implements `gosh serve`, which exposes gosh to remote clients. Each
+// session runs its own shell on a pseudo-terminal, in the server process.
+//
+//	gosh serve --ssh :2222 [--host-key FILE] [--authorized-keys FILE]
+//	gosh serve --web :8080 [--token TOKEN]
+//
+// Both servers can run at the same time.
+func Serve(args []string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("gosh serve", flag.ContinueOnError)
+	sshAddr := fs.String("ssh", "", "serve SSH on this address, e.g. :2222")
+	hostKey := fs.String("host-key", path.Join(home, ".gosh_ssh_host_key"), "SSH host key, generated if missing")
+	authorizedKeys := fs.String("authorized-keys", path.Join(home, ".ssh", "authorized_keys"), "public keys allowed to log in over SSH")
+	webAddr := fs.String("web", "", "serve a browser terminal on this address, e.g. :8080")
+	token := fs.String("token", "", "access token of the browser terminal, random by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sshAddr == "" && *webAddr == "" {
+		fs.Usage()
+		return errors.New("nothing to serve: use --ssh ADDR and/or --web ADDR")
+	}
+
+	errs := make(chan error, 2)
+	if *sshAddr != "" {
+		go func() { errs <- serveSSH(*sshAddr, *hostKey, *authorizedKeys) }()
+	}
+	if *webAddr != "" {
+		go func() { errs <- serveWeb(*webAddr, *token) }()
+	}
+	return <-errs
+}
+
+// session is the shell of a remote session, run in the gosh serve process on
+// a pseudo-terminal of its own. The terminal is the controlling one of no
+// process, so there is no job control, and the keys that would raise signals
+// are turned into interrupts of the shell by Write.
+type session struct {
+	shell  *Shell
+	master *os.File // the server's end of the terminal
+	tty    *os.File // the shell's end
+}
+
+// newSession returns the session of a client with a terminal of type term,
+// of rows by cols.
+func newSession(term string, rows, cols int) (*session, error) {
+	master, tty, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	if err := setPTYSize(master, rows, cols); err != nil {
+		master.Close()
+		tty.Close()
+		return nil, err
+	}
+	sh, err := newRemoteShell(tty, tty, tty)
+	if err != nil {
+		master.Close()
+		tty.Close()
+		return nil, err
+	}
+	sh.openInterrupts()
+	sh.env["TERM"] = term
+	return &session{shell: sh, master: master, tty: tty}, nil
+}
+
+// newRemoteShell returns the shell of a remote client talking to it over in,
+// out and errs. Like sshd, it starts a login shell in the home directory.
+func newRemoteShell(in io.Reader, out, errs io.Writer) (*Shell, error) {
+	sh, err := NewShell(WithConfig(Config{Login: true}), WithStdin(in), WithStdout(out), WithStderr(errs))
+	if err != nil {
+		return nil, err
+	}
+	sh.remote = true
+	if home := sh.getVar("HOME"); home != "" {
+		sh.workingDir = home
+	}
+	return sh, nil
+}
+
+// run runs the shell until the user exits, or close hangs it up, and returns
+// its exit status. The output of the terminal ends with it.
+func (ss *session) run() int {
+	status, _ := ss.shell.Run(context.Background())
+	ss.tty.Close()
+	ss.shell.interrupts.Close()
+	ss.shell.interruptsWriter.Close()
+	return status
+}
+
+// Read reads the output of the terminal.
+func (ss *session) Read(p []byte) (int, error) {
+	return ss.master.Read(p)
+}
+
+// Write types keys on the terminal. While the terminal raises signals, the
+// interrupt and quit characters interrupt the shell and its commands, which
+// is what the kernel would do on a controlling terminal.
+func (ss *session) Write(keys []byte) (int, error) {
+	n, err := ss.master.Write(keys)
+	// the settings of the shell's end, which the master end reports
+	var termios *unix.Termios
+	if conn, err := ss.master.SyscallConn(); err == nil {
+		conn.Control(func(fd uintptr) {
+			termios, _ = unix.IoctlGetTermios(int(fd), ioctlGetTermios)
+		})
+	}
+	if termios == nil || termios.Lflag&unix.ISIG == 0 {
+		return n, err
+	}
+	for _, c := range keys[:n] {
+		switch c {
+		case termios.Cc[unix.VINTR]:
+			ss.shell.interrupt(syscall.SIGINT)
+		case termios.Cc[unix.VQUIT]:
+			ss.shell.interrupt(syscall.SIGQUIT)
+		}
+	}
+	return n, err
+}
+
+// resize sets the size of the terminal.
+func (ss *session) resize(rows, cols int) {
+	setPTYSize(ss.master, rows, cols)
+}
+
+// close hangs the session up when the client goes away: the commands running
+// get SIGHUP, and the shell then exits as on a hangup.
+func (ss *session) close() {
+	ss.shell.interrupt(syscall.SIGHUP)
+	ss.shell.terminate(syscall.SIGHUP)
+}
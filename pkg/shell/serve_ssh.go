@@ -0,0 +1,208 @@
+package shell
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func serveSSH(addr, hostKeyPath, authorizedKeysPath string) error {
+	signer, err := loadHostKey(hostKeyPath)
+	if err != nil {
+		return err
+	}
+	// fail early when no one could log in
+	if _, err := loadAuthorizedKeys(authorizedKeysPath); err != nil {
+		return err
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			// read on every login so that key changes apply right away
+			authorized, err := loadAuthorizedKeys(authorizedKeysPath)
+			if err != nil {
+				return nil, err
+			}
+			if !authorized[string(key.Marshal())] {
+				return nil, fmt.Errorf("unknown public key for %s", conn.User())
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"fingerprint": ssh.FingerprintSHA256(key)}}, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("gosh: serving SSH on %s (host key %s)", ln.Addr(), ssh.FingerprintSHA256(signer.PublicKey()))
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go handleSSHConn(conn, config)
+	}
+}
+
+// loadHostKey reads the SSH host key, generating an ed25519 key the first
+// time.
+func loadHostKey(file string) (ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "gosh host key")
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			return nil, err
+		}
+		log.Printf("gosh: generated SSH host key %s", file)
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// loadAuthorizedKeys reads an authorized_keys file, indexed by wire format.
+func loadAuthorizedKeys(file string) (map[string]bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	for len(data) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			// no more keys
+			break
+		}
+		keys[string(key.Marshal())] = true
+		data = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no authorized keys", file)
+	}
+	return keys, nil
+}
+
+func handleSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		log.Printf("gosh: %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	log.Printf("gosh: %s logged in as %s with key %s", sconn.RemoteAddr(), sconn.User(), sconn.Permissions.Extensions["fingerprint"])
+	defer log.Printf("gosh: %s disconnected", sconn.RemoteAddr())
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Printf("gosh: %s: %v", sconn.RemoteAddr(), err)
+			continue
+		}
+		go handleSSHSession(channel, requests)
+	}
+}
+
+// handleSSHSession runs a gosh session for a session channel: on a
+// pseudo-terminal when the client asked for one, or else reading the
+// commands from the channel as from a pipe. Only shells are supported, not
+// exec requests.
+func handleSSHSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	term, rows, cols := "xterm", 24, 80
+	withPTY, started := false, false
+	var ss *session
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			var pty struct {
+				Term               string
+				Cols, Rows, Dx, Dy uint32
+				Modes              string
+			}
+			if err := ssh.Unmarshal(req.Payload, &pty); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			term, rows, cols = pty.Term, int(pty.Rows), int(pty.Cols)
+			withPTY = true
+			req.Reply(true, nil)
+		case "window-change":
+			var size struct{ Cols, Rows, Dx, Dy uint32 }
+			if err := ssh.Unmarshal(req.Payload, &size); err == nil {
+				rows, cols = int(size.Rows), int(size.Cols)
+				if ss != nil {
+					ss.resize(rows, cols)
+				}
+			}
+		case "shell":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+			started = true
+			if !withPTY {
+				sh, err := newRemoteShell(channel, channel, channel.Stderr())
+				if err != nil {
+					fmt.Fprintf(channel.Stderr(), "gosh: %v\n", err)
+					req.Reply(false, nil)
+					return
+				}
+				req.Reply(true, nil)
+				go func() {
+					sendExitStatus(channel, sh.RunStdin())
+					channel.Close()
+				}()
+				continue
+			}
+
+			var err error
+			if ss, err = newSession(term, rows, cols); err != nil {
+				fmt.Fprintf(channel.Stderr(), "gosh: %v\r\n", err)
+				req.Reply(false, nil)
+				return
+			}
+			req.Reply(true, nil)
+			defer ss.master.Close()
+			// the shell is hung up when the client goes away first
+			defer ss.close()
+
+			status := make(chan int, 1)
+			go func() { status <- ss.run() }()
+			go io.Copy(ss, channel)
+			go func() {
+				io.Copy(channel, ss)
+				sendExitStatus(channel, <-status)
+				channel.Close()
+			}()
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// sendExitStatus tells the client the exit status of its shell.
+func sendExitStatus(channel ssh.Channel, status int) {
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+}
@@ -0,0 +1,52 @@
+package shell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ss, err := newSession("xterm", 24, 80)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ss.master.Close()
+	status := make(chan int, 1)
+	go func() { status <- ss.run() }()
+
+	var out bytes.Buffer
+	output := make(chan struct{})
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := ss.Read(buf)
+			out.Write(buf[:n])
+			if err != nil {
+				close(output)
+				return
+			}
+		}
+	}()
+
+	// Ctrl-C stops the command, not the shell
+	ss.Write([]byte("sleep 10\r"))
+	time.Sleep(200 * time.Millisecond)
+	ss.Write([]byte("\x03"))
+	ss.Write([]byte("echo status $? $TERM\r"))
+	ss.Write([]byte("exit 3\r"))
+	select {
+	case got := <-status:
+		if got != 3 {
+			t.Errorf("got status %d, want 3", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session didn't exit")
+	}
+	<-output
+	if !strings.Contains(out.String(), "status 130 xterm\r\n") {
+		t.Errorf("got output %q, want status 130 xterm in it", out.String())
+	}
+}
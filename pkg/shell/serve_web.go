@@ -0,0 +1,124 @@
+package shell
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+//go:embed serve_web.html
+var webTerminalPage []byte
+
+const webTokenCookie = "gosh_token"
+
+// serveWeb serves a browser terminal built on xterm.js, talking to a gosh
+// session over a WebSocket. Access requires the token printed at startup,
+// passed once as ?token= and then kept in a cookie.
+func serveWeb(addr, token string) error {
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		token = hex.EncodeToString(b)
+	}
+	authorized := func(r *http.Request) bool {
+		given := r.URL.Query().Get("token")
+		if c, err := r.Cookie(webTokenCookie); err == nil && given == "" {
+			given = c.Value
+		}
+		return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if !authorized(r) {
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: webTokenCookie, Value: token, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webTerminalPage)
+	})
+	sessions := websocket.Server{Handler: handleWebSession}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		sessions.ServeHTTP(w, r)
+	})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("gosh: serving the web terminal on http://%s/?token=%s", ln.Addr(), token)
+	return http.Serve(ln, mux)
+}
+
+// handleWebSession runs a gosh session for a WebSocket connection. Output is
+// sent as binary messages; the browser sends "i" followed by input, or "r"
+// followed by the terminal size.
+func handleWebSession(ws *websocket.Conn) {
+	defer ws.Close()
+	log.Printf("gosh: web session from %s", ws.Request().RemoteAddr)
+	defer log.Printf("gosh: web session from %s closed", ws.Request().RemoteAddr)
+
+	ss, err := newSession("xterm-256color", 24, 80)
+	if err != nil {
+		log.Printf("gosh: %v", err)
+		return
+	}
+	defer ss.master.Close()
+	// the shell is hung up when the connection closes first
+	defer ss.close()
+	go ss.run()
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := ss.Read(buf)
+			if n > 0 {
+				if err := websocket.Message.Send(ws, buf[:n]); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		ws.Close()
+	}()
+
+	for {
+		var msg string
+		// fails once either side closed the connection
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return
+		}
+		if msg == "" {
+			continue
+		}
+		switch msg[0] {
+		case 'i':
+			ss.Write([]byte(msg[1:]))
+		case 'r':
+			var rows, cols int
+			if _, err := fmt.Sscanf(msg[1:], "%d %d", &rows, &cols); err == nil && rows > 0 && cols > 0 {
+				ss.resize(rows, cols)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// SessionLog configures the logging of a whole terminal session.
+type SessionLog struct {
+	Dir       string // where the log files go, ~/.gosh_logs by default
+	Input     bool   // also log what is typed
+	StripANSI bool   // log plain text instead of the raw terminal output
+	Shell     Config // the settings of the logged shell
+}
+
+// RunLogged runs an interactive gosh on a pseudo-terminal, copying everything
+// it prints, and optionally the input, to a new log file named after the
+// session start time. It returns the exit status of the session.
+func RunLogged(cfg SessionLog) (int, error) {
+	if cfg.Dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return 1, err
+		}
+		cfg.Dir = path.Join(home, ".gosh_logs")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return 1, err
+	}
+	start := time.Now()
+	logFile, err := os.OpenFile(path.Join(cfg.Dir, start.Format("gosh-20060102-150405.log")), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return 1, err
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "# gosh session started %s\n", start.Format(time.RFC3339))
+
+	var log io.Writer = logFile
+	if cfg.StripANSI {
+		stripper := &ansiStripper{w: logFile}
+		defer stripper.Flush()
+		log = stripper
+	}
+	// output and input are logged from different goroutines
+	log = &lockedWriter{w: log}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 1, err
+	}
+	cmd := exec.Command(executable, cfg.Shell.args()...)
+	rows, cols := 24, 80
+	stdinFd := int(os.Stdin.Fd())
+	if w, h, err := term.GetSize(stdinFd); err == nil {
+		rows, cols = h, w
+	}
+	master, err := startOnPTY(cmd, rows, cols)
+	if err != nil {
+		return 1, err
+	}
+	defer master.Close()
+
+	if state, err := term.MakeRaw(stdinFd); err == nil {
+		defer term.Restore(stdinFd, state)
+	}
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+	go func() {
+		for range resized {
+			if w, h, err := term.GetSize(stdinFd); err == nil {
+				setPTYSize(master, h, w)
+			}
+		}
+	}()
+
+	var input io.Writer = master
+	if cfg.Input {
+		input = io.MultiWriter(master, log)
+	}
+	go io.Copy(input, os.Stdin)
+	// ends when the session exits and the terminal is gone
+	io.Copy(io.MultiWriter(os.Stdout, log), master)
+
+	err = cmd.Wait()
+	fmt.Fprintf(log, "\n# gosh session ended %s\n", time.Now().Format(time.RFC3339))
+	return statusOf(err), nil
+}
+
+// ansiStripper renders terminal output to plain lines for the session log:
+// escape sequences are dropped, and carriage returns, backspaces and
+// clear-line sequences overwrite the current line like a terminal would.
+type ansiStripper struct {
+	w     io.Writer
+	line  []rune
+	col   int
+	state int // 0: text, 1: after ESC, 2: in CSI, 3: in OSC
+	param []byte
+}
+
+func (a *ansiStripper) Write(p []byte) (int, error) {
+	for _, r := range string(p) {
+		switch a.state {
+		case 1:
+			switch r {
+			case '[':
+				a.state, a.param = 2, a.param[:0]
+			case ']':
+				a.state = 3
+			default:
+				a.state = 0
+			}
+			continue
+		case 2:
+			if r >= 0x40 && r <= 0x7e {
+				a.state = 0
+				if r == 'K' {
+					a.clearLine(string(a.param))
+				}
+			} else {
+				a.param = append(a.param, byte(r))
+			}
+			continue
+		case 3:
+			// OSC sequences end with BEL or ESC \
+			if r == '\a' {
+				a.state = 0
+			} else if r == 0x1b {
+				a.state = 1
+			}
+			continue
+		}
+
+		switch r {
+		case 0x1b:
+			a.state = 1
+		case '\r':
+			a.col = 0
+		case '\b':
+			a.col = max(0, a.col-1)
+		case '\n':
+			if err := a.writeLine(); err != nil {
+				return 0, err
+			}
+		case '\a':
+		default:
+			if a.col < len(a.line) {
+				a.line[a.col] = r
+			} else {
+				a.line = append(a.line, r)
+			}
+			a.col++
+		}
+	}
+	return len(p), nil
+}
+
+func (a *ansiStripper) clearLine(param string) {
+	switch param {
+	case "2":
+		a.line = a.line[:0]
+	case "", "0":
+		a.line = a.line[:min(a.col, len(a.line))]
+	}
+}
+
+func (a *ansiStripper) writeLine() error {
+	_, err := fmt.Fprintf(a.w, "%s\n", string(a.line))
+	a.line, a.col = a.line[:0], 0
+	return err
+}
+
+// Flush writes the pending incomplete line, if any.
+func (a *ansiStripper) Flush() error {
+	if len(a.line) == 0 {
+		return nil
+	}
+	return a.writeLine()
+}
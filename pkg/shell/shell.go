@@ -0,0 +1,987 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+	"golang.org/x/sys/unix"
+)
+
+// A Shell is a gosh session: its variables, functions, aliases, options,
+// jobs and history.
+type Shell struct {
+	// Stdin, Stdout and Stderr are the streams of the shell: its prompt and
+	// line editor, its messages, and the commands it runs, use them. NewShell
+	// sets them to the process's, or to those of WithStdin, WithStdout and
+	// WithStderr; they aren't to be changed once the shell runs.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	workingDir        string
+	signalChan        chan os.Signal
+	historyFilepath   string
+	historyRead       int64          // the size of the history file when this session last read or wrote it whole
+	historyAppended   map[string]int // the lines it appended to the file since
+	history           []*historyEntry
+	current           *historyEntry
+	lastRusage        *rusage
+	historyPos        int
+	searchText        string // what Up searches the history for
+	searchPos         int    // the entry of the history it found, len(history) for none
+	input             string
+	cursor            int
+	cursorRow         int
+	lastPrinted       int
+	sandbox           *sandboxConfig
+	limits            *limitsConfig
+	policy            *policy
+	options           map[string]bool
+	stdin             *bufio.Reader
+	termState         *unix.Termios
+	chpwdHooks        []chpwdHook
+	precmdHooks       []func()
+	preexecHooks      []func(line string)
+	inHook            bool // while the hook functions run
+	exitHooks         []func()
+	traps             map[string]string
+	abbrs             map[string]string
+	aliases           map[string]string
+	coprocs           map[string]*coproc
+	handlingNotFound  bool // while a command_not_found handler runs
+	jobs              []*job
+	vars              map[string]string
+	env               map[string]string // the exported variables
+	startTime         time.Time
+	lineno            int // of the command line typed at the prompt
+	line              int // of the statement running, for $LINENO
+	lastStatus        int
+	pipeStatus        []int
+	lastArg           string // of the last command run, for $_
+	arg0              string // $0
+	positional        []string
+	functions         map[string]*parser.FuncDecl
+	locals            [][]savedVar // the variables each running function declared local, as they were before
+	returning         bool         // set by return until the function or sourced file is left
+	exiting           bool         // set by exit until the shell shuts down
+	exitCode          int          // the status exit was given
+	sourceDepth       int
+	interactive       bool
+	remote            bool // a session of gosh serve, see newRemoteShell
+	lastBackgroundPid int
+	jobControl        bool
+	shellPgid         int
+	childSignals      chan os.Signal
+	currentStmt       string
+	stoppedWarning    int
+	config            Config
+	builtins          map[string]Builtin
+	completers        map[string]Completer
+	termMu            sync.Mutex
+	reading           bool
+	interrupts        *os.File // read end of the pipe SIGINT wakes the line editor up with
+	interruptsWriter  *os.File
+	pendingExit       atomic.Int32 // the terminating signal caught, for exitOnSignal
+	std               *stdio       // what commands run with: the terminal, or the pipe of a $(...)
+	jobNotices        []string
+	timingsMu         sync.Mutex
+	timings           map[string]*timing
+	cpuProfile        *os.File
+	scriptFile        string
+	scriptLine        int
+	dirEnv            *dirEnv
+	commands          commandCache
+	keymaps           map[string]keymap
+	viCommandMode     bool
+	inputrcVars       map[string]string
+	pendingKeys       []byte
+	lastEdit          string
+	killRing          []string
+	yankIndex         int
+	yankLen           int
+	atEOF             bool
+	suggesting        bool
+}
+
+// NewShell returns a shell in the working directory of the process,
+// configured by opts.
+func NewShell(opts ...Option) (*Shell, error) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	userDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	historyPath := path.Join(userDir, historyFilename)
+
+	pol, err := loadPolicy(policyPath(userDir), path.Join(userDir, policyLogFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Shell{
+		workingDir:      pwd,
+		signalChan:      make(chan os.Signal, 1),
+		historyFilepath: historyPath,
+		policy:          pol,
+		options:         map[string]bool{"autosuggest": true, "emacs": true, "histexpand": true},
+		Stdin:           os.Stdin,
+		Stdout:          os.Stdout,
+		Stderr:          os.Stderr,
+		dirEnv:          &dirEnv{allowPath: path.Join(userDir, dirEnvAllowFilename)},
+		vars:            make(map[string]string),
+		env:             environMap(os.Environ()),
+		functions:       make(map[string]*parser.FuncDecl),
+		builtins:        defaultBuiltins(),
+		arg0:            "gosh",
+		startTime:       time.Now(),
+		keymaps: map[string]keymap{
+			"emacs":      defaultKeymap(),
+			"vi-insert":  defaultViInsertKeymap(),
+			"vi-command": defaultViCommandKeymap(),
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.stdin = bufio.NewReader(s.Stdin)
+	s.std = &stdio{in: s.Stdin, out: s.Stdout, err: s.Stderr}
+	s.loadInputrc(inputrcPath(userDir))
+	s.AddChpwdHook(s.dirEnvChpwd)
+	s.addFunctionHooks()
+	s.addExitHook(s.runExitTrap)
+	s.addExitHook(s.hangupOnExit)
+	s.addExitHook(s.hangupStoppedJobs)
+	return s, nil
+}
+
+// deleteChar deletes the character before the cursor.
+func (s *Shell) deleteChar() {
+	if s.cursor == 0 {
+		return
+	}
+	_, size := utf8.DecodeLastRuneInString(s.input[:s.cursor])
+	s.input = s.input[:s.cursor-size] + s.input[s.cursor:]
+	s.cursor -= size
+}
+
+func (s *Shell) isValidChar(r rune) bool {
+	if r == '\n' {
+		return true
+	}
+	return unicode.IsSpace(r) || unicode.IsDigit(r) || unicode.IsLetter(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// Run runs the shell interactively until ctx is done, or the user exits:
+// the startup files, then a prompt and the commands typed at it, with job
+// control and the history. It returns the exit status, with ErrExit when the
+// user exits, or with the error of ctx.
+func (s *Shell) Run(ctx context.Context) (int, error) {
+	s.interactive = true
+	if !s.remote {
+		// Ctrl-C and Ctrl-\ stop what the shell is doing, not the shell
+		signal.Notify(s.signalChan, os.Interrupt, syscall.SIGQUIT)
+		s.catchPromptInterrupts()
+		s.initJobControl()
+	}
+	s.handleTermination()
+
+	s.saveTerminal()
+	defer s.restoreTerminal()
+
+	if s.config.ProfileDir != "" {
+		if err := s.startProfiling(s.config.ProfileDir); err != nil {
+			fmt.Fprintln(s.Stderr, "gosh: profile:", err)
+		}
+	}
+
+	s.runChpwdHooks("", s.workingDir)
+	s.runStartupFiles()
+	// after the rc file, which sets HISTSIZE
+	s.loadHistory()
+
+	for !s.exiting {
+		select {
+		case <-ctx.Done():
+			return s.lastStatus, ctx.Err()
+		default:
+			s.prompt()
+		}
+	}
+	return s.shutdown(), ErrExit
+}
+
+// exit makes the shell exit with status. Like return, it stops the commands
+// running, up to Run, Eval or the script, which then shut the shell down.
+func (s *Shell) exit(status int) {
+	s.exiting, s.exitCode = true, status
+}
+
+// shutdown runs the exit hooks and restores the terminal, once the commands
+// have stopped, and returns the exit status: the one given to exit, or else
+// the last one. The history is saved already, each command line being added
+// to the file as it runs.
+func (s *Shell) shutdown() int {
+	if s.exiting {
+		s.lastStatus = s.exitCode
+	}
+	status := s.lastStatus
+	// for the EXIT trap to run, and maybe exit with another status
+	s.exiting = false
+	s.runExitHooks()
+	if s.exiting {
+		status = s.exitCode
+		s.exiting = false
+	}
+	s.restoreTerminal()
+	return status
+}
+
+func init() {
+	addBuiltin("exit", "exit [N]", "exit the shell with status N", (*Shell).builtinExit)
+}
+
+// builtinExit implements `exit [N]`. Without N, the status is the one of the
+// last command.
+func (s *Shell) builtinExit(args []string, std *stdio) error {
+	status := s.lastStatus
+	switch len(args) {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("%s: numeric argument required", args[0])
+		}
+		status = n & 0xff
+	default:
+		return errors.New("too many arguments")
+	}
+	if s.warnStoppedJobs() {
+		return exitStatus(1)
+	}
+	s.exit(status)
+	if status != 0 {
+		return exitStatus(status)
+	}
+	return nil
+}
+
+func (s *Shell) readInput() (string, error) {
+	s.newLine()
+	s.forgetInterrupts()
+	// a signal whose wake-up was just forgotten
+	s.exitOnSignal()
+	if s.exiting {
+		return "", errInterrupted
+	}
+
+	var seq string
+	for {
+		s.printPrompt()
+
+		s.setReading(true)
+		key, err := s.readKeyEvent()
+		s.setReading(false)
+		if errors.Is(err, errIdleTimeout) || errors.Is(err, io.EOF) {
+			return "", err
+		}
+		if errors.Is(err, errInterrupted) {
+			s.exitOnSignal()
+			if s.exiting {
+				return "", err
+			}
+			s.cancelLine()
+			seq = ""
+			continue
+		}
+		if err != nil {
+			fmt.Fprintln(s.Stdout, "error: ", err.Error())
+			break
+		}
+
+		// collect keys until they form a bound sequence or can't start one;
+		// a bound sequence runs right away even if it starts a longer one,
+		// so that ESC alone leaves insert mode in vi mode
+		seq += key.seq
+		keymap := s.currentKeymap()
+		if _, bound := keymap[seq]; !bound && keymap.isPrefix(seq) {
+			continue
+		}
+		done := s.handleKey(seq)
+		seq = ""
+		if s.atEOF {
+			fmt.Fprintln(s.Stdout)
+			return "", io.EOF
+		}
+		if s.exiting {
+			// a key bound to a command that exits
+			fmt.Fprintln(s.Stdout)
+			return "", errInterrupted
+		}
+		if done {
+			break
+		}
+	}
+
+	// the line as it runs, without the suggestion
+	s.suggesting = false
+	s.printPrompt()
+	// the terminal doesn't echo the Enter key
+	fmt.Fprintln(s.Stdout)
+
+	trimmedInput := strings.TrimSpace(string(s.input))
+	return trimmedInput, nil
+}
+
+// newLine starts editing an empty line, below the previous one.
+func (s *Shell) newLine() {
+	s.setInput("")
+	s.historyPos = 0
+	// the previous line has been scrolled away by now
+	s.lastPrinted = 0
+	s.lastEdit = ""
+	s.atEOF = false
+	s.viCommandMode = false
+	s.suggesting = true
+}
+
+// printPrompt redraws the prompt and the line being edited, which spans
+// several lines for a pasted block of commands.
+func (s *Shell) printPrompt() {
+	defer s.timed("render")()
+	s.termMu.Lock()
+	defer s.termMu.Unlock()
+	if s.lastPrinted > 0 {
+		// from the last line drawn, clear up to the first one
+		if down := s.lastPrinted - 1 - s.cursorRow; down > 0 {
+			fmt.Fprintf(s.Stdout, "\033[%dB", down)
+		}
+		fmt.Fprintf(s.Stdout, "%s\033[2K\r", strings.Repeat("\033[2K\033[A", s.lastPrinted-1))
+	}
+	var line string
+	line, s.lastPrinted, s.cursorRow = s.renderLine()
+	fmt.Fprint(s.Stdout, line)
+}
+
+func (s *Shell) changeDir(dir string) error {
+	if !path.IsAbs(dir) {
+		dir = path.Join(s.workingDir, dir)
+	}
+
+	_, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	oldDir := s.workingDir
+	s.workingDir = dir
+	s.runChpwdHooks(oldDir, dir)
+	return nil
+
+}
+
+// pipelineRun is a pipeline started by startPipeline.
+type pipelineRun struct {
+	wg     sync.WaitGroup
+	pgid   int   // of the process group of the commands, with job control
+	pids   []int // of the external commands, once started
+	errs   []error
+	states []*os.ProcessState
+}
+
+// wait waits for the commands of the pipeline and returns their errors.
+func (run *pipelineRun) wait() []error {
+	run.wg.Wait()
+	return run.errs
+}
+
+// startPipeline starts the commands of a pipeline concurrently, the first one
+// reading stdin and each of the others the output of the previous one
+// through a pipe, and returns once the external ones have been started, in a
+// process group of their own with job control. foreground gives it the
+// terminal.
+//
+// Nothing is buffered: when a command exits, as head does in `yes | head`,
+// the one writing to it is stopped by SIGPIPE, or an EPIPE error for a
+// builtin.
+func (s *Shell) startPipeline(pipeline *parser.Pipeline, stdin io.Reader, foreground bool) *pipelineRun {
+	run := &pipelineRun{
+		errs:   make([]error, len(pipeline.Cmds)),
+		states: make([]*os.ProcessState, len(pipeline.Cmds)),
+	}
+	var (
+		// the commands start in order, so that the first one leads the
+		// process group the others join
+		started = make([]chan struct{}, len(pipeline.Cmds))
+		mu      sync.Mutex
+		pids    = make([]int, len(pipeline.Cmds))
+	)
+	for i := range started {
+		started[i] = make(chan struct{})
+	}
+	var pipeIn *os.File
+	for i, command := range pipeline.Cmds {
+		std := &stdio{in: stdin, out: s.std.out, err: s.std.err}
+		var pipeOut *os.File
+		if i < len(pipeline.Cmds)-1 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				closeFile(pipeIn)
+				run.errs[len(run.errs)-1] = err
+				for _, ch := range started[i:] {
+					close(ch)
+				}
+				break
+			}
+			std.out, pipeOut = w, w
+			if pipeline.PipeStderr[i] {
+				std.err = w
+			}
+			stdin = r
+		}
+
+		command, ok := command.(*parser.SimpleCommand)
+		if !ok {
+			s.startCompound(run, i, pipeline.Cmds[i], std, pipeIn, pipeOut, started[i])
+			pipeIn, _ = stdin.(*os.File)
+			continue
+		}
+
+		// the words are expanded here rather than by the commands, which
+		// run concurrently, since ${NAME:=word} assigns; assignments only go
+		// to the environment of external commands
+		assigns := s.expandAssigns(command.Assigns)
+		fields := s.expandFields(command.Args)
+		redirs := s.expandRedirects(command.Redirs)
+		// a function or a builtin runs in a subshell, as a compound command
+		// does, the stages running at the same time
+		var fn *parser.FuncDecl
+		var sub *Shell
+		if len(fields) > 0 {
+			if fn = s.functions[fields[0]]; fn != nil || s.isBuiltin(fields[0], fields[1:]) {
+				sub = s.subshell(std)
+				for _, a := range assigns {
+					sub.exportVar(a.name, a.value)
+				}
+			}
+		}
+
+		run.wg.Add(1)
+		go func(i int, std *stdio, pipeIn, pipeOut *os.File) {
+			defer run.wg.Done()
+			// our ends of the pipes are closed once the command is done, so
+			// that the next one sees EOF and the previous one EPIPE
+			defer closeFile(pipeIn)
+			defer closeFile(pipeOut)
+			startDone := sync.OnceFunc(func() { close(started[i]) })
+			defer startDone()
+
+			std, files, err := s.applyRedirects(redirs, std)
+			defer closeFiles(files)
+			if err != nil {
+				fmt.Fprintln(s.Stderr, "gosh:", err)
+				run.errs[i] = exitStatus(1)
+				return
+			}
+			if len(fields) == 0 {
+				// only assignments, which don't outlive the pipeline
+				return
+			}
+
+			if fn != nil {
+				startDone()
+				sub.callFunction(fn, fields[1:], std)
+				if sub.lastStatus != 0 {
+					run.errs[i] = exitStatus(sub.lastStatus)
+				}
+				return
+			}
+			if sub != nil {
+				startDone()
+				_, err := sub.callBuiltin(fields[0], fields[1:], std)
+				run.errs[i] = sub.builtinDone(fields[0], err, std)
+				return
+			}
+			cmd := s.newCommand(fields[0], fields[1:])
+			if len(assigns) > 0 {
+				cmd.Env = s.assignmentEnv(assigns)
+			}
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = std.in, std.out, std.err
+			if i > 0 {
+				<-started[i-1]
+			}
+			mu.Lock()
+			s.setProcessGroup(cmd, run.pgid, foreground)
+			spawned := s.timed("spawn")
+			run.errs[i] = cmd.Start()
+			spawned()
+			if run.errs[i] == nil {
+				pids[i] = cmd.Process.Pid
+				if run.pgid == 0 && s.jobControl {
+					run.pgid = cmd.Process.Pid
+				}
+			}
+			mu.Unlock()
+			startDone()
+			if run.errs[i] == nil {
+				// a process group lives on as long as its leader isn't
+				// reaped, so it waits for the others to join
+				<-started[len(started)-1]
+				run.errs[i] = cmd.Wait()
+			}
+			run.states[i] = cmd.ProcessState
+			if run.errs[i] != nil && i < len(pipeline.Cmds)-1 {
+				if _, ok := run.errs[i].(*exec.ExitError); !ok {
+					fmt.Fprintln(s.Stderr, run.errs[i])
+				}
+			}
+		}(i, std, pipeIn, pipeOut)
+		pipeIn, _ = stdin.(*os.File)
+	}
+	<-started[len(started)-1]
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, pid := range pids {
+		if pid != 0 {
+			run.pids = append(run.pids, pid)
+		}
+	}
+	return run
+}
+
+// closeFile closes f unless it is nil.
+func closeFile(f *os.File) {
+	if f != nil {
+		f.Close()
+	}
+}
+
+// prompt reads a command line at the prompt and runs it, with the history
+// and the hooks around it, as each turn of Run does.
+func (s *Shell) prompt() {
+	s.reapJobs()
+	s.printJobNotices()
+	s.runPrecmdHooks()
+
+	// read keys one at a time, without echo, then give commands the
+	// terminal back as it was
+	s.enterEditMode()
+	fmt.Fprint(s.Stdout, "\033[?2004h")
+	input, err := s.readInput()
+	fmt.Fprint(s.Stdout, "\033[?2004l")
+	s.restoreTerminal()
+	if s.exiting {
+		// a signal, or a key binding running exit
+		return
+	}
+	if errors.Is(err, errIdleTimeout) {
+		fmt.Fprintln(s.Stdout, "\ntimed out waiting for input: auto-logout")
+		s.exit(0)
+		return
+	}
+	if errors.Is(err, io.EOF) {
+		// Ctrl-D on an empty line, or the end of the input
+		if s.warnStoppedJobs() {
+			return
+		}
+		fmt.Fprintln(s.Stdout, "exit")
+		s.exit(s.lastStatus)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(s.Stdout, "error reading input: ", err)
+		return
+	}
+
+	if s.option("histexpand") {
+		expanded, changed, err := s.expandHistory(input)
+		if err != nil {
+			fmt.Fprintln(s.Stderr, "gosh:", err)
+			s.lastStatus = 1
+			return
+		}
+		if changed {
+			// show what runs, as it goes to the history
+			fmt.Fprintln(s.Stdout, expanded)
+			input = expanded
+		}
+	}
+
+	s.lineno++
+	s.current = &historyEntry{Command: input, Start: time.Now(), Dir: s.workingDir}
+
+	if s.keepInHistory(s.input, input) {
+		defer s.addToHistory(s.current)
+	}
+	// runs before the entry is added to the history
+	defer func(entry *historyEntry) {
+		entry.Duration = time.Since(entry.Start)
+		entry.Status = s.lastStatus
+	}(s.current)
+
+	if input != "" {
+		s.runPreexecHooks(input)
+	}
+	// a pasted block runs line by line, as a single history entry
+	s.execute(input)
+}
+
+// execute parses and runs a command line, or several lines of commands. A
+// syntax error is reported, sets the status to 2, and is returned, so that
+// a script stops there.
+func (s *Shell) execute(input string) error {
+	parsed := s.timed("parse")
+	list, err := parser.ParseAliasesAt(input, s.aliases, s.inputLine())
+	parsed()
+	var syntaxErr *parser.Error
+	if errors.As(err, &syntaxErr) {
+		s.printSyntaxError(input, syntaxErr)
+		s.lastStatus = 2
+		return err
+	}
+	s.runList(list)
+	return nil
+}
+
+// inputLine returns the line the input of execute starts on: its line in the
+// file running, the number of the command line typed at the prompt, or else
+// 1, as for gosh -c.
+func (s *Shell) inputLine() int {
+	switch {
+	case s.scriptFile != "":
+		return s.scriptLine
+	case s.interactive:
+		return s.lineno
+	}
+	return 1
+}
+
+// runList runs the statements of a list one after the other.
+func (s *Shell) runList(list *parser.List) {
+	for _, stmt := range list.Stmts {
+		s.exitOnSignal()
+		if s.returning || s.exiting {
+			return
+		}
+		s.runStmt(stmt)
+	}
+	s.exitOnSignal()
+}
+
+// runStmt runs the pipelines of a statement from left to right, skipping
+// those after && when the last status is a failure, and those after || when
+// it is a success. The status is the one of the last pipeline run.
+func (s *Shell) runStmt(stmt *parser.Stmt) {
+	s.currentStmt = stmt.String()
+	s.line = stmt.Line
+	if stmt.Background {
+		s.runBackground(stmt)
+		return
+	}
+	s.runPipeline(stmt.Pipeline)
+	for _, next := range stmt.AndOr {
+		if !s.returning && !s.exiting && (next.Op == "&&") == (s.lastStatus == 0) {
+			s.runPipeline(next.Pipeline)
+		}
+	}
+}
+
+// runPipeline runs a pipeline, setting the exit status: the one of the last
+// command, or with pipefail, of the last one that failed. The status of each
+// command goes to $PIPESTATUS.
+func (s *Shell) runPipeline(pipeline *parser.Pipeline) {
+	if len(pipeline.Cmds) == 1 {
+		if command, ok := pipeline.Cmds[0].(*parser.SimpleCommand); ok {
+			s.runCommand(command)
+		} else {
+			s.runCompound(pipeline.Cmds[0])
+		}
+		s.pipeStatus = []int{s.lastStatus}
+		return
+	}
+
+	if !s.confirmPipeline(pipeline) {
+		s.lastStatus = 1
+		s.pipeStatus = []int{s.lastStatus}
+		return
+	}
+	run := s.startPipeline(pipeline, s.std.in, true)
+	j := s.newJob(run)
+	if !s.waitForeground(j) {
+		s.lastStatus = stoppedStatus
+		s.pipeStatus = []int{s.lastStatus}
+		return
+	}
+	s.recordRusage(run.states...)
+	errs := j.errs
+	s.reportCommandError(errs[len(errs)-1])
+	s.pipeStatus = errStatuses(errs)
+	s.lastStatus = s.pipelineStatus(s.pipeStatus)
+}
+
+// pipelineStatus returns the status of a pipeline from the ones of its
+// commands.
+func (s *Shell) pipelineStatus(statuses []int) int {
+	status := statuses[len(statuses)-1]
+	if s.option("pipefail") {
+		for _, st := range statuses {
+			if st != 0 {
+				status = st
+			}
+		}
+	}
+	return status
+}
+
+// pipelineFields returns the words of a pipeline as they will run, for the
+// confirmation guard.
+func (s *Shell) pipelineFields(pipeline *parser.Pipeline) []string {
+	var fields []string
+	for i, command := range pipeline.Cmds {
+		if i > 0 {
+			pipe := "|"
+			if pipeline.PipeStderr[i-1] {
+				pipe = "|&"
+			}
+			fields = append(fields, pipe)
+		}
+		// compound commands are guarded command by command as they run
+		if command, ok := command.(*parser.SimpleCommand); ok {
+			fields = append(fields, s.expandFields(command.Args)...)
+		}
+	}
+	return fields
+}
+
+// runCommand runs a simple command in the foreground, setting the exit
+// status.
+func (s *Shell) runCommand(command *parser.SimpleCommand) {
+	if len(command.Args) == 0 {
+		s.runAssignments(command)
+		return
+	}
+
+	expanded := s.timed("expand")
+	assigns := s.expandAssigns(command.Assigns)
+	fields := s.expandFields(command.Args)
+	redirs := s.expandRedirects(command.Redirs)
+	expanded()
+	if len(fields) > 0 {
+		s.lastArg = fields[len(fields)-1]
+	}
+
+	if len(fields) == 0 {
+		// the command word expanded to nothing, as with $EMPTY
+		for _, a := range assigns {
+			s.setVar(a.name, a.value)
+		}
+		if _, files, err := s.applyRedirects(redirs, s.terminalIO()); err != nil {
+			fmt.Fprintln(s.Stderr, "gosh:", err)
+			s.lastStatus = 1
+		} else {
+			closeFiles(files)
+			s.lastStatus = 0
+		}
+		return
+	}
+
+	if !s.confirmCommand(fields) {
+		s.lastStatus = 1
+		return
+	}
+
+	std, files, err := s.applyRedirects(redirs, s.terminalIO())
+	if err != nil {
+		fmt.Fprintln(s.Stderr, "gosh:", err)
+		s.lastStatus = 1
+		return
+	}
+	defer closeFiles(files)
+
+	commandName := fields[0]
+	args := fields[1:]
+
+	if fn, ok := s.functions[commandName]; ok {
+		s.withAssignments(assigns, func() {
+			s.callFunction(fn, args, std)
+		})
+		return
+	}
+
+	// built-in commands
+	var isBuiltin bool
+	s.withAssignments(assigns, func() {
+		isBuiltin = s.runBuiltin(commandName, args, std)
+	})
+	if isBuiltin {
+		return
+	}
+
+	// external commands, looked up with a PATH assigned ahead of them
+	var lookErr error
+	s.withAssignments(assigns, func() {
+		_, lookErr = s.lookPath(commandName)
+	})
+	if lookErr != nil {
+		s.lastStatus = 127
+		if s.runNotFoundHandler(commandName, args, std) {
+			return
+		}
+		var corrected string
+		var ok bool
+		s.withAssignments(assigns, func() {
+			corrected, ok = s.correctCommand(commandName)
+		})
+		if !ok {
+			return
+		}
+		if s.current != nil {
+			s.current.Command = strings.Join(append([]string{corrected}, args...), " ")
+		}
+		commandName = corrected
+		if fn, ok := s.functions[commandName]; ok {
+			s.withAssignments(assigns, func() {
+				s.callFunction(fn, args, std)
+			})
+			return
+		}
+		if _, ok := s.aliases[commandName]; ok {
+			s.withAssignments(assigns, func() {
+				s.runAlias(commandName, args, std)
+			})
+			return
+		}
+		s.withAssignments(assigns, func() {
+			isBuiltin = s.runBuiltin(commandName, args, std)
+		})
+		if isBuiltin {
+			return
+		}
+	}
+
+	var cmd *exec.Cmd
+	s.withAssignments(assigns, func() {
+		cmd = s.newCommand(commandName, args)
+	})
+	if len(assigns) > 0 {
+		cmd.Env = s.assignmentEnv(assigns)
+	}
+	err = s.runForeground(cmd, std)
+	s.reportCommandError(err)
+	s.lastStatus = statusOf(err)
+}
+
+// reportCommandError prints the error a command failed with, unless its exit
+// status, which $? has, tells it all. A command killed by a signal other
+// than SIGINT or SIGPIPE is reported, as in `signal: killed`.
+func (s *Shell) reportCommandError(err error) {
+	var status exitStatus
+	if err == nil || errors.As(err, &status) {
+		return
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		ws, ok := exitErr.Sys().(syscall.WaitStatus)
+		if !ok || !ws.Signaled() || ws.Signal() == syscall.SIGINT || ws.Signal() == syscall.SIGPIPE {
+			return
+		}
+	}
+	fmt.Fprintln(s.Stderr, "gosh:", err)
+}
+
+// newCommand builds the exec.Cmd for an external command run in the shell
+// working directory.
+func (s *Shell) newCommand(name string, args []string) *exec.Cmd {
+	var cmd *exec.Cmd
+	file, err := s.lookPath(name)
+	if err == nil && !strings.Contains(name, "/") {
+		// the path the cache has, which exec.Command doesn't look up again
+		cmd = exec.Command(file, args...)
+		cmd.Args[0] = name
+	} else {
+		cmd = exec.Command(name, args...)
+		if err != nil && !strings.Contains(name, "/") {
+			// not in the PATH of the shell, whatever the one of the process
+			cmd.Err = err
+		}
+	}
+	cmd.Dir = s.workingDir
+	cmd.Env = s.environ()
+	s.setupCommand(cmd)
+	return cmd
+}
+
+// setupCommand applies the shell-wide execution settings to cmd: the command
+// policy, the global resource limits and the global sandbox. Failures are stored in cmd.Err so that
+// starting the command reports them.
+func (s *Shell) setupCommand(cmd *exec.Cmd) {
+	if cmd.Err != nil {
+		return
+	}
+	if err := s.policy.enforce(cmd.Args, s.workingDir); err != nil {
+		cmd.Err = err
+		return
+	}
+	if s.limits.enabled() {
+		if _, err := wrapLimits(cmd, s.limits); err != nil {
+			cmd.Err = err
+			return
+		}
+	}
+	if s.sandbox.enabled() {
+		if err := wrapSandbox(cmd, s.sandbox); err != nil {
+			cmd.Err = err
+		}
+	}
+}
+
+// runForeground runs cmd connected to std and waits for it, as a job that
+// Ctrl-Z can stop.
+func (s *Shell) runForeground(cmd *exec.Cmd, std *stdio) error {
+	cmd.Stdout = std.out
+	cmd.Stdin = std.in
+	cmd.Stderr = std.err
+	s.setProcessGroup(cmd, 0, true)
+
+	spawned := s.timed("spawn")
+	err := cmd.Start()
+	spawned()
+	if err != nil {
+		s.recordRusage(cmd.ProcessState)
+		return err
+	}
+	run := &pipelineRun{pids: []int{cmd.Process.Pid}, errs: make([]error, 1)}
+	if s.jobControl {
+		run.pgid = cmd.Process.Pid
+	}
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		run.errs[0] = cmd.Wait()
+	}()
+	if !s.waitForeground(s.newJob(run)) {
+		return exitStatus(stoppedStatus)
+	}
+	s.recordRusage(cmd.ProcessState)
+	return run.errs[0]
+}
@@ -0,0 +1,69 @@
+package shell
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleTermination shuts the shell down cleanly when it is asked to
+// terminate, or when its terminal goes away: the EXIT trap runs as with
+// exit, and the status is the conventional 128 plus the signal number.
+//
+// The signal is only recorded here, for the main goroutine to act on in
+// exitOnSignal, between two commands or while it waits for a key, since the
+// trap and the exit hooks use the shell.
+//
+// The signals of a remote session are the server's, which calls terminate
+// itself when the client goes away.
+func (s *Shell) handleTermination() {
+	if s.remote {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		s.terminate((<-signals).(syscall.Signal))
+	}()
+}
+
+// terminate asks the shell to shut down as on sig.
+func (s *Shell) terminate(sig syscall.Signal) {
+	s.pendingExit.Store(int32(sig))
+	s.wakeLineEditor()
+}
+
+// exitOnSignal shuts the shell down if handleTermination caught a signal, once
+// the command running when it came is done.
+func (s *Shell) exitOnSignal() {
+	sig := syscall.Signal(s.pendingExit.Swap(0))
+	if sig == 0 {
+		return
+	}
+	// pass a hangup on to the background commands; with huponexit the exit
+	// hook does it for any signal
+	if sig == syscall.SIGHUP && !s.option("huponexit") {
+		s.hangupJobs()
+	}
+	s.exit(128 + int(sig))
+}
+
+// hangupJobs sends SIGHUP to the coprocesses and background jobs still
+// running.
+func (s *Shell) hangupJobs() {
+	s.signalJobs(syscall.SIGHUP)
+	for _, cp := range s.coprocs {
+		select {
+		case <-cp.done:
+		default:
+			cp.cmd.Process.Signal(syscall.SIGHUP)
+		}
+	}
+}
+
+// hangupOnExit is the exit hook behind the huponexit option.
+func (s *Shell) hangupOnExit() {
+	if s.option("huponexit") {
+		s.hangupJobs()
+	}
+}
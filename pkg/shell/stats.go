@@ -0,0 +1,131 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	addBuiltin("stats", "stats slow [--json] [N] | stats avg [--json]", "the slowest commands, and the average duration per command", (*Shell).builtinStats)
+}
+
+// builtinStats implements the stats builtin over the timed history entries:
+//
+//	stats slow [--json] [N]   the N slowest commands (10 by default)
+//	stats avg [--json]        run count and average duration per command name
+func (s *Shell) builtinStats(args []string, std *stdio) error {
+	timed := []*historyEntry{}
+	for _, entry := range s.history {
+		if entry.Duration > 0 {
+			timed = append(timed, entry)
+		}
+	}
+
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := s.jsonFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: stats slow [N] | stats avg")
+	}
+	// flags may also follow the subcommand
+	sub := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	switch sub {
+	case "slow":
+		n := 10
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n <= 0 {
+				return fmt.Errorf("slow: invalid count %q", args[0])
+			}
+		}
+		sort.SliceStable(timed, func(i, j int) bool {
+			return timed[i].Duration > timed[j].Duration
+		})
+		timed = timed[:min(n, len(timed))]
+		if *asJSON {
+			return writeJSON(std, timed)
+		}
+		for _, entry := range timed {
+			started := ""
+			if !entry.Start.IsZero() {
+				started = entry.Start.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(std.out, "%8s  %-16s  %s\n", formatDuration(entry.Duration), started, entry.Command)
+		}
+		return nil
+	case "avg":
+		type commandStats struct {
+			name  string
+			runs  int
+			total time.Duration
+		}
+		byName := make(map[string]*commandStats)
+		for _, entry := range timed {
+			fields := strings.Fields(entry.Command)
+			name := path.Base(fields[0])
+			st, ok := byName[name]
+			if !ok {
+				st = &commandStats{name: name}
+				byName[name] = st
+			}
+			st.runs++
+			st.total += entry.Duration
+		}
+		var all []*commandStats
+		for _, st := range byName {
+			all = append(all, st)
+		}
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].total/time.Duration(all[i].runs) > all[j].total/time.Duration(all[j].runs)
+		})
+		if *asJSON {
+			type avgJSON struct {
+				Command string        `json:"command"`
+				Runs    int           `json:"runs"`
+				Avg     time.Duration `json:"avg"`
+				Total   time.Duration `json:"total"`
+			}
+			out := make([]avgJSON, len(all))
+			for i, st := range all {
+				out[i] = avgJSON{st.name, st.runs, st.total / time.Duration(st.runs), st.total}
+			}
+			return writeJSON(std, out)
+		}
+		w := tabwriter.NewWriter(std.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COMMAND\tRUNS\tAVG\tTOTAL")
+		for _, st := range all {
+			avg := st.total / time.Duration(st.runs)
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", st.name, st.runs, formatDuration(avg), formatDuration(st.total))
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("%s: unknown subcommand", sub)
+	}
+}
+
+// formatDuration prints d with a precision suited to its magnitude.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
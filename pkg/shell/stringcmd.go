@@ -0,0 +1,282 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	addBuiltin("string", "string SUBCOMMAND ...", "manipulate text", (*Shell).builtinString)
+}
+
+// builtinString implements a fish-style string builtin. Each subcommand
+// operates on its STRING operands, or on the lines of stdin when there are
+// none, printing one result per line:
+//
+//	string length [-q] STRING...
+//	string sub [-s START] [-l LENGTH] [-e END] STRING...
+//	string split [-m MAX] [-r] SEP STRING...
+//	string join SEP STRING...
+//	string match [-r] [-i] [-v] [-q] PATTERN STRING...
+//	string replace [-a] [-r] [-i] [-f] [-q] PATTERN REPLACEMENT STRING...
+//	string trim [-l] [-r] [-c CHARS] STRING...
+//	string upper STRING...
+//	string lower STRING...
+//
+// Positions are 1-based and may be negative to count from the end. match
+// and replace fail with status 1 when nothing matched.
+func (s *Shell) builtinString(args []string, std *stdio) error {
+	if len(args) == 0 {
+		return errors.New("missing subcommand")
+	}
+
+	sub := args[0]
+	fs := flag.NewFlagSet("string "+sub, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	// per-subcommand flags
+	var (
+		quiet      = fs.Bool("q", false, "print nothing, only report success through the status")
+		regex      bool
+		ignoreCase bool
+		all        bool
+		filter     bool
+		invert     bool
+		maxSplits  int
+		right      bool
+		left       bool
+		chars      string
+		start      int
+		length     int
+		end        int
+	)
+	// how many leading operands are not strings
+	fixed := 0
+	switch sub {
+	case "length", "upper", "lower":
+	case "sub":
+		fs.IntVar(&start, "s", 1, "first character to keep")
+		fs.IntVar(&length, "l", -1, "number of characters to keep")
+		fs.IntVar(&end, "e", 0, "last character to keep")
+	case "split":
+		fs.IntVar(&maxSplits, "m", -1, "split at most this many times")
+		fs.BoolVar(&right, "r", false, "split from the right")
+		fixed = 1
+	case "join":
+		fixed = 1
+	case "match":
+		fs.BoolVar(&regex, "r", false, "PATTERN is a regular expression")
+		fs.BoolVar(&ignoreCase, "i", false, "ignore case")
+		fs.BoolVar(&invert, "v", false, "print the strings that do not match")
+		fixed = 1
+	case "replace":
+		fs.BoolVar(&regex, "r", false, "PATTERN is a regular expression")
+		fs.BoolVar(&ignoreCase, "i", false, "ignore case")
+		fs.BoolVar(&all, "a", false, "replace every occurrence")
+		fs.BoolVar(&filter, "f", false, "only print the strings that changed")
+		fixed = 2
+	case "trim":
+		fs.BoolVar(&left, "l", false, "only trim the start")
+		fs.BoolVar(&right, "r", false, "only trim the end")
+		fs.StringVar(&chars, "c", " \t\n\r", "characters to trim")
+	default:
+		return fmt.Errorf("%s: unknown subcommand", sub)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() < fixed {
+		return fmt.Errorf("%s: missing argument", sub)
+	}
+	params, operands := fs.Args()[:fixed], fs.Args()[fixed:]
+	if len(operands) == 0 {
+		var err error
+		if operands, err = stdinLines(std); err != nil {
+			return fmt.Errorf("%s: missing argument", sub)
+		}
+	}
+
+	var results []string
+	matched := false
+	switch sub {
+	case "length":
+		for _, str := range operands {
+			n := utf8.RuneCountInString(str)
+			matched = matched || n > 0
+			results = append(results, fmt.Sprint(n))
+		}
+	case "upper":
+		for _, str := range operands {
+			results = append(results, strings.ToUpper(str))
+		}
+		matched = true
+	case "lower":
+		for _, str := range operands {
+			results = append(results, strings.ToLower(str))
+		}
+		matched = true
+	case "sub":
+		for _, str := range operands {
+			results = append(results, substring([]rune(str), start, length, end))
+		}
+		matched = true
+	case "split":
+		sep := params[0]
+		for _, str := range operands {
+			var parts []string
+			switch {
+			case maxSplits < 0:
+				parts = strings.Split(str, sep)
+			case right:
+				parts = splitRight(str, sep, maxSplits)
+			default:
+				parts = strings.SplitN(str, sep, maxSplits+1)
+			}
+			matched = matched || len(parts) > 1
+			results = append(results, parts...)
+		}
+	case "join":
+		results = append(results, strings.Join(operands, params[0]))
+		matched = len(operands) > 1
+	case "trim":
+		for _, str := range operands {
+			trimmed := str
+			if !right || left {
+				trimmed = strings.TrimLeft(trimmed, chars)
+			}
+			if !left || right {
+				trimmed = strings.TrimRight(trimmed, chars)
+			}
+			matched = matched || trimmed != str
+			results = append(results, trimmed)
+		}
+	case "match":
+		re, err := compileStringPattern(params[0], regex, ignoreCase, true)
+		if err != nil {
+			return err
+		}
+		for _, str := range operands {
+			m := re.FindStringSubmatch(str)
+			if (m != nil) == invert {
+				continue
+			}
+			matched = true
+			if regex && !invert {
+				results = append(results, m...)
+			} else {
+				results = append(results, str)
+			}
+		}
+	case "replace":
+		re, err := compileStringPattern(params[0], regex, ignoreCase, false)
+		if err != nil {
+			return err
+		}
+		replacement := params[1]
+		if !regex {
+			replacement = strings.ReplaceAll(replacement, "$", "$$")
+		}
+		for _, str := range operands {
+			var replaced string
+			if all {
+				replaced = re.ReplaceAllString(str, replacement)
+			} else if loc := re.FindStringSubmatchIndex(str); loc != nil {
+				expanded := re.ExpandString(nil, replacement, str, loc)
+				replaced = str[:loc[0]] + string(expanded) + str[loc[1]:]
+			} else {
+				replaced = str
+			}
+			changed := replaced != str
+			matched = matched || changed
+			if changed || !filter {
+				results = append(results, replaced)
+			}
+		}
+	}
+
+	if !*quiet {
+		for _, result := range results {
+			fmt.Fprintln(std.out, result)
+		}
+	}
+	if !matched {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// compileStringPattern turns a match/replace pattern into a regexp. Glob
+// patterns (`*`, `?`) must match the whole string for match, while literal
+// replace patterns match anywhere.
+func compileStringPattern(pattern string, regex, ignoreCase, glob bool) (*regexp.Regexp, error) {
+	expr := pattern
+	if !regex {
+		if glob {
+			var b strings.Builder
+			b.WriteString("^")
+			for _, r := range pattern {
+				switch r {
+				case '*':
+					b.WriteString(".*")
+				case '?':
+					b.WriteString(".")
+				default:
+					b.WriteString(regexp.QuoteMeta(string(r)))
+				}
+			}
+			b.WriteString("$")
+			expr = b.String()
+		} else {
+			expr = regexp.QuoteMeta(pattern)
+		}
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// substring implements string sub with 1-based, possibly negative, positions.
+func substring(runes []rune, start, length, end int) string {
+	n := len(runes)
+	from := start - 1
+	if start < 0 {
+		from = n + start
+	}
+	from = max(0, min(from, n))
+
+	to := n
+	switch {
+	case end > 0:
+		to = end
+	case end < 0:
+		to = n + end + 1
+	case length >= 0:
+		to = from + length
+	}
+	to = max(from, min(to, n))
+	return string(runes[from:to])
+}
+
+// splitRight splits str on sep at most n times, starting from the end.
+func splitRight(str, sep string, n int) []string {
+	var parts []string
+	for ; n > 0; n-- {
+		i := strings.LastIndex(str, sep)
+		if i < 0 {
+			break
+		}
+		parts = append([]string{str[i+len(sep):]}, parts...)
+		str = str[:i]
+	}
+	return append([]string{str}, parts...)
+}
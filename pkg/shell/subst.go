@@ -0,0 +1,35 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// commandSubst runs the commands of a $(...) substitution and returns what
+// they write to stdout, without the newlines it ends with. They run in the
+// shell itself, not in a subshell, so their assignments and cd last, and
+// their status becomes $?.
+func (s *Shell) commandSubst(subst *parser.CmdSubst) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintln(s.Stderr, "gosh:", err)
+		return ""
+	}
+	output := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		r.Close()
+		output <- out
+	}()
+
+	std, stmt := s.std, s.currentStmt
+	s.std = &stdio{in: std.in, out: w, err: std.err}
+	s.runList(subst.List)
+	s.std, s.currentStmt = std, stmt
+	w.Close()
+	return strings.TrimRight(string(<-output), "\n")
+}
@@ -0,0 +1,36 @@
+package shell
+
+import "strings"
+
+// suggestion returns the autosuggestion for the line: the rest of the most
+// recent history entry that starts with it, shown dimmed after the cursor
+// while it is at the end of the line.
+func (s *Shell) suggestion() string {
+	if !s.suggesting || !s.option("autosuggest") || s.input == "" || s.cursor != len(s.input) || strings.Contains(s.input, "\n") {
+		return ""
+	}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		cmd := s.history[i].Command
+		if len(cmd) > len(s.input) && strings.HasPrefix(cmd, s.input) && !strings.Contains(cmd, "\n") {
+			return cmd[len(s.input):]
+		}
+	}
+	return ""
+}
+
+// acceptSuggestion adds the autosuggestion to the line, or with word only
+// its next word, reporting whether there was one.
+func (s *Shell) acceptSuggestion(word bool) bool {
+	suggestion := s.suggestion()
+	if suggestion == "" {
+		return false
+	}
+	start := s.cursor
+	s.insertText(suggestion)
+	if word {
+		s.cursor = start
+		s.input = s.input[:s.wordEnd()]
+		s.cursor = len(s.input)
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/NouemanKHAL/go-shell/pkg/parser"
+)
+
+// printSyntaxError reports err with the line of the input it is on and a
+// caret under the offending column, prefixed with the file and line when
+// running a file.
+func (s *Shell) printSyntaxError(input string, err *parser.Error) {
+	start := strings.LastIndexByte(input[:err.Pos], '\n') + 1
+	line := input[start:]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	before := input[start:err.Pos]
+
+	prefix := "gosh"
+	if s.scriptFile != "" {
+		lineno := s.scriptLine + strings.Count(input[:start], "\n")
+		prefix = fmt.Sprintf("%s:%d:%d", s.scriptFile, lineno, utf8.RuneCountInString(before)+1)
+	}
+	// keep the tabs so that the caret lines up
+	var pad strings.Builder
+	for _, r := range before {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	fmt.Fprintf(s.Stderr, "%s: %v\n  %s\n  %s^\n", prefix, err, line, pad.String())
+}
+
+// isSyntaxError reports whether err is a syntax error, already reported by
+// execute.
+func isSyntaxError(err error) bool {
+	var syntaxErr *parser.Error
+	return errors.As(err, &syntaxErr)
+}
+
+// incomplete reports whether input ends in the middle of a command, which
+// the next lines can complete: in quotes, after a pipe or &&, or after a
+// backslash escaping the newline.
+func (s *Shell) incomplete(input string) bool {
+	trailing := len(input) - len(strings.TrimRight(input, `\`))
+	if trailing%2 == 1 {
+		return true
+	}
+	var syntaxErr *parser.Error
+	_, err := parser.ParseAliases(input, s.aliases)
+	return errors.As(err, &syntaxErr) && syntaxErr.Incomplete
+}
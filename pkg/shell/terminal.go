@@ -0,0 +1,60 @@
+package shell
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// stdinFd returns the file descriptor of the shell's stdin, or -1 when it
+// isn't a file, for which the terminal calls then fail.
+func (s *Shell) stdinFd() int {
+	return fileFd(s.Stdin)
+}
+
+// fileFd returns the file descriptor of stream if it is a file, or -1.
+func fileFd(stream any) int {
+	if f, ok := stream.(*os.File); ok {
+		return int(f.Fd())
+	}
+	return -1
+}
+
+// saveTerminal records the terminal settings so they can be restored when the
+// shell exits, or after reading a line.
+func (s *Shell) saveTerminal() {
+	if termios, err := unix.IoctlGetTermios(s.stdinFd(), ioctlGetTermios); err == nil {
+		s.termState = termios
+	}
+}
+
+// restoreTerminal puts back the settings recorded by saveTerminal. Commands
+// run with them, so they see the terminal as it was when gosh started.
+func (s *Shell) restoreTerminal() {
+	if s.termState != nil {
+		unix.IoctlSetTermios(s.stdinFd(), ioctlSetTermios, s.termState)
+	}
+}
+
+// enterEditMode sets the terminal up for the line editor: keys are read as
+// they are typed, without being echoed, while Ctrl-C still sends SIGINT and
+// output processing is left alone. restoreTerminal undoes it.
+func (s *Shell) enterEditMode() {
+	if s.termState == nil {
+		return
+	}
+	termios := *s.termState
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	unix.IoctlSetTermios(s.stdinFd(), ioctlSetTermios, &termios)
+}
+
+// terminalSize returns the width and height of the terminal, or 80x24 when
+// they aren't known.
+func (s *Shell) terminalSize() (int, int) {
+	if ws, err := unix.IoctlGetWinsize(fileFd(s.Stdout), unix.TIOCGWINSZ); err == nil && ws.Col > 0 {
+		return int(ws.Col), int(ws.Row)
+	}
+	return 80, 24
+}
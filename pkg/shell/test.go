@@ -0,0 +1,343 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+func init() {
+	addBuiltin("test", "test EXPR", "check files, strings and integers", (*Shell).builtinTest)
+	addBuiltin("[", "[ EXPR ]", "check files, strings and integers, like test", (*Shell).builtinBracket)
+}
+
+// builtinTest implements `test EXPR`, which succeeds when the expression is
+// true, with status 1 when it is false and 2 when it is invalid:
+//
+//	-e FILE, -f FILE, -d FILE   FILE exists, is a regular file, a directory
+//	-s FILE                     FILE isn't empty
+//	-r FILE, -w FILE, -x FILE   FILE can be read, written, executed
+//	-n STRING, -z STRING        STRING isn't empty, is empty
+//	S1 = S2, S1 != S2           the strings are equal, different
+//	N1 -eq N2, -ne, -lt, ...    the integers compare so
+//	F1 -nt F2, F1 -ot F2        F1 is newer, older than F2
+//	! EXPR, EXPR -a EXPR, EXPR -o EXPR, ( EXPR )
+//
+// STRING alone is true when it isn't empty. The files are relative to the
+// working directory of the shell.
+func (s *Shell) builtinTest(args []string, std *stdio) error {
+	return s.test("test", args, std)
+}
+
+// builtinBracket implements `[ EXPR ]`, test with a ] at the end.
+func (s *Shell) builtinBracket(args []string, std *stdio) error {
+	if len(args) == 0 || args[len(args)-1] != "]" {
+		fmt.Fprintln(std.err, "[: missing `]'")
+		return exitStatus(2)
+	}
+	return s.test("[", args[:len(args)-1], std)
+}
+
+func (s *Shell) test(name string, args []string, std *stdio) error {
+	t := &testExpr{s: s, std: std, args: args}
+	ok, err := t.eval()
+	if err != nil {
+		fmt.Fprintf(std.err, "%s: %v\n", name, err)
+		return exitStatus(2)
+	}
+	if !ok {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// testExpr evaluates the arguments of test.
+type testExpr struct {
+	s    *Shell
+	std  *stdio
+	args []string
+	pos  int
+}
+
+var testUnaryOps = []string{
+	"-b", "-c", "-d", "-e", "-f", "-g", "-G", "-h", "-k", "-L", "-n", "-O",
+	"-p", "-r", "-s", "-S", "-t", "-u", "-v", "-w", "-x", "-z",
+}
+
+var testBinaryOps = []string{
+	"=", "==", "!=", "<", ">", "-eq", "-ne", "-lt", "-le", "-gt", "-ge",
+	"-nt", "-ot", "-ef",
+}
+
+// eval evaluates the whole expression. Up to 4 arguments, it goes by their
+// number, as POSIX says, so that `test ! = x` and `[ -n ]` mean what they
+// look like; longer expressions are parsed with ! binding tighter than -a,
+// and -a tighter than -o.
+func (t *testExpr) eval() (bool, error) {
+	args := t.args
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		if args[0] == "!" {
+			return args[1] == "", nil
+		}
+		if slices.Contains(testUnaryOps, args[0]) {
+			return t.unary(args[0], args[1])
+		}
+		return false, fmt.Errorf("%s: unary operator expected", args[0])
+	case 3:
+		if slices.Contains(testBinaryOps, args[1]) {
+			return t.binary(args[0], args[1], args[2])
+		}
+		if args[1] == "-a" || args[1] == "-o" {
+			break
+		}
+		if args[0] == "!" {
+			ok, err := (&testExpr{s: t.s, std: t.std, args: args[1:]}).eval()
+			return !ok, err
+		}
+		if args[0] == "(" && args[2] == ")" {
+			return args[1] != "", nil
+		}
+		return false, fmt.Errorf("%s: binary operator expected", args[1])
+	case 4:
+		if args[0] == "!" {
+			ok, err := (&testExpr{s: t.s, std: t.std, args: args[1:]}).eval()
+			return !ok, err
+		}
+		if args[0] == "(" && args[3] == ")" {
+			return (&testExpr{s: t.s, std: t.std, args: args[1:3]}).eval()
+		}
+	}
+	ok, err := t.or()
+	if err == nil && t.pos < len(t.args) {
+		err = fmt.Errorf("%s: unexpected argument", t.args[t.pos])
+	}
+	return ok, err
+}
+
+// next returns the argument at t.pos and moves past it.
+func (t *testExpr) next() (string, error) {
+	if t.pos == len(t.args) {
+		return "", errors.New("argument expected")
+	}
+	t.pos++
+	return t.args[t.pos-1], nil
+}
+
+// peek reports whether the argument i after t.pos is one of words.
+func (t *testExpr) peek(i int, words ...string) bool {
+	return t.pos+i < len(t.args) && slices.Contains(words, t.args[t.pos+i])
+}
+
+func (t *testExpr) or() (bool, error) {
+	ok, err := t.and()
+	for err == nil && t.peek(0, "-o") {
+		t.pos++
+		var next bool
+		next, err = t.and()
+		ok = ok || next
+	}
+	return ok, err
+}
+
+func (t *testExpr) and() (bool, error) {
+	ok, err := t.not()
+	for err == nil && t.peek(0, "-a") {
+		t.pos++
+		var next bool
+		next, err = t.not()
+		ok = ok && next
+	}
+	return ok, err
+}
+
+func (t *testExpr) not() (bool, error) {
+	if t.peek(0, "!") && !t.peek(1, testBinaryOps...) {
+		t.pos++
+		ok, err := t.not()
+		return !ok, err
+	}
+	return t.primary()
+}
+
+func (t *testExpr) primary() (bool, error) {
+	switch {
+	case t.peek(1, testBinaryOps...):
+		t.pos += 3
+		if t.pos > len(t.args) {
+			return false, fmt.Errorf("%s: argument expected", t.args[t.pos-2])
+		}
+		return t.binary(t.args[t.pos-3], t.args[t.pos-2], t.args[t.pos-1])
+	case t.peek(0, testUnaryOps...) && t.pos+1 < len(t.args):
+		t.pos += 2
+		return t.unary(t.args[t.pos-2], t.args[t.pos-1])
+	case t.peek(0, "("):
+		t.pos++
+		ok, err := t.or()
+		if err != nil {
+			return false, err
+		}
+		if !t.peek(0, ")") {
+			return false, errors.New("missing `)'")
+		}
+		t.pos++
+		return ok, nil
+	}
+	arg, err := t.next()
+	return arg != "", err
+}
+
+// unary evaluates the unary operator op on arg.
+func (t *testExpr) unary(op, arg string) (bool, error) {
+	switch op {
+	case "-n":
+		return arg != "", nil
+	case "-z":
+		return arg == "", nil
+	case "-v":
+		_, set := t.s.lookupVar(arg)
+		return set, nil
+	case "-t":
+		fd, err := strconv.Atoi(arg)
+		if err != nil {
+			return false, fmt.Errorf("%s: integer expression expected", arg)
+		}
+		return t.isTerminal(fd), nil
+	}
+
+	file := resolvePath(t.s.workingDir, arg)
+	switch op {
+	case "-r":
+		return unix.Access(file, unix.R_OK) == nil, nil
+	case "-w":
+		return unix.Access(file, unix.W_OK) == nil, nil
+	case "-x":
+		return unix.Access(file, unix.X_OK) == nil, nil
+	}
+	var info os.FileInfo
+	var err error
+	if op == "-h" || op == "-L" {
+		info, err = os.Lstat(file)
+	} else {
+		info, err = os.Stat(file)
+	}
+	if err != nil {
+		return false, nil
+	}
+	mode := info.Mode()
+	switch op {
+	case "-b":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+	case "-c":
+		return mode&os.ModeCharDevice != 0, nil
+	case "-d":
+		return mode.IsDir(), nil
+	case "-f":
+		return mode.IsRegular(), nil
+	case "-g":
+		return mode&os.ModeSetgid != 0, nil
+	case "-h", "-L":
+		return mode&os.ModeSymlink != 0, nil
+	case "-k":
+		return mode&os.ModeSticky != 0, nil
+	case "-p":
+		return mode&os.ModeNamedPipe != 0, nil
+	case "-s":
+		return info.Size() > 0, nil
+	case "-S":
+		return mode&os.ModeSocket != 0, nil
+	case "-u":
+		return mode&os.ModeSetuid != 0, nil
+	case "-O", "-G":
+		st, ok := info.Sys().(*unix.Stat_t)
+		if !ok {
+			return false, nil
+		}
+		if op == "-O" {
+			return int(st.Uid) == os.Geteuid(), nil
+		}
+		return int(st.Gid) == os.Getegid(), nil
+	}
+	// -e
+	return true, nil
+}
+
+// isTerminal reports whether file descriptor fd is a terminal, 0 to 2 being
+// the streams test runs with.
+func (t *testExpr) isTerminal(fd int) bool {
+	var stream any
+	switch fd {
+	case 0:
+		stream = t.std.in
+	case 1:
+		stream = t.std.out
+	case 2:
+		stream = t.std.err
+	default:
+		return term.IsTerminal(fd)
+	}
+	f, ok := stream.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// binary evaluates the binary operator op on a and b.
+func (t *testExpr) binary(a, op, b string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	case "<":
+		return a < b, nil
+	case ">":
+		return a > b, nil
+	case "-nt", "-ot", "-ef":
+		return t.compareFiles(a, op, b), nil
+	}
+	x, err := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", a)
+	}
+	y, err := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", b)
+	}
+	switch op {
+	case "-eq":
+		return x == y, nil
+	case "-ne":
+		return x != y, nil
+	case "-lt":
+		return x < y, nil
+	case "-le":
+		return x <= y, nil
+	case "-gt":
+		return x > y, nil
+	}
+	// -ge
+	return x >= y, nil
+}
+
+// compareFiles evaluates -nt, -ot and -ef. A file that doesn't exist is
+// older than one that does.
+func (t *testExpr) compareFiles(a, op, b string) bool {
+	infoA, errA := os.Stat(resolvePath(t.s.workingDir, a))
+	infoB, errB := os.Stat(resolvePath(t.s.workingDir, b))
+	switch op {
+	case "-nt":
+		return errA == nil && (errB != nil || infoA.ModTime().After(infoB.ModTime()))
+	case "-ot":
+		return errB == nil && (errA != nil || infoA.ModTime().Before(infoB.ModTime()))
+	}
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
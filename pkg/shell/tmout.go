@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var errIdleTimeout = errors.New("timed out waiting for input")
+
+// idleTimeout returns the TMOUT setting, or 0 when it is unset or invalid.
+func (s *Shell) idleTimeout() time.Duration {
+	n, err := strconv.Atoi(s.getVar("TMOUT"))
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// waitForInput blocks until there is input to read, and fails with
+// errIdleTimeout if TMOUT seconds go by without any, or with errInterrupted
+// on Ctrl-C.
+func (s *Shell) waitForInput() error {
+	// input that isn't a file can't be polled, reading it just blocks
+	if s.stdin.Buffered() > 0 || s.stdinFd() < 0 {
+		return nil
+	}
+
+	fds := []unix.PollFd{{Fd: int32(s.stdinFd()), Events: unix.POLLIN}}
+	if fd, ok := s.interruptPollFd(); ok {
+		fds = append(fds, fd)
+	}
+	timeout := s.idleTimeout()
+	deadline := time.Now().Add(timeout)
+	for {
+		wait := -1
+		if timeout > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return errIdleTimeout
+			}
+			wait = int(remaining.Milliseconds()) + 1
+		}
+		n, err := unix.Poll(fds, wait)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errIdleTimeout
+		}
+		if len(fds) > 1 && fds[1].Revents != 0 {
+			s.forgetInterrupts()
+			return errInterrupted
+		}
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	addBuiltin("trap", "trap [COMMAND EXIT | - EXIT]", "set, remove or list the command run on exit", (*Shell).builtinTrap)
+}
+
+// builtinTrap implements trap for the EXIT condition, run when the shell
+// exits:
+//
+//	trap                 list the traps
+//	trap COMMAND EXIT    run COMMAND on exit; the words before EXIT are joined
+//	trap - EXIT          remove the trap
+func (s *Shell) builtinTrap(args []string, std *stdio) error {
+	if len(args) == 0 {
+		for condition, command := range s.traps {
+			fmt.Fprintf(std.out, "trap -- %q %s\n", command, condition)
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return errors.New("usage: trap COMMAND EXIT")
+	}
+
+	condition := strings.ToUpper(args[len(args)-1])
+	if condition != "EXIT" && condition != "0" {
+		return fmt.Errorf("%s: only EXIT traps are supported", args[len(args)-1])
+	}
+	command := strings.Join(args[:len(args)-1], " ")
+	if command == "-" {
+		delete(s.traps, "EXIT")
+		return nil
+	}
+	if s.traps == nil {
+		s.traps = make(map[string]string)
+	}
+	s.traps["EXIT"] = command
+	return nil
+}
+
+// runExitTrap is the exit hook running the EXIT trap.
+func (s *Shell) runExitTrap() {
+	command, ok := s.traps["EXIT"]
+	if !ok {
+		return
+	}
+	// an exit from the trap itself must not run it again
+	delete(s.traps, "EXIT")
+	s.execute(command)
+}
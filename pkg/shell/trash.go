@@ -0,0 +1,285 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const trashInfoTime = "2006-01-02T15:04:05"
+
+// trashEntry is a trashed file, described by its .trashinfo file.
+type trashEntry struct {
+	name    string // name under files/
+	path    string // original location
+	deleted time.Time
+}
+
+// trashDir returns the trash directory: $GOSH_TRASH, or the freedesktop.org
+// home trash.
+func (s *Shell) trashDir() (string, error) {
+	if dir := s.getVar("GOSH_TRASH"); dir != "" {
+		return dir, nil
+	}
+	if dataHome := s.getVar("XDG_DATA_HOME"); dataHome != "" {
+		return path.Join(dataHome, "Trash"), nil
+	}
+	home := s.getVar("HOME")
+	if home == "" {
+		return "", errors.New("HOME is not set")
+	}
+	return path.Join(home, ".local", "share", "Trash"), nil
+}
+
+func init() {
+	addBuiltin("trash", "trash FILE ... | --list | --restore FILE ... | --empty", "move files to the trash, or get them back", (*Shell).builtinTrash)
+}
+
+// builtinTrash implements the trash builtin, a recoverable rm following the
+// freedesktop.org trash specification:
+//
+//	trash FILE...              move files to the trash
+//	trash --list               list the trashed files
+//	trash --restore FILE...    put files back, by original path or trash name
+//	trash --empty              delete the trashed files for good
+func (s *Shell) builtinTrash(args []string, std *stdio) error {
+	fset := flag.NewFlagSet("trash", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	list := fset.Bool("list", false, "list the trashed files")
+	restore := fset.Bool("restore", false, "restore the given files")
+	empty := fset.Bool("empty", false, "empty the trash")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	dir, err := s.trashDir()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *list:
+		entries, err := readTrash(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			fmt.Fprintf(std.out, "%s  %s\n", entry.deleted.Format("2006-01-02 15:04:05"), entry.path)
+		}
+		return nil
+	case *empty:
+		for _, sub := range []string{"files", "info"} {
+			if err := os.RemoveAll(path.Join(dir, sub)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if fset.NArg() == 0 {
+		return errors.New("missing file operand")
+	}
+	var failed error
+	for _, name := range fset.Args() {
+		target := name
+		if !path.IsAbs(target) {
+			target = path.Join(s.workingDir, target)
+		}
+		if *restore {
+			err = restoreFromTrash(dir, name, target)
+		} else {
+			err = moveToTrash(dir, target)
+		}
+		if err != nil {
+			fmt.Fprintf(std.err, "trash: %s: %v\n", name, err)
+			failed = exitStatus(1)
+		}
+	}
+	return failed
+}
+
+func moveToTrash(dir, target string) error {
+	if _, err := os.Lstat(target); err != nil {
+		return err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(path.Join(dir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+
+	// reserve a unique name by creating its info file exclusively
+	base := path.Base(target)
+	name := base
+	var info *os.File
+	for i := 2; ; i++ {
+		var err error
+		info, err = os.OpenFile(path.Join(dir, "info", name+".trashinfo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+
+	escaped := (&url.URL{Path: target}).EscapedPath()
+	_, err := fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, time.Now().Format(trashInfoTime))
+	info.Close()
+	if err == nil {
+		err = moveFile(target, path.Join(dir, "files", name))
+	}
+	if err != nil {
+		os.Remove(info.Name())
+	}
+	return err
+}
+
+func restoreFromTrash(dir, name, target string) error {
+	entries, err := readTrash(dir)
+	if err != nil {
+		return err
+	}
+	// the most recently trashed match wins
+	var found *trashEntry
+	for i := range entries {
+		entry := &entries[i]
+		if entry.path == target || entry.name == name {
+			if found == nil || entry.deleted.After(found.deleted) {
+				found = entry
+			}
+		}
+	}
+	if found == nil {
+		return errors.New("not in the trash")
+	}
+	if _, err := os.Lstat(found.path); err == nil {
+		return fmt.Errorf("%s already exists", found.path)
+	}
+	if err := os.MkdirAll(path.Dir(found.path), 0o755); err != nil {
+		return err
+	}
+	if err := moveFile(path.Join(dir, "files", found.name), found.path); err != nil {
+		return err
+	}
+	return os.Remove(path.Join(dir, "info", found.name+".trashinfo"))
+}
+
+// readTrash returns the trash entries ordered by deletion date.
+func readTrash(dir string) ([]trashEntry, error) {
+	infos, err := os.ReadDir(path.Join(dir, "info"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []trashEntry
+	for _, info := range infos {
+		name, ok := strings.CutSuffix(info.Name(), ".trashinfo")
+		if !ok {
+			continue
+		}
+		entry, err := readTrashInfo(path.Join(dir, "info", info.Name()))
+		if err != nil {
+			continue
+		}
+		entry.name = name
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].deleted.Before(entries[j].deleted)
+	})
+	return entries, nil
+}
+
+func readTrashInfo(file string) (trashEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return trashEntry{}, err
+	}
+	defer f.Close()
+
+	var entry trashEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "Path":
+			if entry.path, err = url.PathUnescape(value); err != nil {
+				return trashEntry{}, err
+			}
+		case "DeletionDate":
+			entry.deleted, _ = time.ParseInLocation(trashInfoTime, value, time.Local)
+		}
+	}
+	if entry.path == "" {
+		return trashEntry{}, errors.New("no Path in " + file)
+	}
+	return entry, scanner.Err()
+}
+
+// moveFile renames src to dst, copying across filesystems when needed.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, file)
+		out := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Mkdir(out, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, out)
+		default:
+			in, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, in); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package shell
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dynamicVars are computed each time they are read:
+//
+//	RANDOM         a random integer between 0 and 32767
+//	SECONDS        seconds since the shell started
+//	EPOCHSECONDS   seconds since the Unix epoch
+//	EPOCHREALTIME  the same, with microseconds
+//	LINENO         the line of the statement running, in its script
+//	?              the exit status of the last pipeline
+//	PIPESTATUS     the exit status of each command of the last pipeline
+//	!              the process ID of the last background job
+//	$              the process ID of the shell
+//	_              the last argument of the previous command
+//	0              the name of the script, or gosh
+//	#              the number of positional parameters
+//	@, *           the positional parameters, separated by spaces
+var dynamicVars = map[string]func(s *Shell) string{
+	"RANDOM": func(s *Shell) string {
+		return strconv.Itoa(rand.IntN(32768))
+	},
+	"SECONDS": func(s *Shell) string {
+		return strconv.Itoa(int(time.Since(s.startTime).Seconds()))
+	},
+	"EPOCHSECONDS": func(s *Shell) string {
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	},
+	"EPOCHREALTIME": func(s *Shell) string {
+		now := time.Now()
+		return fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+	},
+	"LINENO": func(s *Shell) string {
+		return strconv.Itoa(s.line)
+	},
+	"?": func(s *Shell) string {
+		return strconv.Itoa(s.lastStatus)
+	},
+	"!": func(s *Shell) string {
+		if s.lastBackgroundPid == 0 {
+			return ""
+		}
+		return strconv.Itoa(s.lastBackgroundPid)
+	},
+	"$": func(s *Shell) string {
+		return strconv.Itoa(os.Getpid())
+	},
+	"_": func(s *Shell) string {
+		return s.lastArg
+	},
+	"0": func(s *Shell) string {
+		return s.arg0
+	},
+	"#": func(s *Shell) string {
+		return strconv.Itoa(len(s.positional))
+	},
+	"@": func(s *Shell) string {
+		return strings.Join(s.positional, " ")
+	},
+	"*": func(s *Shell) string {
+		return strings.Join(s.positional, " ")
+	},
+	"PIPESTATUS": func(s *Shell) string {
+		statuses := make([]string, len(s.pipeStatus))
+		for i, status := range s.pipeStatus {
+			statuses[i] = strconv.Itoa(status)
+		}
+		return strings.Join(statuses, " ")
+	},
+}
+
+// getVar returns the value of the named variable, or "" when it is unset.
+func (s *Shell) getVar(name string) string {
+	value, _ := s.lookupVar(name)
+	return value
+}
+
+// lookupVar returns the value of the named variable and whether it is set.
+// Dynamic variables come first, then positional parameters, shell
+// variables, and the environment.
+func (s *Shell) lookupVar(name string) (string, bool) {
+	if fn, ok := dynamicVars[name]; ok {
+		return fn(s), true
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		if n > len(s.positional) {
+			return "", false
+		}
+		return s.positional[n-1], true
+	}
+	if value, ok := s.vars[name]; ok {
+		return value, true
+	}
+	value, ok := s.env[name]
+	return value, ok
+}
@@ -0,0 +1,64 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineno(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"echo $LINENO", "1\n"},
+		{"true\n\necho $LINENO; echo $LINENO", "3\n3\n"},
+		{"if true; then\n  echo $LINENO\nfi", "2\n"},
+		{"{\n  echo $LINENO\n  echo $LINENO; }", "2\n3\n"},
+		{"f() {\n  echo $LINENO\n}\n\nf; echo $LINENO", "2\n5\n"},
+		{"echo `\necho $LINENO`", "2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newTestShell(t, &out)
+			s.Eval(tt.input)
+			if got := out.String(); got != tt.want {
+				t.Errorf("Eval: got %q, want %q", got, tt.want)
+			}
+
+			// gosh -c
+			out.Reset()
+			s.RunString(tt.input, nil)
+			if got := out.String(); got != tt.want {
+				t.Errorf("RunString: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinenoScript(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.sh")
+	err := os.WriteFile(script, []byte(`echo $LINENO
+
+# a comment
+if true; then
+  echo $LINENO
+fi
+f() {
+  echo $LINENO
+}
+f
+echo $LINENO
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s := newTestShell(t, &out)
+	s.RunScript(script, nil)
+	if got, want := out.String(), "1\n5\n8\n11\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,312 @@
+package shell
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// In vi mode (`set -o vi`) a line starts in insert mode, where keys type as
+// usual, and ESC goes to command mode, where they move the cursor and edit
+// with vi commands. The two modes have keymaps of their own, vi-insert and
+// vi-command as readline calls them.
+
+func defaultViInsertKeymap() keymap {
+	return keymap{
+		"\n":       {function: "accept-line"},
+		"\r":       {function: "accept-line"},
+		"\x1b":     {function: "vi-movement-mode"},
+		"\t":       {function: "complete"},
+		"\x7f":     {function: "backward-delete-char"},
+		"\b":       {function: "backward-delete-char"},
+		"\x1b[A":   {function: "history-substring-search-backward"},
+		"\x1b[B":   {function: "history-substring-search-forward"},
+		"\x1b[C":   {function: "forward-char"},
+		"\x1b[D":   {function: "backward-char"},
+		"\x1b[H":   {function: "beginning-of-line"},
+		"\x1b[F":   {function: "end-of-line"},
+		"\x1b[3~":  {function: "delete-char"},
+		"\x04":     {function: "end-of-file"},
+		"\x15":     {function: "unix-line-discard"},
+		"\x17":     {function: "unix-word-rubout"},
+		"\x19":     {function: "yank"},
+		"\x0c":     {function: "clear-screen"},
+		pasteStart: {function: "bracketed-paste-begin"},
+	}
+}
+
+func defaultViCommandKeymap() keymap {
+	return keymap{
+		"\n":       {function: "accept-line"},
+		"\r":       {function: "accept-line"},
+		"\x04":     {function: "end-of-file"},
+		"\x0c":     {function: "clear-screen"},
+		"i":        {function: "vi-insertion-mode"},
+		"a":        {function: "vi-append-mode"},
+		"I":        {function: "vi-insert-beg"},
+		"A":        {function: "vi-append-eol"},
+		"h":        {function: "backward-char"},
+		"\x7f":     {function: "backward-char"},
+		"l":        {function: "forward-char"},
+		" ":        {function: "forward-char"},
+		"w":        {function: "vi-next-word"},
+		"b":        {function: "vi-prev-word"},
+		"e":        {function: "vi-end-word"},
+		"0":        {function: "beginning-of-line"},
+		"^":        {function: "vi-first-print"},
+		"$":        {function: "end-of-line"},
+		"x":        {function: "delete-char"},
+		"X":        {function: "backward-delete-char"},
+		"d":        {function: "vi-delete-to"},
+		"c":        {function: "vi-change-to"},
+		"y":        {function: "vi-yank-to"},
+		"D":        {macro: "d$"},
+		"C":        {macro: "c$"},
+		"s":        {macro: "cl"},
+		"S":        {macro: "cc"},
+		"r":        {function: "vi-change-char"},
+		"p":        {function: "vi-put"},
+		"P":        {function: "vi-put-before"},
+		"k":        {function: "previous-history"},
+		"-":        {function: "previous-history"},
+		"j":        {function: "next-history"},
+		"+":        {function: "next-history"},
+		"\x1b[A":   {function: "history-substring-search-backward"},
+		"\x1b[B":   {function: "history-substring-search-forward"},
+		"\x1b[C":   {function: "forward-char"},
+		"\x1b[D":   {function: "backward-char"},
+		"\x1b[H":   {function: "beginning-of-line"},
+		"\x1b[F":   {function: "end-of-line"},
+		"\x1b[3~":  {function: "delete-char"},
+		pasteStart: {function: "bracketed-paste-begin"},
+	}
+}
+
+// currentKeymap returns the keymap for the editing mode, and in vi mode for
+// insert or command mode.
+func (s *Shell) currentKeymap() keymap {
+	switch {
+	case s.editingMode() != "vi":
+		return s.keymaps["emacs"]
+	case s.viCommandMode:
+		return s.keymaps["vi-command"]
+	default:
+		return s.keymaps["vi-insert"]
+	}
+}
+
+// viMovementMode leaves insert mode. As in vi, the cursor goes back onto the
+// last character typed.
+func (s *Shell) viMovementMode() {
+	s.viCommandMode = true
+	_, size := utf8.DecodeLastRuneInString(s.input[:s.cursor])
+	s.moveCursor(s.cursor - size)
+}
+
+// viClampCursor keeps the cursor on a character in command mode, where it
+// can't be after the end of the line.
+func (s *Shell) viClampCursor() {
+	if s.cursor == len(s.input) && s.cursor > 0 {
+		_, size := utf8.DecodeLastRuneInString(s.input)
+		s.cursor -= size
+	}
+}
+
+// viClass tells the kinds of characters vi words are made of: spaces,
+// letters and digits, and punctuation.
+func viClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case isWordChar(r) || r == '_':
+		return 1
+	}
+	return 2
+}
+
+// viNextWord returns the offset of the start of the next word, for w.
+func (s *Shell) viNextWord() int {
+	i := s.cursor
+	if i < len(s.input) {
+		r, _ := utf8.DecodeRuneInString(s.input[i:])
+		class := viClass(r)
+		for i < len(s.input) {
+			r, size := utf8.DecodeRuneInString(s.input[i:])
+			if viClass(r) != class {
+				break
+			}
+			i += size
+		}
+	}
+	for i < len(s.input) {
+		r, size := utf8.DecodeRuneInString(s.input[i:])
+		if viClass(r) != 0 {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// viPrevWord returns the offset of the start of the word before the cursor,
+// for b.
+func (s *Shell) viPrevWord() int {
+	i := s.cursor
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s.input[:i])
+		if viClass(r) != 0 {
+			break
+		}
+		i -= size
+	}
+	if i == 0 {
+		return 0
+	}
+	r, _ := utf8.DecodeLastRuneInString(s.input[:i])
+	class := viClass(r)
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s.input[:i])
+		if viClass(r) != class {
+			break
+		}
+		i -= size
+	}
+	return i
+}
+
+// viEndWord returns the offset of the last character of the word the cursor
+// is in, or of the next one when it is already there, for e.
+func (s *Shell) viEndWord() int {
+	i := s.cursor
+	if i < len(s.input) {
+		_, size := utf8.DecodeRuneInString(s.input[i:])
+		i += size
+	}
+	for i < len(s.input) {
+		r, size := utf8.DecodeRuneInString(s.input[i:])
+		if viClass(r) != 0 {
+			break
+		}
+		i += size
+	}
+	if i == len(s.input) {
+		return s.cursor
+	}
+	r, _ := utf8.DecodeRuneInString(s.input[i:])
+	class := viClass(r)
+	for {
+		_, size := utf8.DecodeRuneInString(s.input[i:])
+		if i+size == len(s.input) {
+			return i
+		}
+		next, _ := utf8.DecodeRuneInString(s.input[i+size:])
+		if viClass(next) != class {
+			return i
+		}
+		i += size
+	}
+}
+
+// viFirstPrint returns the offset of the first character that isn't a
+// space, for ^.
+func (s *Shell) viFirstPrint() int {
+	i := 0
+	for i < len(s.input) {
+		r, size := utf8.DecodeRuneInString(s.input[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// viMotionEnd reads the motion following d, c or y and returns the other end
+// of the text it covers. Repeating the operator, as in dd, covers the whole
+// line. ok is false for keys that aren't motions.
+func (s *Shell) viMotionEnd(operator string) (start, end int, ok bool) {
+	key, err := s.readKeyEvent()
+	if err != nil {
+		return 0, 0, false
+	}
+	target := 0
+	switch key.seq {
+	case operator:
+		return 0, len(s.input), true
+	case "h", "\x1b[D":
+		_, size := utf8.DecodeLastRuneInString(s.input[:s.cursor])
+		target = s.cursor - size
+	case "l", " ", "\x1b[C":
+		target = s.afterRune(s.cursor)
+	case "w":
+		r, _ := utf8.DecodeRuneInString(s.input[s.cursor:])
+		if operator == "c" && s.cursor < len(s.input) && viClass(r) != 0 {
+			// cw changes to the end of the word, like ce
+			target = s.afterRune(s.viEndWord())
+			break
+		}
+		target = s.viNextWord()
+	case "e":
+		target = s.afterRune(s.viEndWord())
+	case "b":
+		target = s.viPrevWord()
+	case "0":
+		target = 0
+	case "^":
+		target = s.viFirstPrint()
+	case "$":
+		target = len(s.input)
+	default:
+		return 0, 0, false
+	}
+	return min(s.cursor, target), max(s.cursor, target), true
+}
+
+// afterRune returns the offset after the character at offset i.
+func (s *Shell) afterRune(i int) int {
+	_, size := utf8.DecodeRuneInString(s.input[i:])
+	return i + size
+}
+
+// viOperate applies the d, c or y operator to the text covered by the motion
+// typed after it. Deleted and copied text goes to the kill ring, for p.
+func (s *Shell) viOperate(operator string) {
+	start, end, ok := s.viMotionEnd(operator)
+	if !ok {
+		return
+	}
+	if operator == "y" {
+		s.pushKill(s.input[start:end])
+		s.moveCursor(start)
+		return
+	}
+	s.moveCursor(start)
+	s.killTo(end)
+	if operator == "c" {
+		s.viCommandMode = false
+	}
+}
+
+// viChangeChar replaces the character under the cursor with the next one
+// typed, for r.
+func (s *Shell) viChangeChar() {
+	key, err := s.readKeyEvent()
+	r, size := utf8.DecodeRuneInString(key.seq)
+	if err != nil || size != len(key.seq) || r == utf8.RuneError || !s.isValidChar(r) || s.cursor == len(s.input) {
+		return
+	}
+	s.input = s.input[:s.cursor] + key.seq + s.input[s.afterRune(s.cursor):]
+}
+
+// viPut inserts the text killed last after the cursor, for p, or before it,
+// for P, leaving the cursor on its last character.
+func (s *Shell) viPut(after bool) {
+	if len(s.killRing) == 0 {
+		return
+	}
+	if after {
+		s.moveCursor(s.afterRune(s.cursor))
+	}
+	s.yank()
+	_, size := utf8.DecodeLastRuneInString(s.input[:s.cursor])
+	s.moveCursor(s.cursor - size)
+}
@@ -0,0 +1,134 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	addBuiltin("watch", "watch [-n SECONDS] [-d=false] CMD ...", "run a command again and again, showing the changes", (*Shell).builtinWatch)
+}
+
+// builtinWatch implements `watch [-n seconds] [-d=false] cmd ...`: it runs cmd
+// every interval in the alternate screen, highlighting the characters that
+// changed since the previous run, until interrupted with Ctrl-C.
+func (s *Shell) builtinWatch(args []string, std *stdio) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	seconds := fs.Float64("n", 2, "interval between runs, in seconds")
+	highlight := fs.Bool("d", true, "highlight differences between runs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing command")
+	}
+	interval := time.Duration(*seconds * float64(time.Second))
+	if interval < 100*time.Millisecond {
+		return fmt.Errorf("interval too small: %v", interval)
+	}
+
+	// forget interrupts received before we started
+	for len(s.signalChan) > 0 {
+		<-s.signalChan
+	}
+
+	fmt.Fprint(std.out, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(std.out, "\033[?25h\033[?1049l")
+
+	header := fmt.Sprintf("Every %.1fs: %s", interval.Seconds(), strings.Join(fs.Args(), " "))
+	var previous []string
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var out bytes.Buffer
+		cmd := s.newCommand(fs.Arg(0), fs.Args()[1:])
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		if err := cmd.Run(); err != nil {
+			var exitErr interface{ ExitCode() int }
+			if !errors.As(err, &exitErr) {
+				return err
+			}
+		}
+
+		lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+		s.renderWatch(std, header, lines, previous, *highlight)
+		previous = lines
+
+		select {
+		case <-s.signalChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderWatch redraws the screen with the latest output, clipped to the
+// terminal size.
+func (s *Shell) renderWatch(std *stdio, header string, lines, previous []string, highlight bool) {
+	width, height := 80, 24
+	if f, ok := std.out.(*os.File); ok {
+		if ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ); err == nil && ws.Col > 0 {
+			width, height = int(ws.Col), int(ws.Row)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	now := time.Now().Format("15:04:05")
+	if len(header)+len(now)+1 > width {
+		header = header[:max(0, width-len(now)-1)]
+	}
+	fmt.Fprintf(&b, "%s%*s\n\n", header, width-len(header), now)
+
+	for i, line := range lines {
+		if i >= height-2 {
+			break
+		}
+		line = strings.ReplaceAll(line, "\t", "    ")
+		if len(line) > width {
+			line = line[:width]
+		}
+		old := ""
+		if i < len(previous) {
+			old = strings.ReplaceAll(previous[i], "\t", "    ")
+		}
+		if !highlight || previous == nil || line == old {
+			b.WriteString(line)
+		} else {
+			writeDiffLine(&b, line, old)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprint(std.out, b.String())
+}
+
+// writeDiffLine writes line, showing the bytes that differ from old in
+// reverse video.
+func writeDiffLine(b *strings.Builder, line, old string) {
+	inverse := false
+	for i := 0; i < len(line); i++ {
+		changed := i >= len(old) || line[i] != old[i]
+		if changed != inverse {
+			if changed {
+				b.WriteString("\033[7m")
+			} else {
+				b.WriteString("\033[0m")
+			}
+			inverse = changed
+		}
+		b.WriteByte(line[i])
+	}
+	if inverse {
+		b.WriteString("\033[0m")
+	}
+}